@@ -0,0 +1,183 @@
+package ssehandler
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The events written to each client but not yet acknowledged, by client ID,
+// see WithAcks.
+type ackStore struct {
+	mu     sync.Mutex
+	limit  int
+	retain time.Duration
+	queues map[string]*ackQueue
+
+	// Time the queues were last pruned of clients that haven't been back.
+	pruned time.Time
+}
+
+type ackQueue struct {
+	events  []Event
+	ids     map[string]bool
+	touched time.Time
+}
+
+func newAckStore(limit int, retain time.Duration) *ackStore {
+	return &ackStore{
+		limit:  limit,
+		retain: retain,
+		queues: make(map[string]*ackQueue),
+		pruned: time.Now(),
+	}
+}
+
+// Keep an event written to a client until it's acknowledged. Events without
+// an ID can't be, and the oldest events are dropped once the limit is hit.
+func (a *ackStore) sent(client string, e Event) {
+	if e.ID == "" {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	a.prune(now)
+	q := a.queues[client]
+	if q == nil {
+		q = &ackQueue{ids: make(map[string]bool)}
+		a.queues[client] = q
+	}
+	q.touched = now
+	if q.ids[e.ID] {
+		// Sent again after reconnecting
+		return
+	}
+	q.events = append(q.events, e)
+	q.ids[e.ID] = true
+	if a.limit > 0 && len(q.events) > a.limit {
+		delete(q.ids, q.events[0].ID)
+		q.events = q.events[1:]
+	}
+}
+
+// Drop the events of clients not heard from in a while, at most once per
+// retention period. Must be locked.
+func (a *ackStore) prune(now time.Time) {
+	if a.retain <= 0 || now.Sub(a.pruned) < a.retain {
+		return
+	}
+	a.pruned = now
+	for id, q := range a.queues {
+		if now.Sub(q.touched) > a.retain {
+			delete(a.queues, id)
+		}
+	}
+}
+
+// Acknowledge the events written to a client, up to and including the one
+// with the ID. Returns false if it isn't waiting for one.
+func (a *ackStore) ack(client, id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	q := a.queues[client]
+	if q == nil || !q.ids[id] {
+		return false
+	}
+	for i, e := range q.events {
+		delete(q.ids, e.ID)
+		if e.ID == id {
+			q.events = q.events[i+1:]
+			break
+		}
+	}
+	q.touched = time.Now()
+	if len(q.events) < 1 {
+		delete(a.queues, client)
+	}
+	return true
+}
+
+// Get the events written to a client that it hasn't acknowledged, oldest
+// first.
+func (a *ackStore) unacked(client string) []Event {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	q := a.queues[client]
+	if q == nil {
+		return nil
+	}
+	q.touched = time.Now()
+	return append([]Event(nil), q.events...)
+}
+
+// Keep a message written to a client, and any it joined, until acknowledged.
+func (b *SSEHandler) delivered(s *client, msg message) {
+	if b.acks == nil {
+		return
+	}
+	if msg.batch == nil {
+		b.acks.sent(s.id, msg.event)
+		return
+	}
+	for _, m := range msg.batch {
+		b.acks.sent(s.id, m.event)
+	}
+}
+
+// The JSON body POSTed to an AckHandler.
+type ackRequest struct {
+	// ID of the last event the client has processed.
+	ID string `json:"id"`
+}
+
+// Get a gin handler that clients POST the ID of the last event they processed
+// to, such as on "/events/ack", with WithAcks. The body is a JSON object with
+// the event's ID in the field "id". Clients are identified as when they
+// subscribe, by the ID given by WithAuthorize or else by WithClientID.
+// Returns 204 No Content once the events are acknowledged, or 404 Not Found if
+// the client has no unacknowledged event with the ID. Panics without WithAcks,
+// or without either WithAuthorize or WithClientID as the random IDs given by
+// default can't be known by the clients.
+func (b *SSEHandler) AckHandler() gin.HandlerFunc {
+	if b.acks == nil {
+		panic("ssehandler: ack handler requires WithAcks")
+	}
+	if b.authorize == nil && b.clientID == nil {
+		panic("ssehandler: ack handler requires WithAuthorize or WithClientID")
+	}
+	return func(c *gin.Context) {
+		var id string
+		var auth ClientInfo
+		if b.authorize != nil {
+			var err error
+			if auth, err = b.authorize(c); err != nil {
+				c.AbortWithError(b.authorizeStatus, err)
+				return
+			}
+			id = auth.ID
+		}
+		if id == "" && b.clientID != nil {
+			id = b.clientID(c)
+		}
+		if b.tenants != nil {
+			id = TenantTopic(b.tenants.key(c, auth), id)
+		}
+		var req ackRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		if req.ID == "" {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if !b.acks.ack(id, req.ID) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
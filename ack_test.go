@@ -0,0 +1,66 @@
+package ssehandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAcks(t *testing.T) {
+	b := NewSSEHandler(WithAcks(3, 0), WithClientID(func(c *gin.Context) string {
+		return c.GetHeader("X-Client")
+	}))
+	for _, id := range []string{"1", "2", "3", "2", "4", ""} {
+		b.acks.sent("c", Event{ID: id})
+	}
+	if got := joinIDs(b.acks.unacked("c")); got != "234" {
+		t.Errorf("got unacked %q", got)
+	}
+
+	r := gin.New()
+	r.POST("/events/ack", b.AckHandler())
+	for id, want := range map[string]int{"3": http.StatusNoContent, "1": http.StatusNotFound, "": http.StatusBadRequest} {
+		req := httptest.NewRequest("POST", "/events/ack", strings.NewReader(`{"id":"`+id+`"}`))
+		req.Header.Set("X-Client", "c")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("ack %q: got %d", id, rec.Code)
+		}
+	}
+	if got := joinIDs(b.acks.unacked("c")); got != "4" {
+		t.Errorf("got unacked %q after ack", got)
+	}
+
+	s := &client{unacked: b.acks.unacked("c")}
+	if got := joinIDs(b.missedEvents(s)); got != "4" {
+		t.Errorf("got missed %q", got)
+	}
+}
+
+func TestAckHandlerWithoutClientID(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []Option
+		panic bool
+	}{
+		{"default", []Option{WithAcks(3, 0)}, true},
+		{"client id", []Option{WithAcks(3, 0), WithClientID(func(c *gin.Context) string { return "c" })}, false},
+		{"authorize", []Option{WithAcks(3, 0), WithAuthorize(func(c *gin.Context) (ClientInfo, error) {
+			return ClientInfo{ID: "c"}, nil
+		})}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if got := recover() != nil; got != tt.panic {
+					t.Errorf("got panic %v", got)
+				}
+			}()
+			NewSSEHandler(tt.opts...).AckHandler()
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package ssehandler
+
+// Get a matcher allowing only the topics, for WithTopicACL. The topics may be
+// patterns with wildcards, allowing any topics or narrower patterns they
+// match, such as "logs/#" allowing "logs/app" and "logs/+".
+func AllowTopics(topics ...string) func(topic string) bool {
+	allowed := make(map[string]bool, len(topics))
+	var patterns []string
+	for _, t := range topics {
+		if isPattern(t) {
+			patterns = append(patterns, t)
+		}
+		allowed[t] = true
+	}
+	return func(topic string) bool {
+		if allowed[topic] {
+			return true
+		}
+		for _, p := range patterns {
+			if topicMatches(p, topic) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,80 @@
+package ssehandler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTopicACL(t *testing.T) {
+	b := NewSSEHandler()
+	s := &client{
+		id:      "a",
+		events:  make(chan message, 10),
+		gone:    make(chan struct{}),
+		allowed: AllowTopics("orders", "news"),
+	}
+	s.topics = s.allowedTopics([]string{"orders", "admin"})
+	b.addClient(s)
+	b.changeMembership(membership{clientID: "a", room: "secret", join: true})
+	b.changeMembership(membership{clientID: "a", room: "news", join: true})
+	if got := strings.Join(s.topics, ","); got != "orders,news" {
+		t.Fatalf("got topics %q", got)
+	}
+
+	tests := []struct {
+		topic string
+		want  bool
+	}{
+		{"", true},
+		{"orders", true},
+		{"admin", false},
+		{"secret", false},
+	}
+	for _, tt := range tests {
+		if got := s.accepts(Event{Topic: tt.topic}); got != tt.want {
+			t.Errorf("topic %q: got %v, want %v", tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestReservedTopics(t *testing.T) {
+	tests := []struct {
+		allowed func(string) bool
+		topics  string
+		accepts bool
+	}{
+		{nil, "orders", false},
+		{AllowTopics("#"), "orders", false},
+		{AllowTopics("orders", DebugTopic), "orders," + DebugTopic, true},
+	}
+	for _, tt := range tests {
+		s := &client{allowed: tt.allowed}
+		if got := strings.Join(s.allowedTopics([]string{"orders", DebugTopic}), ","); got != tt.topics {
+			t.Errorf("got topics %q, want %q", got, tt.topics)
+		}
+		if got := s.accepts(Event{Topic: DebugTopic}); got != tt.accepts {
+			t.Errorf("got %v for the debug topic, want %v", got, tt.accepts)
+		}
+	}
+}
+
+func TestAllowTopicPatterns(t *testing.T) {
+	allowed := AllowTopics("orders", "logs/#")
+	tests := []struct {
+		topic string
+		want  bool
+	}{
+		{"orders", true},
+		{"logs", true},
+		{"logs/app", true},
+		{"logs/+", true},
+		{"logs/#", true},
+		{"#", false},
+		{"orders/1", false},
+	}
+	for _, tt := range tests {
+		if got := allowed(tt.topic); got != tt.want {
+			t.Errorf("topic %q: got %v, want %v", tt.topic, got, tt.want)
+		}
+	}
+}
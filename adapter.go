@@ -0,0 +1,31 @@
+package ssehandler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Turn any of the handler's gin handlers, such as from Handler,
+// WebSocketHandler, PollHandler or PublishHandler, into a standard
+// http.Handler, for mounting the same handler in plain net/http muxes and
+// other routers. Each request gets a gin context of its own, so the hooks and
+// options taking one work the same for both, although it holds no route
+// parameters.
+func Adapt(h gin.HandlerFunc) http.Handler {
+	e := gin.New()
+	e.ContextWithFallback = true
+	e.Use(func(c *gin.Context) {
+		// Without any routes every request is unmatched, which starts it
+		// off as a 404
+		c.Status(http.StatusOK)
+		h(c)
+	})
+	return e
+}
+
+// Get a standard http.Handler that subscribes new clients to the topics. See
+// Adapt.
+func (b *SSEHandler) HTTPHandler(topics ...string) http.Handler {
+	return Adapt(b.Handler(topics...))
+}
@@ -0,0 +1,29 @@
+package ssehandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdapt(t *testing.T) {
+	tests := []struct {
+		h    gin.HandlerFunc
+		code int
+		body string
+	}{
+		{func(c *gin.Context) { c.String(http.StatusOK, c.Request.URL.Path) }, http.StatusOK, "/any/path"},
+		{func(c *gin.Context) { c.AbortWithStatus(http.StatusTeapot) }, http.StatusTeapot, ""},
+		{func(c *gin.Context) {}, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		Adapt(tt.h).ServeHTTP(w, httptest.NewRequest("POST", "/any/path", strings.NewReader("x")))
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("got %d %q, want %d %q", w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package ssehandler
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Details about a connected client, see Clients.
+type ClientDetails struct {
+	// Unique ID of the client.
+	ID string `json:"id"`
+
+	// ID of the user the client belongs to, if known.
+	UserID string `json:"user,omitempty"`
+
+	// IP address and user agent the client connected from.
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent,omitempty"`
+
+	// Metadata about the client, as given by WithMetadata.
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+
+	// Topics the client is currently subscribed to.
+	Topics []string `json:"topics"`
+
+	// Time the client connected.
+	Connected time.Time `json:"connected"`
+
+	// Number of messages waiting in the client's buffer, the most that
+	// have ever been waiting and the size of the buffer. Clients with a
+	// high-water mark close to the size are falling behind, and will soon
+	// be handled by the slow client policy.
+	Queued    int `json:"queued"`
+	HighWater int `json:"high_water"`
+	Capacity  int `json:"capacity"`
+}
+
+// Get the details of all connected clients, sorted by the time they
+// connected. Returns nothing if the event loop isn't running.
+func (b *SSEHandler) Clients() []ClientDetails {
+	if !b.running.Load() {
+		return nil
+	}
+	req := make(chan []ClientDetails, 1)
+	select {
+	case b.clientsRequests <- req:
+		return <-req
+	case <-b.done:
+		return nil
+	}
+}
+
+// Collect the details of all clients. Only called by the event loop.
+func (b *SSEHandler) clientDetails() []ClientDetails {
+	var list []ClientDetails
+	for s := range b.clients {
+		list = append(list, ClientDetails{
+			ID:        s.id,
+			UserID:    s.user,
+			IP:        s.ip,
+			UserAgent: s.userAgent,
+			Metadata:  s.metadata,
+			Topics:    append([]string{}, s.topics...),
+			Connected: s.connected,
+			Queued:    len(s.events),
+			HighWater: s.highWater,
+			Capacity:  cap(s.events),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Connected.Before(list[j].Connected)
+	})
+	return list
+}
+
+// Mount the admin endpoints on r, behind the auth middleware, which must
+// abort any request that isn't allowed to use them:
+//
+//	GET    /clients       lists the connected clients, see Clients
+//	GET    /topics        counts the clients subscribed to each topic
+//	DELETE /clients/:id   disconnects a client, sending it the optional
+//	                      ?reason= as a "disconnect" event, see Disconnect
+//
+// Panics if auth is nil, so the endpoints can't be left open by mistake.
+func (b *SSEHandler) AdminRoutes(r gin.IRouter, auth gin.HandlerFunc) {
+	if auth == nil {
+		panic("ssehandler: admin routes require an auth middleware")
+	}
+	g := r.Group("", auth)
+	g.GET("/clients", func(c *gin.Context) {
+		list := b.Clients()
+		if list == nil {
+			list = []ClientDetails{}
+		}
+		c.JSON(http.StatusOK, list)
+	})
+	g.GET("/topics", func(c *gin.Context) {
+		c.JSON(http.StatusOK, b.Stats().Topics)
+	})
+	g.DELETE("/clients/:id", func(c *gin.Context) {
+		switch err := b.Disconnect(c.Param("id"), c.Query("reason")); err {
+		case nil:
+			c.Status(http.StatusNoContent)
+		case ErrClientNotFound:
+			c.AbortWithError(http.StatusNotFound, err)
+		case ErrNotRunning:
+			c.AbortWithError(http.StatusServiceUnavailable, err)
+		default:
+			c.AbortWithError(http.StatusInternalServerError, err)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package ssehandler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminRoutes(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	b := NewSSEHandler()
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	r := gin.New()
+	b.AdminRoutes(r.Group("/admin"), func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "secret" {
+			c.AbortWithStatus(http.StatusForbidden)
+		}
+	})
+
+	tests := []struct {
+		method, path, auth string
+		code               int
+		body               string
+	}{
+		{"GET", "/admin/clients", "", http.StatusForbidden, ""},
+		{"GET", "/admin/clients", "secret", http.StatusOK, "[]"},
+		{"GET", "/admin/topics", "secret", http.StatusOK, "{}"},
+		{"DELETE", "/admin/clients/nope", "", http.StatusForbidden, ""},
+		{"DELETE", "/admin/clients/nope", "secret", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Authorization", tt.auth)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("%s %s: got %d %q, want %d %q", tt.method, tt.path, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+}
+
+func TestClientDetailsQueue(t *testing.T) {
+	b := NewSSEHandler()
+	s := &client{id: "a", events: make(chan message, 4), gone: make(chan struct{})}
+	b.addClient(s)
+	for i := 0; i < 3; i++ {
+		b.offer(s, message{})
+	}
+	<-s.events
+	<-s.events
+	d := b.clientDetails()
+	if len(d) != 1 || d[0].Queued != 1 || d[0].HighWater != 3 || d[0].Capacity != 4 {
+		t.Errorf("got %+v", d)
+	}
+	if got := b.stats().MaxQueued; got != 1 {
+		t.Errorf("got %d queued at most", got)
+	}
+}
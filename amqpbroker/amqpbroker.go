@@ -0,0 +1,175 @@
+// RabbitMQ/AMQP broker for the SSE handler, for broadcasting events across
+// multiple instances.
+
+package amqpbroker
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	ssehandler "github.com/lmas/gin-sse"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// A Broker publishes events to a durable AMQP exchange, shared by all
+// instances. Each instance consumes the exchange through a queue of its own,
+// which is deleted once the instance disconnects. With a "topic" exchange,
+// events are published with their topic as the routing key, so other
+// consumers of the exchange can bind to the topics they need. The levels of
+// the topic are separated by "." in the key instead of "/", so "orders/eu"
+// can be bound to as "orders.*", and any "." or "%" within a level is
+// percent-encoded.
+type Broker struct {
+	url      string
+	exchange string
+	kind     string
+
+	// Connection and channel for publishing, opened on first use and
+	// reopened after failing.
+	mu   sync.Mutex
+	conn *amqp.Connection
+	pub  *amqp.Channel
+}
+
+// Make a new Broker using the exchange of the kind, "fanout" or "topic", on
+// the AMQP server at url. The exchange is declared if it doesn't exist yet.
+func New(url, exchange, kind string) *Broker {
+	return &Broker{
+		url:      url,
+		exchange: exchange,
+		kind:     kind,
+	}
+}
+
+// Open a connection and a channel, declaring the exchange.
+func (b *Broker) dial() (*amqp.Connection, *amqp.Channel, error) {
+	conn, err := amqp.Dial(b.url)
+	if err != nil {
+		return nil, nil, err
+	}
+	ch, err := conn.Channel()
+	if err == nil {
+		err = ch.ExchangeDeclare(b.exchange, b.kind, true, false, false, false, nil)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, ch, nil
+}
+
+// Get the channel for publishing, reconnecting if it's been closed.
+func (b *Broker) channel() (*amqp.Channel, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pub != nil && !b.pub.IsClosed() {
+		return b.pub, nil
+	}
+	if b.conn != nil {
+		b.conn.Close()
+	}
+	var err error
+	b.conn, b.pub, err = b.dial()
+	return b.pub, err
+}
+
+// Publish an event to all instances.
+func (b *Broker) Publish(ctx context.Context, e ssehandler.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ch, err := b.channel()
+	if err != nil {
+		return err
+	}
+	return ch.PublishWithContext(ctx, b.exchange, routingKey(e.Topic), false, false, amqp.Publishing{
+		ContentType: "application/json",
+		Body:        data,
+	})
+}
+
+// Get the routing key for a topic, see Broker.
+func routingKey(topic string) string {
+	levels := strings.Split(topic, "/")
+	for i, l := range levels {
+		levels[i] = escaper.Replace(l)
+	}
+	return strings.Join(levels, ".")
+}
+
+// Percent-encodes the characters that would split a level of a routing key,
+// along with "%" itself.
+var escaper = strings.NewReplacer("%", "%25", ".", "%2E")
+
+// Subscribe to the events published by all instances, until ctx is done or
+// the connection is lost, in which case the handler subscribes again.
+func (b *Broker) Subscribe(ctx context.Context) (<-chan ssehandler.Event, error) {
+	conn, ch, err := b.dial()
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := b.consume(ch)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	events := make(chan ssehandler.Event)
+	go func() {
+		defer close(events)
+		defer conn.Close()
+		for {
+			select {
+			case d, open := <-deliveries:
+				if !open {
+					return
+				}
+				var e ssehandler.Event
+				if err := json.Unmarshal(d.Body, &e); err != nil {
+					// Not one of ours
+					continue
+				}
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// Declare the instance's own queue, bound to all of the exchange's events,
+// and start consuming it.
+func (b *Broker) consume(ch *amqp.Channel) (<-chan amqp.Delivery, error) {
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	key := ""
+	if b.kind == amqp.ExchangeTopic {
+		key = "#"
+	}
+	if err := ch.QueueBind(q.Name, key, b.exchange, false, nil); err != nil {
+		return nil, err
+	}
+	return ch.Consume(q.Name, "", true, true, false, false, nil)
+}
+
+// Close the connection used for publishing.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		return nil
+	}
+	err := b.conn.Close()
+	b.conn, b.pub = nil, nil
+	return err
+}
@@ -0,0 +1,21 @@
+package amqpbroker
+
+import "testing"
+
+func TestRoutingKey(t *testing.T) {
+	tests := []struct {
+		topic, want string
+	}{
+		{"", ""},
+		{"orders", "orders"},
+		{"orders/eu", "orders.eu"},
+		{"sensors/1/temp", "sensors.1.temp"},
+		{"v1.2/status", "v1%2E2.status"},
+		{"100%", "100%25"},
+	}
+	for _, tt := range tests {
+		if got := routingKey(tt.topic); got != tt.want {
+			t.Errorf("routingKey(%q) = %q, want %q", tt.topic, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package ssehandler
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBackfill(t *testing.T) {
+	b := NewSSEHandler(WithReplay(10))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	b.Send(Event{ID: "3"})
+	b.Sync(context.Background())
+
+	s := &client{
+		lastEventID: "1",
+		backfill:    []Event{{ID: "a"}, {ID: "secret"}, {ID: "b"}},
+		filter:      func(e Event) bool { return e.ID != "secret" },
+	}
+	if got := joinIDs(b.missedEvents(s)); got != "ab3" {
+		t.Errorf("got %q", got)
+	}
+	if s.backfill != nil {
+		t.Error("backfill kept after it was sent")
+	}
+}
@@ -0,0 +1,63 @@
+package ssehandler
+
+import "time"
+
+// How often the clients are checked again while producers are pushed back.
+const pressureInterval = 100 * time.Millisecond
+
+// Check if a client's buffer is full.
+func saturated(s *client) bool {
+	return cap(s.events) > 0 && len(s.events) >= cap(s.events)
+}
+
+// Push back on producers, or stop doing so, after a broadcast reached total
+// clients, of which full had full buffers. Only called by the event loop.
+func (b *SSEHandler) measurePressure(full, total int) {
+	queueFull := len(b.messages) >= cap(b.messages)
+	b.setPressure(queueFull || (total > 0 && float64(full) >= b.backpressure*float64(total)))
+}
+
+// Check all clients again, while producers are pushed back. Only called by
+// the event loop.
+func (b *SSEHandler) recheckPressure() {
+	var full int
+	for s := range b.clients {
+		if saturated(s) {
+			full++
+		}
+	}
+	b.measurePressure(full, len(b.clients))
+}
+
+// Change whether producers are pushed back, calling the hook if it changed.
+func (b *SSEHandler) setPressure(on bool) {
+	if b.pressured.Swap(on) == on {
+		return
+	}
+	if on {
+		b.logger.Info("Clients can't keep up, pushing back on producers")
+		b.pressureTicker = time.NewTicker(pressureInterval)
+	} else {
+		b.logger.Info("Clients caught up, no longer pushing back on producers")
+		b.stopPressureTicker()
+	}
+	if b.onBackpressure != nil {
+		b.onBackpressure(on)
+	}
+}
+
+// Get the channel of ticks for checking the clients again, or nil if
+// producers aren't pushed back.
+func (b *SSEHandler) pressureTick() <-chan time.Time {
+	if b.pressureTicker == nil {
+		return nil
+	}
+	return b.pressureTicker.C
+}
+
+func (b *SSEHandler) stopPressureTicker() {
+	if b.pressureTicker != nil {
+		b.pressureTicker.Stop()
+		b.pressureTicker = nil
+	}
+}
@@ -0,0 +1,32 @@
+package ssehandler
+
+import "testing"
+
+func TestBackpressure(t *testing.T) {
+	var changes []bool
+	b := NewSSEHandler(WithBackpressure(0.5, func(on bool) {
+		changes = append(changes, on)
+	}), WithSlowClientPolicy(DropNewest))
+	clients := []*client{
+		{id: "a", events: make(chan message, 1)},
+		{id: "b", events: make(chan message, 1)},
+		{id: "c", events: make(chan message, 2)},
+	}
+	for _, s := range clients {
+		s.gone = make(chan struct{})
+		b.addClient(s)
+	}
+
+	b.fanOut(b.newMessage(Event{}))
+	if !b.pressured.Load() {
+		t.Fatal("expected producers to be pushed back, with 2 of 3 clients full")
+	}
+	<-clients[0].events
+	b.recheckPressure()
+	if b.pressured.Load() {
+		t.Fatal("expected producers to be let go, with 1 of 3 clients full")
+	}
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Fatalf("hook got %v", changes)
+	}
+}
@@ -0,0 +1,150 @@
+package ssehandler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Send out many events at once, such as the updates of an import, to all
+// clients or those subscribed to each event's topic. The events are pushed
+// out in a single pass, and each client gets the ones it receives written
+// and flushed all at once, instead of one by one. Throttling and coalescing
+// are skipped, as well as PublishEvent's results for the events. With a
+// broker the batch is published as a single event.
+func (b *SSEHandler) SendBatch(events []Event) {
+	if err := b.sendBatch(b.ctx, events); err != nil && err != ErrNotRunning && err != ErrCircuitOpen && err != context.Canceled {
+		b.fail("publish", "", err, "Error while sending batch")
+	}
+}
+
+func (b *SSEHandler) sendBatch(ctx context.Context, events []Event) error {
+	if !b.running.Load() {
+		return ErrNotRunning
+	}
+	// Any middleware sees each event, and might drop some
+	batch := make([]Event, 0, len(events))
+	collect := b.intercept(func(ctx context.Context, e Event) error {
+		batch = append(batch, b.prepare(ctx, e))
+		return nil
+	})
+	for _, e := range events {
+		if err := collect(ctx, e); err != nil {
+			return err
+		}
+	}
+	if len(batch) < 1 {
+		return nil
+	}
+	if b.broker != nil {
+		packed, err := packBatch(batch)
+		if err != nil {
+			return err
+		}
+		return b.guardedPublish(ctx, packed)
+	}
+	select {
+	case b.batches <- batch:
+		return nil
+	case <-b.quit:
+		return ErrNotRunning
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Send out a batch of events. Only called by the event loop.
+func (b *SSEHandler) broadcastBatch(events []Event) {
+	if b.hold(func() { b.broadcastBatch(events) }, events...) {
+		return
+	}
+	start := time.Now()
+	msgs := make([]message, 0, len(events))
+	for _, e := range events {
+		e = b.sequence(b.patch(e))
+		b.remember(e)
+		if b.latest != nil {
+			b.latest.put(e)
+		}
+		msgs = append(msgs, b.newMessage(e))
+	}
+	b.spread(&fanout{batch: msgs})
+	b.eventsSent += uint64(len(msgs))
+	b.lastBroadcast.Store(time.Now().UnixNano())
+	b.metrics.broadcasts.Add(float64(len(msgs)))
+	b.metrics.latency.Observe(time.Since(start).Seconds())
+}
+
+// Attribute marking the events carrying a batch through a broker.
+const batchAttribute = "ssehandler-batch"
+
+// Pack a batch into a single event, for publishing it through a broker.
+func packBatch(events []Event) (Event, error) {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Data: data, Attributes: map[string]string{batchAttribute: "1"}}, nil
+}
+
+// Unpack a batch published through a broker, if the event carries one.
+func unpackBatch(e Event) ([]Event, bool) {
+	if e.Attributes[batchAttribute] == "" {
+		return nil, false
+	}
+	var events []Event
+	if err := json.Unmarshal(e.Data, &events); err != nil {
+		return nil, false
+	}
+	return events, true
+}
+
+// Push a batch of events to the shard's clients, joining the ones each client
+// receives into a single message.
+func (sh *shard) pushBatch(b *SSEHandler, batch []message) {
+	for s := range sh.clients {
+		sh.pushBatchTo(b, s, batch)
+	}
+}
+
+func (sh *shard) pushBatchTo(b *SSEHandler, s *client, batch []message) {
+	defer func() {
+		if v := recover(); v != nil {
+			b.recovered("fan-out", v)
+			sh.result.Dropped++
+		}
+	}()
+	var picked []message
+	for _, m := range batch {
+		if !s.follows(m.event.Topic) {
+			continue
+		}
+		if !s.accepts(m.event) {
+			sh.result.Filtered++
+			continue
+		}
+		picked = append(picked, m)
+	}
+	switch len(picked) {
+	case 0:
+	case 1:
+		sh.offer(b, s, picked[0])
+	default:
+		sh.offer(b, s, joinMessages(picked))
+	}
+}
+
+// Join many messages into one, written all at once.
+func joinMessages(msgs []message) message {
+	raw := make([][]byte, len(msgs))
+	joined := message{batch: msgs}
+	for i, m := range msgs {
+		raw[i] = m.raw
+		if m.priority > joined.priority {
+			joined.priority = m.priority
+		}
+	}
+	joined.raw = bytes.Join(raw, nil)
+	return joined
+}
@@ -0,0 +1,54 @@
+package ssehandler
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPushBatch(t *testing.T) {
+	b := NewSSEHandler()
+	a := &client{id: "a", topics: []string{"a"}, events: make(chan message, 4), gone: make(chan struct{})}
+	all := &client{id: "all", topics: []string{"#"}, events: make(chan message, 4), gone: make(chan struct{}),
+		filter: func(e Event) bool { return e.ID != "3" }}
+	b.addClient(a)
+	b.addClient(all)
+	var batch []message
+	for _, e := range []Event{{ID: "1", Topic: "a"}, {ID: "2", Topic: "b"}, {ID: "3", Topic: "a"}} {
+		batch = append(batch, b.newMessage(e))
+	}
+	result := b.spread(&fanout{batch: batch})
+	if result.Enqueued != 2 || result.Filtered != 1 {
+		t.Errorf("got %+v", result)
+	}
+	// Each client gets a single message, with the events it receives
+	for _, tt := range []struct {
+		s    *client
+		want string
+	}{
+		{a, "id: 1\ndata: \n\nid: 3\ndata: \n\n"},
+		{all, "id: 1\ndata: \n\nid: 2\ndata: \n\n"},
+	} {
+		if n := len(tt.s.events); n != 1 {
+			t.Fatalf("%s: got %d messages", tt.s.id, n)
+		}
+		if got := string((<-tt.s.events).raw); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.s.id, got, tt.want)
+		}
+	}
+}
+
+func TestSendBatch(t *testing.T) {
+	b := NewSSEHandler(WithReplay(10))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	b.Send(Event{ID: "1"})
+	b.SendBatch([]Event{{ID: "2"}, {ID: "3"}})
+	b.Send(Event{ID: "4"})
+	b.Sync(context.Background())
+	if got := history(t, b); got != "1234" {
+		t.Errorf("got %q", got)
+	}
+	if got := b.Stats().EventsSent; got != 4 {
+		t.Errorf("got %d events sent", got)
+	}
+}
@@ -0,0 +1,147 @@
+package ssehandler
+
+import (
+	"context"
+	"time"
+)
+
+// A Broker distributes events between handlers running on different
+// instances, so that events sent on one instance reach the clients connected
+// to any of them. See WithBroker.
+type Broker interface {
+	// Publish an event to the handlers on all instances, including this one.
+	Publish(ctx context.Context, e Event) error
+
+	// Subscribe to the events published by all instances. The returned
+	// channel is closed when ctx is done.
+	Subscribe(ctx context.Context) (<-chan Event, error)
+}
+
+// Publish an event, passing it through any middleware first.
+func (b *SSEHandler) publish(ctx context.Context, e Event) error {
+	return b.intercept(b.dispatch)(ctx, e)
+}
+
+// Publish an event through the broker, if set, or queue it for the event loop.
+func (b *SSEHandler) dispatch(ctx context.Context, e Event) error {
+	return b.emit(ctx, b.prepare(ctx, e))
+}
+
+// Get an event ready for publishing. The event gets its ID here, so that it's
+// the same on all instances, and is inserted into any shared store.
+func (b *SSEHandler) prepare(ctx context.Context, e Event) Event {
+	if shared, ok := b.store.(SharedStore); ok {
+		stored, err := shared.Insert(ctx, e)
+		if err != nil {
+			b.fail("store", "", err, "Error while storing event")
+		} else {
+			e = stored
+		}
+	}
+	return b.assignID(ctx, withExpiry(e))
+}
+
+// Publish a prepared event through the broker, if set, or queue it for the
+// event loop.
+func (b *SSEHandler) emit(ctx context.Context, e Event) error {
+	if b.broker != nil {
+		return b.guardedPublish(ctx, e)
+	}
+	return b.queue(ctx, e)
+}
+
+// Queue an event for this instance's event loop.
+func (b *SSEHandler) queue(ctx context.Context, e Event) error {
+	if b.closed() {
+		return ErrNotRunning
+	}
+	select {
+	case b.messages <- e:
+		return nil
+	case <-b.quit:
+		return ErrNotRunning
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Check if TrySend must queue events for publishQueued, as publishing them
+// involves calls to a broker, store or ID generator that might block.
+func (b *SSEHandler) publishesQueued() bool {
+	_, shared := b.store.(SharedStore)
+	return b.broker != nil || shared || b.idGenerator != nil
+}
+
+// Publish the events queued by TrySend, until the handler is closed.
+func (b *SSEHandler) publishQueued() {
+	for {
+		select {
+		case e := <-b.outbound:
+			if err := b.publish(b.ctx, e); err != nil && err != ErrNotRunning && err != ErrCircuitOpen && err != context.Canceled {
+				b.fail("publish", "", err, "Error while sending event")
+			}
+		case <-b.quit:
+			return
+		}
+	}
+}
+
+// Bounds of the delay between attempts at subscribing to the broker.
+const (
+	minBrokerBackoff = 100 * time.Millisecond
+	maxBrokerBackoff = 30 * time.Second
+)
+
+// Forward the events published through the broker into the event loop, until
+// the handler is closed. The subscription is retried, with an increasing
+// delay, whenever it fails or ends.
+func (b *SSEHandler) forwardBroker() {
+	backoff := minBrokerBackoff
+	for {
+		events, err := b.broker.Subscribe(b.ctx)
+		if err != nil {
+			b.fail("broker", "", err, "Error while subscribing to broker")
+		} else {
+			b.setBrokerConnected(true)
+			backoff = minBrokerBackoff
+			for e := range events {
+				select {
+				case b.messages <- e:
+				case <-b.quit:
+					b.setBrokerConnected(false)
+					return
+				}
+			}
+			b.setBrokerConnected(false)
+		}
+
+		select {
+		case <-b.quit:
+			return
+		case <-time.After(backoff):
+		}
+		if err == nil {
+			b.logger.Info("Broker subscription ended, resubscribing")
+			b.reportError(&HandlerError{Op: "broker", Err: ErrBrokerDisconnected})
+		}
+		backoff *= 2
+		if backoff > maxBrokerBackoff {
+			backoff = maxBrokerBackoff
+		}
+	}
+}
+
+func (b *SSEHandler) setBrokerConnected(up bool) {
+	b.brokerConnected.Store(up)
+	if up {
+		b.metrics.broker.Set(1)
+	} else {
+		b.metrics.broker.Set(0)
+	}
+}
+
+// Check if the handler is subscribed to its broker, and so receiving the
+// events sent on other instances. Always true without a broker.
+func (b *SSEHandler) BrokerConnected() bool {
+	return b.broker == nil || b.brokerConnected.Load()
+}
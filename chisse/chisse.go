@@ -0,0 +1,32 @@
+// chi adapter for the SSE handler, for mounting the same handler in services
+// routed by chi.
+
+package chisse
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-chi/chi/v5"
+	ssehandler "github.com/lmas/gin-sse"
+)
+
+// Get a handler that subscribes new clients to the topics, see
+// SSEHandler.Subscribe.
+func Handler(b *ssehandler.SSEHandler, topics ...string) http.Handler {
+	return b.HTTPHandler(topics...)
+}
+
+// Get a handler that subscribes new clients to the topic in the chi URL
+// parameter, such as "topic" for routes like "/events/{topic}".
+func TopicHandler(b *ssehandler.SSEHandler, param string) http.Handler {
+	return ssehandler.Adapt(func(c *gin.Context) {
+		b.Subscribe(c, chi.URLParam(c.Request, param))
+	})
+}
+
+// Get a handler that broadcasts the events POSTed to it, see
+// SSEHandler.PublishHandler.
+func PublishHandler(b *ssehandler.SSEHandler, authorize func(c *gin.Context) error) http.Handler {
+	return ssehandler.Adapt(b.PublishHandler(authorize))
+}
@@ -0,0 +1,66 @@
+package chisse
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-chi/chi/v5"
+	ssehandler "github.com/lmas/gin-sse"
+)
+
+func TestTopicHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	b := ssehandler.NewSSEHandler()
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	r := chi.NewRouter()
+	r.Get("/events/{topic}", TopicHandler(b, "topic").ServeHTTP)
+	r.Post("/publish", PublishHandler(b, func(c *gin.Context) error { return nil }).ServeHTTP)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events/orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	for b.ClientCount() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	for _, topic := range []string{"other", "orders"} {
+		pub, err := http.Post(srv.URL+"/publish", "application/json",
+			strings.NewReader(`{"topic": "`+topic+`", "data": "`+topic+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub.Body.Close()
+		if pub.StatusCode != http.StatusAccepted {
+			t.Fatalf("got %d publishing", pub.StatusCode)
+		}
+	}
+
+	got := make(chan string)
+	go func() {
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			if data, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+				got <- data
+				return
+			}
+		}
+	}()
+	select {
+	case data := <-got:
+		if data != "orders" {
+			t.Errorf("got %q", data)
+		}
+	case <-time.After(time.Second):
+		t.Error("no event received")
+	}
+}
@@ -0,0 +1,128 @@
+package ssehandler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// State of the circuit breaker guarding publishes to the broker, see
+// WithCircuitBreaker.
+type circuitState int
+
+const (
+	// Publishing through the broker.
+	circuitClosed circuitState = iota
+
+	// Failing publishes right away, after too many failed in a row.
+	circuitOpen
+
+	// Trying a single publish, after the cooldown, to see if the broker is
+	// back.
+	circuitHalfOpen
+)
+
+type circuit struct {
+	mu sync.Mutex
+
+	// Failures in a row that open the circuit, and the time it stays open
+	// for at first. The cooldown doubles every time a trial fails.
+	threshold int
+	cooldown  time.Duration
+
+	state    circuitState
+	failures int
+	backoff  time.Duration
+	until    time.Time
+}
+
+// Check if a publish may go through to the broker. Once the cooldown has
+// passed, a single publish is let through as a trial.
+func (c *circuit) allow(now time.Time) (ok bool, changed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.state {
+	case circuitClosed:
+		return true, false
+	case circuitOpen:
+		if now.Before(c.until) {
+			return false, false
+		}
+		c.state = circuitHalfOpen
+		return true, true
+	}
+	// A trial is already under way
+	return false, false
+}
+
+// Record the outcome of a publish let through, returning the circuit's new
+// state and whether it changed.
+func (c *circuit) done(err error, now time.Time) (circuitState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		changed := c.state != circuitClosed
+		c.state, c.failures, c.backoff = circuitClosed, 0, 0
+		return c.state, changed
+	}
+	c.failures++
+	switch {
+	case c.state == circuitHalfOpen:
+		c.backoff *= 2
+		if c.backoff > maxBrokerBackoff {
+			c.backoff = maxBrokerBackoff
+		}
+	case c.failures >= c.threshold:
+		c.backoff = c.cooldown
+	default:
+		return c.state, false
+	}
+	changed := c.state != circuitOpen
+	c.state, c.until = circuitOpen, now.Add(c.backoff)
+	return c.state, changed
+}
+
+// Publish an event through the circuit breaker, if set. While the circuit is
+// open the event is sent out to the local clients instead, returning
+// ErrCircuitOpen so callers can tell only those got it. If a publish fails the
+// event is sent out to the local clients as well, and the error is returned.
+func (b *SSEHandler) guardedPublish(ctx context.Context, e Event) error {
+	if b.circuit == nil {
+		return b.brokerPublish(ctx, e)
+	}
+	ok, changed := b.circuit.allow(time.Now())
+	if changed {
+		b.circuitChanged(circuitHalfOpen, nil)
+	}
+	if !ok {
+		if err := b.queue(ctx, e); err != nil {
+			return err
+		}
+		return ErrCircuitOpen
+	}
+	err := b.brokerPublish(ctx, e)
+	if state, changed := b.circuit.done(err, time.Now()); changed {
+		b.circuitChanged(state, err)
+	}
+	if err != nil || !b.brokerConnected.Load() {
+		// The event won't come back through the broker by itself
+		if qerr := b.queue(ctx, e); err == nil {
+			err = qerr
+		}
+	}
+	return err
+}
+
+// Let the metrics, logs and error hook know the circuit breaker changed state.
+func (b *SSEHandler) circuitChanged(state circuitState, err error) {
+	b.metrics.circuit.Set(float64(state))
+	switch state {
+	case circuitOpen:
+		b.logger.Error("Broker circuit opened, publishing locally", "err", err)
+		b.reportError(&HandlerError{Op: "broker", Err: ErrCircuitOpen})
+	case circuitHalfOpen:
+		b.logger.Info("Broker circuit half-open, trying a publish")
+	case circuitClosed:
+		b.logger.Info("Broker circuit closed")
+	}
+}
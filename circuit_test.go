@@ -0,0 +1,69 @@
+package ssehandler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A broker whose publishes always fail.
+type failingBroker struct {
+	downBroker
+	publishes atomic.Int32
+}
+
+func (f *failingBroker) Publish(context.Context, Event) error {
+	f.publishes.Add(1)
+	return errors.New("connection refused")
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	br := &failingBroker{}
+	var dead atomic.Int32
+	b := NewSSEHandler(WithBroker(br), WithCircuitBreaker(2, time.Hour), WithDeadLetter(func(DeadLetter) error {
+		dead.Add(1)
+		return nil
+	}))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	for i := 0; i < 3; i++ {
+		// Sent locally, as the circuit's open after two failures
+		switch err := b.SendContext(context.Background(), Event{}); {
+		case i < 2 && (err == nil || err == ErrCircuitOpen):
+			t.Errorf("send %d: got %v, want the publish error", i, err)
+		case i == 2 && err != ErrCircuitOpen:
+			t.Errorf("send %d: got %v, want %v", i, err, ErrCircuitOpen)
+		}
+	}
+	if got := br.publishes.Load(); got != 2 {
+		t.Errorf("got %d publishes", got)
+	}
+	b.Sync(context.Background())
+	if got := b.Stats().EventsSent; got != 3 {
+		t.Errorf("got %d events sent locally", got)
+	}
+	for i := 0; i < 100 && dead.Load() < 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if got := dead.Load(); got != 2 {
+		t.Errorf("got %d dead letters", got)
+	}
+
+	c := &circuit{threshold: 1, cooldown: time.Second}
+	now := time.Now()
+	c.done(errors.New("down"), now)
+	if ok, _ := c.allow(now); ok {
+		t.Error("publish allowed through open circuit")
+	}
+	if ok, changed := c.allow(now.Add(time.Second)); !ok || !changed {
+		t.Error("trial not allowed after cooldown")
+	}
+	if state, _ := c.done(errors.New("down"), now); state != circuitOpen || c.backoff != 2*time.Second {
+		t.Errorf("got state %d, backoff %v", state, c.backoff)
+	}
+	if state, changed := c.done(nil, now); state != circuitClosed || !changed {
+		t.Errorf("got state %d", state)
+	}
+}
@@ -0,0 +1,263 @@
+package ssehandler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A single client attached to the handler.
+type client struct {
+	// Unique ID of the client.
+	id string
+
+	// ID of the user the client belongs to, if known. A user can have many
+	// clients.
+	user string
+
+	// Channel over which we can push messages to the client.
+	events chan message
+
+	// Most messages ever waiting in the client's buffer. Only touched by
+	// the event loop, or the client's shard worker while the loop waits.
+	highWater int
+
+	// Stream the client's events are written to. Writes must hold the lock.
+	w  stream
+	mu sync.Mutex
+
+	// Formats the events for the client's stream, if it doesn't use the
+	// handler's own formatter.
+	format Formatter
+
+	// Set once the client has been handed to the event loop for removal,
+	// from outside of it.
+	evicted atomic.Bool
+
+	// Set while the client is waiting for, or being written to by, a
+	// writer in the pool.
+	scheduled atomic.Bool
+
+	// Set when the client is removed, before its events channel is closed.
+	closing atomic.Bool
+
+	// Bytes written since the last flush, and the timer of the next flush
+	// if one is pending, with WithFlushInterval. Guarded by the lock.
+	unflushed  int
+	flushTimer *time.Timer
+
+	// Set once the client's request handler has returned and the response
+	// can no longer be written to. Guarded by the lock.
+	finished bool
+
+	// Channel closed by the writer pool, once it has seen the client is
+	// removed.
+	gone chan struct{}
+
+	// ID of the last event the client saw before it reconnected, as sent in
+	// the Last-Event-ID header. Empty for new clients.
+	lastEventID string
+
+	// Events loaded by WithBackfill, sent before any others, followed by the
+	// snapshots loaded by WithSnapshots.
+	backfill  []Event
+	snapshots []Event
+
+	// Events written to the client with the same ID before it reconnected,
+	// that it never acknowledged, see WithAcks.
+	unacked []Event
+
+	// Sequence number of the last snapshot or delta written to the client,
+	// for each topic given to WithSnapshots. Guarded by the lock.
+	seqs map[string]uint64
+
+	// Topics the client is subscribed to, namespaced by its tenant if it
+	// has one.
+	topics []string
+
+	// Tenant the client belongs to, with WithTenants.
+	tenant string
+
+	// Time the client connected.
+	connected time.Time
+
+	// IP address and user agent the client connected from.
+	ip        string
+	userAgent string
+
+	// Metadata about the client, as given by WithMetadata.
+	metadata map[string]interface{}
+
+	// Shard the client belongs to.
+	shard *shard
+
+	// Claims about the client's identity, if authorized.
+	claims map[string]interface{}
+
+	// Decides which events the client receives, if set.
+	filter func(Event) bool
+
+	// Decides which events the client is allowed to receive, if set.
+	permit func(Event) bool
+
+	// Decides which topics the client is allowed to receive, if set.
+	allowed func(topic string) bool
+}
+
+// Information about a connected client, as given to the lifecycle hooks.
+type ClientInfo struct {
+	// Unique ID of the client.
+	ID string
+
+	// ID of the user the client belongs to, if known.
+	UserID string
+
+	// Topics the client was subscribed to when it connected.
+	Topics []string
+
+	// Time the client connected.
+	Connected time.Time
+
+	// Claims about the client's identity, as given by the authorization
+	// hook.
+	Claims map[string]interface{}
+
+	// IP address and user agent the client connected from.
+	IP        string
+	UserAgent string
+
+	// Metadata about the client, as given by WithMetadata.
+	Metadata map[string]interface{}
+
+	// ID of the last event the client saw before it reconnected, as sent
+	// in its Last-Event-ID header. Empty for new clients.
+	LastEventID string
+
+	// Tenant the client belongs to, with WithTenants.
+	Tenant string
+}
+
+// Get the public information about the client.
+func (c *client) info() ClientInfo {
+	return ClientInfo{
+		ID:        c.id,
+		UserID:    c.user,
+		Topics:    append([]string(nil), c.topics...),
+		Connected: c.connected,
+		Claims:    c.claims,
+		IP:        c.ip,
+		UserAgent: c.userAgent,
+		Metadata:  c.metadata,
+
+		LastEventID: c.lastEventID,
+		Tenant:      c.tenant,
+	}
+}
+
+// Check if the client should receive the event.
+func (c *client) wants(msg Event) bool {
+	return c.follows(msg.Topic) && c.accepts(msg)
+}
+
+// Check if the client receives the events of the topic, by being subscribed
+// to it or a pattern matching it. All clients receive the events without one.
+func (c *client) follows(topic string) bool {
+	if topic == "" {
+		return true
+	}
+	for _, t := range c.topics {
+		if topicMatches(t, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if the client is allowed to receive the events of the topic. Reserved
+// topics must be allowed by the client's ACL, see isReserved.
+func (c *client) mayReceive(topic string) bool {
+	if c.allowed == nil {
+		return !isReserved(topic)
+	}
+	return c.allowed(topic)
+}
+
+// Get the topics the client is allowed to receive, out of the ones given.
+func (c *client) allowedTopics(topics []string) []string {
+	var allowed []string
+	for _, t := range topics {
+		if c.mayReceive(t) {
+			allowed = append(allowed, t)
+		}
+	}
+	return allowed
+}
+
+// Check if the client is subscribed to the topic.
+func (c *client) subscribed(topic string) bool {
+	for _, t := range c.topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if the client's filter accepts the event and it's allowed to receive
+// it.
+func (c *client) accepts(msg Event) bool {
+	if msg.Topic != "" && !c.mayReceive(msg.Topic) {
+		return false
+	}
+	if c.permit != nil && !c.permit(msg) {
+		return false
+	}
+	return c.filter == nil || c.filter(msg)
+}
+
+// Note the number of messages waiting in the client's buffer, after one was
+// pushed into it.
+func (c *client) measureQueue() {
+	if n := len(c.events); n > c.highWater {
+		c.highWater = n
+	}
+}
+
+// A message to be sent to a single client, or all clients of a single user.
+type directMessage struct {
+	clientID string
+	userID   string
+	event    Event
+
+	// Sent to all clients of this instance instead, see Drain.
+	local bool
+}
+
+// A request to disconnect a client, see Disconnect.
+type kick struct {
+	clientID string
+	reason   string
+	done     chan error
+}
+
+// Key of the client's ID, set in the gin context by Subscribe.
+const ClientIDKey = "ssehandler.client_id"
+
+// Create a random client ID.
+func randomClientID(*gin.Context) string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprint("Error while creating client ID: ", err))
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Get the ID of the client subscribed with c, set by Subscribe.
+func ClientID(c *gin.Context) string {
+	return c.GetString(ClientIDKey)
+}
@@ -0,0 +1,50 @@
+package ssehandler
+
+import "time"
+
+// Broadcast an event from the queue, unless it's held back for coalescing or
+// by its topic's throttle, or a batch published through a broker. Only called
+// by the event loop.
+func (b *SSEHandler) receive(msg Event) {
+	if batch, ok := unpackBatch(msg); ok {
+		b.broadcastBatch(batch)
+		return
+	}
+	if b.coalesceWindow <= 0 || msg.Key == "" {
+		b.pass(msg)
+		return
+	}
+	k := latestKey{topic: msg.Topic, key: msg.Key}
+	if old := b.coalescing[k]; old != nil {
+		// Replace the event already waiting, which is never sent
+		b.report(old.ID, BroadcastResult{})
+		b.coalescing[k] = &msg
+		return
+	}
+	b.coalescing[k] = &msg
+	time.AfterFunc(b.coalesceWindow, func() {
+		select {
+		case b.coalesced <- k:
+		case <-b.quit:
+		}
+	})
+}
+
+// Pass on the latest event of a topic and key, once its window has passed.
+// Only called by the event loop.
+func (b *SSEHandler) releaseKey(k latestKey) {
+	msg := b.coalescing[k]
+	if msg == nil {
+		return
+	}
+	delete(b.coalescing, k)
+	b.pass(*msg)
+}
+
+// Pass on all events held back for coalescing right away, when the handler is
+// closed. Only called by the event loop.
+func (b *SSEHandler) releaseCoalesced() {
+	for k := range b.coalescing {
+		b.releaseKey(k)
+	}
+}
@@ -0,0 +1,31 @@
+package ssehandler
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCoalesce(t *testing.T) {
+	b := NewSSEHandler(WithReplay(10), WithCoalesce(50*time.Millisecond))
+	b.HandleEvents()
+	b.Send(Event{ID: "1", Key: "x"})
+	b.Send(Event{ID: "2", Key: "y"})
+	b.Send(Event{ID: "3", Key: "x"})
+	b.Send(Event{ID: "4"})
+	b.Send(Event{ID: "5", Topic: "a", Key: "x"})
+	b.Sync(context.Background())
+	if got := history(t, b); got != "4" {
+		t.Fatalf("got %q within the window", got)
+	}
+	time.Sleep(150 * time.Millisecond)
+	b.Sync(context.Background())
+	// The keys are released in no particular order
+	got := []byte(history(t, b))
+	sort.Slice(got[1:], func(i, j int) bool { return got[1+i] < got[1+j] })
+	if string(got) != "4235" {
+		t.Fatalf("got %q after the window", got)
+	}
+	b.Close(context.Background())
+}
@@ -0,0 +1,95 @@
+package ssehandler
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A compressor of a response, flushed after each event so it still arrives
+// right away.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// A response writer compressing everything written to it.
+type compressWriter struct {
+	gin.ResponseWriter
+	zw compressor
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	return w.zw.Write(p)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.zw.Write([]byte(s))
+}
+
+// Flush the compressor and then the response.
+func (w *compressWriter) Flush() {
+	w.zw.Flush()
+	w.ResponseWriter.Flush()
+}
+
+// Pick the compression accepted by the client, preferring gzip, or an empty
+// string if it accepts neither.
+func negotiateEncoding(accept string) string {
+	var found string
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v <= 0 {
+				// Explicitly refused
+				continue
+			}
+		}
+		switch name {
+		case "gzip":
+			return "gzip"
+		case "deflate":
+			found = "deflate"
+		}
+	}
+	return found
+}
+
+// Wrap the client's response in a compressor, if the handler compresses the
+// client's connection and the client accepts it. The response must not have
+// been written to yet.
+func (b *SSEHandler) compress(c *gin.Context) gin.ResponseWriter {
+	w := c.Writer
+	if b.compressFor == nil || !b.compressFor(c) {
+		return w
+	}
+	var zw compressor
+	encoding := negotiateEncoding(c.Request.Header.Get("Accept-Encoding"))
+	switch encoding {
+	case "gzip":
+		zw, _ = gzip.NewWriterLevel(w, b.compressLevel)
+	case "deflate":
+		zw, _ = flate.NewWriter(w, b.compressLevel)
+	}
+	if zw == nil {
+		// Not accepted, or an invalid level
+		return w
+	}
+	w.Header().Set("Content-Encoding", encoding)
+	w.Header().Add("Vary", "Accept-Encoding")
+	w.Header().Del("Content-Length")
+	return &compressWriter{ResponseWriter: w, zw: zw}
+}
+
+// Write the end of the compressed stream, if the response is compressed.
+func closeCompressor(w gin.ResponseWriter) {
+	if cw, ok := w.(*compressWriter); ok {
+		cw.zw.Close()
+		cw.ResponseWriter.Flush()
+	}
+}
@@ -0,0 +1,99 @@
+package ssehandler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The cross-origin access to the subscribe endpoints, see WithCORS.
+type CORS struct {
+	// Origins allowed to subscribe, such as "https://example.com", or "*"
+	// for any origin.
+	Origins []string
+
+	// Allow browsers to send cookies along, for an EventSource created with
+	// withCredentials. Can't be used with the "*" origin, as any site could
+	// then read the streams of signed in users.
+	Credentials bool
+
+	// How long browsers may cache the response to a preflight request.
+	// Browsers fall back to 5 seconds if not set.
+	MaxAge time.Duration
+
+	// Request headers allowed on top of Last-Event-ID and Accept, such as
+	// Authorization for polyfills that can set headers.
+	Headers []string
+}
+
+// The CORS settings of the handler, see WithCORS.
+type cors struct {
+	any     bool
+	origins map[string]bool
+	creds   bool
+	maxAge  string
+	headers string
+}
+
+// Panics if credentials are allowed for any origin.
+func newCORS(c CORS) *cors {
+	o := &cors{
+		origins: make(map[string]bool, len(c.Origins)),
+		creds:   c.Credentials,
+		headers: strings.Join(append([]string{"Last-Event-ID", "Accept"}, c.Headers...), ", "),
+	}
+	for _, origin := range c.Origins {
+		if origin == "*" {
+			o.any = true
+		}
+		o.origins[origin] = true
+	}
+	if o.any && o.creds {
+		panic("ssehandler: CORS credentials can't be allowed for any origin")
+	}
+	if c.MaxAge > 0 {
+		o.maxAge = strconv.Itoa(int(c.MaxAge / time.Second))
+	}
+	return o
+}
+
+// Set the CORS headers for a cross-origin request, answering it directly if
+// it's a preflight or any other OPTIONS request. Returns false if the request
+// was answered or refused.
+func (b *SSEHandler) allowOrigin(c *gin.Context) bool {
+	origin := c.Request.Header.Get("Origin")
+	if origin == "" {
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return false
+		}
+		return true
+	}
+	h := c.Writer.Header()
+	h.Add("Vary", "Origin")
+	if !b.cors.any && !b.cors.origins[origin] {
+		b.reject(c, http.StatusForbidden, ErrOriginNotAllowed)
+		return false
+	}
+	if b.cors.any {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if b.cors.creds {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if c.Request.Method != http.MethodOptions {
+		return true
+	}
+	h.Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	h.Set("Access-Control-Allow-Headers", b.cors.headers)
+	if b.cors.maxAge != "" {
+		h.Set("Access-Control-Max-Age", b.cors.maxAge)
+	}
+	c.AbortWithStatus(http.StatusNoContent)
+	return false
+}
@@ -0,0 +1,81 @@
+package ssehandler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	b := NewSSEHandler(WithCORS(CORS{
+		Origins:     []string{"https://example.com"},
+		Credentials: true,
+		MaxAge:      time.Hour,
+	}))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	r := gin.New()
+	r.OPTIONS("/events", b.Handler())
+
+	tests := []struct {
+		origin string
+		status int
+		allow  string
+	}{
+		{"https://example.com", http.StatusNoContent, "https://example.com"},
+		{"https://evil.com", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodOptions, "/events", nil)
+		req.Header.Set("Origin", tt.origin)
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: got status %d", tt.origin, w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allow {
+			t.Errorf("%s: got allowed origin %q", tt.origin, got)
+		}
+		if tt.allow == "" {
+			continue
+		}
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("%s: got credentials %q", tt.origin, got)
+		}
+		if got := w.Header().Get("Access-Control-Max-Age"); got != "3600" {
+			t.Errorf("%s: got max age %q", tt.origin, got)
+		}
+	}
+}
+
+func TestCORSOptionsWithoutOrigin(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	b := NewSSEHandler(WithCORS(CORS{Origins: []string{"*"}}))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	r := gin.New()
+	r.OPTIONS("/events", b.Handler())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/events", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("got status %d", w.Code)
+	}
+	if got := b.ClientCount(); got != 0 {
+		t.Errorf("got %d clients", got)
+	}
+}
+
+func TestCORSCredentialsForAnyOrigin(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("didn't panic")
+		}
+	}()
+	NewSSEHandler(WithCORS(CORS{Origins: []string{"*"}, Credentials: true}))
+}
@@ -0,0 +1,83 @@
+package ssehandler
+
+import "context"
+
+// A DeadLetter is an event that couldn't be delivered, see WithDeadLetter.
+type DeadLetter struct {
+	// The event, as it was sent out.
+	Event Event
+
+	// Why it wasn't delivered: "expired" if it went stale before it could
+	// be written to a client, "dropped" if it was dropped for a slow client,
+	// "paused" if it was dropped while the handler was paused, or "publish"
+	// if it couldn't be published through the broker.
+	Reason string
+
+	// ID of the client it wasn't delivered to, if any.
+	Client string
+
+	// The error it failed with, if any.
+	Err error
+}
+
+// Get a dead letter sink for WithDeadLetter appending the events to store,
+// such as a RingStore for inspecting them later. Events dropped for many
+// clients are appended once for each.
+func DeadLetterStore(store EventStore) func(DeadLetter) error {
+	return func(d DeadLetter) error {
+		return store.Append(d.Event)
+	}
+}
+
+// Hand an undeliverable message, and any it joined, to the dead letter sink,
+// if set.
+func (b *SSEHandler) deadMessage(s *client, msg message, reason string) {
+	if b.deadLetter == nil {
+		return
+	}
+	if msg.batch == nil {
+		b.deadEvent(DeadLetter{Event: msg.event, Reason: reason, Client: s.id})
+		return
+	}
+	for _, m := range msg.batch {
+		b.deadEvent(DeadLetter{Event: m.event, Reason: reason, Client: s.id})
+	}
+}
+
+// Hand an undeliverable event to the dead letter sink, if set, without
+// waiting for it.
+func (b *SSEHandler) deadEvent(d DeadLetter) {
+	if b.deadLetter == nil {
+		return
+	}
+	b.callHook(func() {
+		if err := b.deadLetter(d); err != nil {
+			b.fail("deadletter", d.Client, err, "Error while handing over dead letter")
+		}
+	})
+}
+
+// Publish an event through the broker, handing it to the dead letter sink if
+// it fails, or each of its events if it carries a batch.
+func (b *SSEHandler) brokerPublish(ctx context.Context, e Event) error {
+	err := b.broker.Publish(ctx, e)
+	if err != nil {
+		b.deadPublish(e, err)
+	}
+	return err
+}
+
+// Hand an event that couldn't be published to the dead letter sink, or each
+// of its events if it carries a batch.
+func (b *SSEHandler) deadPublish(e Event, err error) {
+	if b.deadLetter == nil {
+		return
+	}
+	events, ok := unpackBatch(e)
+	if !ok {
+		events = []Event{e}
+	}
+	for _, e := range events {
+		b.deadEvent(DeadLetter{Event: e, Reason: "publish", Err: err})
+	}
+}
@@ -0,0 +1,70 @@
+package ssehandler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDeadLetter(t *testing.T) {
+	letters := make(chan DeadLetter, 2)
+	b := NewSSEHandler(WithSlowClientPolicy(DropNewest), WithDeadLetter(func(d DeadLetter) error {
+		letters <- d
+		return nil
+	}))
+	s := &client{id: "c", events: make(chan message, 1)}
+	b.offer(s, message{event: Event{ID: "1"}})
+	b.offer(s, message{event: Event{ID: "2"}})
+	b.write(s, message{event: Event{ID: "3", Expires: time.Now().Add(-time.Second)}})
+
+	got := map[string]string{}
+	for i := 0; i < 2; i++ {
+		select {
+		case d := <-letters:
+			got[d.Event.ID] = d.Reason
+		case <-time.After(time.Second):
+			t.Fatal("no dead letter")
+		}
+	}
+	if got["2"] != "dropped" || got["3"] != "expired" {
+		t.Errorf("got %v", got)
+	}
+}
+
+// A store that can't be appended to.
+type fullStore struct{ EventStore }
+
+func (fullStore) Append(Event) error { return errors.New("disk full") }
+
+func TestDeadLetterStoreError(t *testing.T) {
+	errs := make(chan error, 1)
+	b := NewSSEHandler(WithDeadLetter(DeadLetterStore(fullStore{})), WithOnError(func(err error) {
+		errs <- err
+	}))
+	b.deadEvent(DeadLetter{Event: Event{ID: "1"}, Reason: "dropped", Client: "c"})
+	select {
+	case err := <-errs:
+		if err.Error() != "deadletter for client c: disk full" {
+			t.Errorf("got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("error wasn't reported")
+	}
+}
+
+func TestHookOverflow(t *testing.T) {
+	release := make(chan struct{})
+	b := NewSSEHandler(WithOnError(func(error) {
+		<-release
+	}))
+	defer close(release)
+	for i := 0; i < hookQueueSize+10; i++ {
+		b.reportError(ErrBufferFull)
+	}
+	// The first call may or may not have been taken off the queue yet.
+	if got := testutil.ToFloat64(b.metrics.hookDrops); got < 9 || got > 10 {
+		t.Errorf("got %v dropped calls", got)
+	}
+}
@@ -0,0 +1,90 @@
+package ssehandler
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"runtime"
+	"time"
+)
+
+// Topic the debug stats are sent out on, see PublishDebug. It's reserved, so
+// clients only receive the stats when subscribed to it by name and allowed it
+// by WithTopicACL, such as with AllowTopics(DebugTopic).
+const DebugTopic = "__debug"
+
+// A snapshot of the Go runtime's and a handler's internals, see DebugStats.
+type DebugStats struct {
+	// Number of running goroutines.
+	Goroutines int `json:"goroutines"`
+
+	// Bytes and number of objects allocated on the heap.
+	HeapAlloc   uint64 `json:"heap_alloc"`
+	HeapObjects uint64 `json:"heap_objects"`
+
+	// Number of garbage collections, and their total pause time.
+	NumGC      uint32        `json:"num_gc"`
+	PauseTotal time.Duration `json:"pause_total_ns"`
+
+	// Number of connected clients, and the number of clients subscribed to
+	// each topic.
+	Clients int            `json:"clients"`
+	Topics  map[string]int `json:"topics"`
+
+	// Total number of events broadcast, and the number of events waiting
+	// for the event loop.
+	EventsSent uint64 `json:"events_sent"`
+	Queued     int    `json:"queued"`
+
+	// Counts of how often the slow client policy was triggered.
+	Dropped      uint64 `json:"dropped"`
+	Disconnected uint64 `json:"disconnected"`
+
+	// Time since the event loop was started.
+	Uptime time.Duration `json:"uptime_ns"`
+}
+
+// Get a snapshot of the Go runtime's and the handler's internals.
+func (b *SSEHandler) DebugStats() DebugStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats := b.Stats()
+	slow := b.SlowClientCounts()
+	return DebugStats{
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    mem.HeapAlloc,
+		HeapObjects:  mem.HeapObjects,
+		NumGC:        mem.NumGC,
+		PauseTotal:   time.Duration(mem.PauseTotalNs),
+		Clients:      stats.Clients,
+		Topics:       stats.Topics,
+		EventsSent:   stats.EventsSent,
+		Queued:       len(b.messages),
+		Dropped:      slow.Dropped,
+		Disconnected: slow.Disconnected,
+		Uptime:       stats.Uptime,
+	}
+}
+
+// Send out the debug stats every d, as JSON in "debug" events on DebugTopic,
+// until the handler is closed or the returned function is called. See Every.
+// The stats are only sent to the clients of this instance, and aren't kept in
+// history. Panics if d isn't positive.
+func (b *SSEHandler) PublishDebug(d time.Duration) (stop func()) {
+	return b.every(d, func(ctx context.Context) (Event, error) {
+		data, err := json.Marshal(b.DebugStats())
+		if err != nil {
+			return Event{}, err
+		}
+		return Event{Event: "debug", Topic: DebugTopic, Data: data}, nil
+	}, b.sendLocal)
+}
+
+// Export the debug stats as the expvar variable name, served by the
+// /debug/vars endpoint of expvar. Panics if the name is already in use, as
+// expvar.Publish does.
+func (b *SSEHandler) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return b.DebugStats()
+	}))
+}
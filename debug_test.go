@@ -0,0 +1,67 @@
+package ssehandler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPublishDebug(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	b := NewSSEHandler(WithReplay(10), WithTopicACL(func(c *gin.Context, info ClientInfo) func(string) bool {
+		return AllowTopics(DebugTopic)
+	}))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	r := gin.New()
+	r.GET("/events", b.Handler(DebugTopic))
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	for b.ClientCount() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	stop := b.PublishDebug(10 * time.Millisecond)
+	defer stop()
+	var event, data string
+	sc := bufio.NewScanner(resp.Body)
+	for data == "" && sc.Scan() {
+		if line := sc.Text(); strings.HasPrefix(line, "event: ") {
+			event = strings.TrimPrefix(line, "event: ")
+		} else if strings.HasPrefix(line, "data: ") {
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	var stats DebugStats
+	if err := json.Unmarshal([]byte(data), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if event != "debug" || stats.Goroutines < 1 || stats.Uptime <= 0 || stats.Clients != 1 {
+		t.Errorf("got %q: %+v", event, stats)
+	}
+	if events, _ := b.store.Range(""); len(events) > 0 {
+		t.Errorf("got history %+v", events)
+	}
+
+	b.PublishExpvar("ssehandler_test")
+	var exported DebugStats
+	if err := json.Unmarshal([]byte(expvar.Get("ssehandler_test").String()), &exported); err != nil {
+		t.Fatal(err)
+	}
+	if exported.HeapAlloc < 1 {
+		t.Errorf("got %+v", exported)
+	}
+}
@@ -0,0 +1,92 @@
+package ssehandler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How often Drain checks if the clients' buffers have been flushed.
+const drainInterval = 10 * time.Millisecond
+
+// Get the event sent out by Drain. By default it's a "server-closing" event,
+// telling clients to reconnect after the delay set by WithRetryAfter, both in
+// its retry field and as {"reconnect_after": seconds} in its data.
+func (b *SSEHandler) goodbye() Event {
+	if b.drainEvent != nil {
+		return *b.drainEvent
+	}
+	e := Event{Event: "server-closing", Data: []byte("{}")}
+	if b.retryAfter > 0 {
+		e.Retry = b.retryAfter
+		e.Data = []byte(fmt.Sprintf(`{"reconnect_after":%d}`, retryAfterSeconds(b.retryAfter)))
+	}
+	return e
+}
+
+// Drain the handler before closing it, for a graceful shutdown. New clients
+// are refused with 503 Service Unavailable from now on, and the connected
+// ones are sent the drain event, see WithDrainEvent, after all events queued
+// before it. The drain event only goes to the clients of this instance, and
+// isn't kept in history, so it isn't replayed to clients reconnecting
+// elsewhere. Once the clients' buffers have been flushed, or ctx is done, the
+// handler is closed as by Close.
+func (b *SSEHandler) Drain(ctx context.Context) error {
+	b.draining.Store(true)
+	if b.Sync(ctx) == nil {
+		b.sendLocal(ctx, b.goodbye())
+	}
+	t := time.NewTicker(drainInterval)
+	defer t.Stop()
+	for b.Sync(ctx) == nil && b.queued() > 0 {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+		}
+	}
+	return b.Close(ctx)
+}
+
+// Send an event to the clients of this instance only, without keeping it in
+// history or publishing it through the broker. See Drain.
+func (b *SSEHandler) sendLocal(ctx context.Context, e Event) error {
+	select {
+	case b.direct <- directMessage{event: e, local: true}:
+		return nil
+	case <-b.quit:
+		return ErrNotRunning
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Check if the handler is being drained, see Drain.
+func (b *SSEHandler) Draining() bool {
+	return b.draining.Load()
+}
+
+// Count the messages waiting in the clients' buffers.
+func (b *SSEHandler) queued() int {
+	n := 0
+	for _, c := range b.Clients() {
+		n += c.Queued
+	}
+	return n
+}
+
+// Refuse a new client while the handler is being drained, telling it to
+// retry later. Returns false if the client was refused.
+func (b *SSEHandler) admit(c *gin.Context) bool {
+	if !b.draining.Load() {
+		return true
+	}
+	if b.retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(b.retryAfter)))
+	}
+	b.reject(c, http.StatusServiceUnavailable, ErrDraining)
+	return false
+}
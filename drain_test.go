@@ -0,0 +1,81 @@
+package ssehandler
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGoodbye(t *testing.T) {
+	tests := []struct {
+		opts  []Option
+		event string
+		data  string
+		retry time.Duration
+	}{
+		{nil, "server-closing", `{"reconnect_after":10}`, 10 * time.Second},
+		{[]Option{WithRetryAfter(1500 * time.Millisecond)}, "server-closing", `{"reconnect_after":2}`, 1500 * time.Millisecond},
+		{[]Option{WithRetryAfter(0)}, "server-closing", `{}`, 0},
+		{[]Option{WithDrainEvent(Event{Event: "bye", Data: []byte("x")})}, "bye", "x", 0},
+	}
+	for _, tt := range tests {
+		e := NewSSEHandler(tt.opts...).goodbye()
+		if e.Event != tt.event || string(e.Data) != tt.data || e.Retry != tt.retry {
+			t.Errorf("got %+v", e)
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	store := NewRingStore(10)
+	b := NewSSEHandler(WithClientBuffer(10), WithEventStore(store))
+	b.HandleEvents()
+	r := gin.New()
+	r.GET("/events", b.Handler())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	for b.ClientCount() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	b.Send(Event{Data: []byte("last")})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := b.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		if line := sc.Text(); strings.HasPrefix(line, "event:") || strings.HasPrefix(line, "data:") {
+			got = append(got, line)
+		}
+	}
+	if strings.Join(got, "|") != `data: last|event: server-closing|data: {"reconnect_after":10}` {
+		t.Errorf("got %q", got)
+	}
+	if history, _ := store.Range(""); len(history) != 1 {
+		t.Errorf("got history %+v", history)
+	}
+
+	resp, err = http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "10" {
+		t.Errorf("got %d %v after draining", resp.StatusCode, resp.Header)
+	}
+}
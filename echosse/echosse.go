@@ -0,0 +1,42 @@
+// Echo adapter for the SSE handler, for mounting the same handler in services
+// routed by Echo.
+
+package echosse
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labstack/echo/v4"
+	ssehandler "github.com/lmas/gin-sse"
+)
+
+// Get an Echo handler that subscribes new clients to the topics, see
+// SSEHandler.Subscribe.
+func Handler(b *ssehandler.SSEHandler, topics ...string) echo.HandlerFunc {
+	return echo.WrapHandler(b.HTTPHandler(topics...))
+}
+
+// Key of the topic in the request's context, as passed on by TopicHandler.
+type topicKey struct{}
+
+// Get an Echo handler that subscribes new clients to the topic in the path
+// parameter, such as "topic" for routes like "/events/:topic".
+func TopicHandler(b *ssehandler.SSEHandler, param string) echo.HandlerFunc {
+	h := ssehandler.Adapt(func(c *gin.Context) {
+		topic, _ := c.Request.Context().Value(topicKey{}).(string)
+		b.Subscribe(c, topic)
+	})
+	return func(c echo.Context) error {
+		r := c.Request()
+		r = r.WithContext(context.WithValue(r.Context(), topicKey{}, c.Param(param)))
+		h.ServeHTTP(c.Response(), r)
+		return nil
+	}
+}
+
+// Get an Echo handler that broadcasts the events POSTed to it, see
+// SSEHandler.PublishHandler.
+func PublishHandler(b *ssehandler.SSEHandler, authorize func(c *gin.Context) error) echo.HandlerFunc {
+	return echo.WrapHandler(ssehandler.Adapt(b.PublishHandler(authorize)))
+}
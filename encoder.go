@@ -0,0 +1,47 @@
+package ssehandler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// An Encoder turns objects into the data of events, such as for SendJSON.
+// See WithEncoder.
+type Encoder interface {
+	Encode(v interface{}) ([]byte, error)
+}
+
+// An EncoderFunc is a function used as an Encoder, such as msgpack.Marshal.
+type EncoderFunc func(v interface{}) ([]byte, error)
+
+// Encode implements Encoder.
+func (f EncoderFunc) Encode(v interface{}) ([]byte, error) {
+	return f(v)
+}
+
+// Encodes objects as JSON. This is the default Encoder.
+var JSONEncoder Encoder = EncoderFunc(json.Marshal)
+
+// Wrap an encoder of binary data, such as for msgpack, protobuf or CBOR, so
+// that its output is base64-encoded. The data of events can't hold line
+// breaks, or anything but UTF-8.
+func Base64Encoder(e Encoder) Encoder {
+	return EncoderFunc(func(v interface{}) ([]byte, error) {
+		raw, err := e.Encode(v)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, base64.StdEncoding.EncodedLen(len(raw)))
+		base64.StdEncoding.Encode(data, raw)
+		return data, nil
+	})
+}
+
+// Encode an object for a topic, using the topic's encoder if set or else the
+// handler's.
+func (b *SSEHandler) encode(topic string, v interface{}) ([]byte, error) {
+	if e, found := b.topicEncoders[topic]; found {
+		return e.Encode(v)
+	}
+	return b.encoder.Encode(v)
+}
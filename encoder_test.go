@@ -0,0 +1,21 @@
+package ssehandler
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestEncoders(t *testing.T) {
+	raw := EncoderFunc(func(v interface{}) ([]byte, error) {
+		return []byte(v.(string)), nil
+	})
+	b := NewSSEHandler(WithTopicEncoder("bin", Base64Encoder(raw)))
+	data, err := b.encode("", map[string]int{"x": 1})
+	if err != nil || string(data) != `{"x":1}` {
+		t.Errorf("got %q, %v", data, err)
+	}
+	data, err = b.encode("bin", "a\nb")
+	if err != nil || string(data) != base64.StdEncoding.EncodeToString([]byte("a\nb")) {
+		t.Errorf("got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,96 @@
+package ssehandler
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A HandlerError is reported for a failure that the handler can't return to a
+// caller, such as a failed write to a client or a lost broker subscription.
+// See WithOnError.
+type HandlerError struct {
+	// What failed: "publish", "store", "id", "replay", "broker",
+	// "produce", "backfill", "snapshot", "inbox", "open", "write" or
+	// "deadletter".
+	Op string
+
+	// ID of the client it failed for, if any.
+	Client string
+
+	Err error
+}
+
+func (e *HandlerError) Error() string {
+	if e.Client != "" {
+		return fmt.Sprintf("%s for client %s: %v", e.Op, e.Client, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *HandlerError) Unwrap() error {
+	return e.Err
+}
+
+// Log a failure and report it to the error hook.
+func (b *SSEHandler) fail(op, client string, err error, msg string) {
+	if client != "" {
+		b.logger.Error(msg, "client", client, "err", err)
+	} else {
+		b.logger.Error(msg, "err", err)
+	}
+	b.reportError(&HandlerError{Op: op, Client: client, Err: err})
+}
+
+// Hand an error to the error hook, if set, without waiting for it.
+func (b *SSEHandler) reportError(err error) {
+	if b.onError != nil {
+		b.callHook(func() { b.onError(err) })
+	}
+}
+
+// Max number of calls waiting for the error and dead letter hooks, before
+// more are dropped.
+const hookQueueSize = 1024
+
+// Calls waiting for the error and dead letter hooks, made one at a time by a
+// single goroutine that's running while there are any.
+type hookQueue struct {
+	mu      sync.Mutex
+	calls   []func()
+	running bool
+}
+
+// Queue a call to a hook, without waiting for it. The call is dropped, and
+// counted in the metrics, if the hooks have fallen too far behind.
+func (b *SSEHandler) callHook(f func()) {
+	q := &b.hooks
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.calls) >= hookQueueSize {
+		b.metrics.hookDrops.Inc()
+		return
+	}
+	q.calls = append(q.calls, f)
+	if !q.running {
+		q.running = true
+		go b.runHooks()
+	}
+}
+
+// Make the queued hook calls in order, until there are none left.
+func (b *SSEHandler) runHooks() {
+	q := &b.hooks
+	for {
+		q.mu.Lock()
+		if len(q.calls) < 1 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		f := q.calls[0]
+		q.calls[0] = nil
+		q.calls = q.calls[1:]
+		q.mu.Unlock()
+		f()
+	}
+}
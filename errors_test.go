@@ -0,0 +1,39 @@
+package ssehandler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// A broker that can't be subscribed to.
+type downBroker struct{}
+
+func (downBroker) Publish(context.Context, Event) error { return nil }
+func (downBroker) Subscribe(context.Context) (<-chan Event, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestOnErrorBroker(t *testing.T) {
+	errs := make(chan error, 10)
+	b := NewSSEHandler(WithBroker(downBroker{}), WithOnError(func(err error) { errs <- err }))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	select {
+	case err := <-errs:
+		var he *HandlerError
+		if !errors.As(err, &he) || he.Op != "broker" || err.Error() != "broker: connection refused" {
+			t.Errorf("got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("error wasn't reported")
+	}
+}
+
+func TestHandlerError(t *testing.T) {
+	err := &HandlerError{Op: "write", Client: "abc", Err: ErrBufferFull}
+	if err.Error() != "write for client abc: message buffer full" || !errors.Is(err, ErrBufferFull) {
+		t.Errorf("got %v", err)
+	}
+}
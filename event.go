@@ -0,0 +1,148 @@
+package ssehandler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A single event to be broadcast out to clients.
+type Event struct {
+	// ID of the event, sent in the "id:" field. If left empty the handler
+	// assigns the next value of its internal, monotonically increasing
+	// counter, started from the current time in microseconds so that IDs
+	// aren't reused after a restart. With a broker, the counter is followed
+	// by a suffix unique to the instance. WithIDGenerator replaces the
+	// counter. Events sent to a single client are sent without an ID.
+	// Line breaks are removed.
+	ID string
+
+	// Name of the event, sent in the "event:" field. Left empty for plain
+	// messages, which are received by the client's onmessage handler.
+	// Line breaks are removed.
+	Event string
+
+	// Payload sent in the "data:" field.
+	Data []byte
+
+	// Topic the event is published to. Only clients subscribed to the topic
+	// receive the event, or all clients if left empty. Not sent to clients.
+	Topic string
+
+	// Reconnection time hint sent in the "retry:" field, if set.
+	Retry time.Duration
+
+	// Key of the event within its topic, such as the ID of the item it
+	// updates, for keeping only the latest event of each key. See
+	// WithLatest and CompactStore. Not sent to clients.
+	Key string
+
+	// Attributes carried along with the event, through any broker, such as
+	// the trace context added by WithTracing. Not sent to clients.
+	Attributes map[string]string
+
+	// Time after which the event is stale, if set. Stale events are dropped
+	// instead of being written to clients, such as after waiting in a slow
+	// client's buffer, and aren't replayed. Not sent to clients.
+	Expires time.Time
+
+	// Time the event stays fresh for once it's sent, setting Expires if
+	// it isn't set already. Not sent to clients.
+	TTL time.Duration
+
+	// Priority of the event, for clients falling behind. If left at
+	// PriorityNormal, the priority set for its topic by WithTopicPriority
+	// or by WithPriority is used. Not sent to clients.
+	Priority Priority
+
+	// Sequence number of the event within its topic, with
+	// WithSequenceNumbers or for the topics given to WithSnapshots. Given
+	// the topic's next number if left at zero. Sent to clients in the
+	// event's data.
+	Seq uint64
+}
+
+// An event along with its formatted bytes, as pushed to clients. Events are
+// formatted once, instead of once for each client.
+type message struct {
+	event Event
+	raw   []byte
+
+	// Context of the event's broadcast span, with WithTracing.
+	trace context.Context
+
+	// Priority of the event, as resolved when it was formatted.
+	priority Priority
+
+	// Messages joined into this one, with their bytes concatenated, for a
+	// client receiving more than one event of a batch. See SendBatch.
+	batch []message
+}
+
+// A Formatter turns an event into the raw bytes written to clients.
+type Formatter func(Event) []byte
+
+// Format an event using the standard SSE wire format. This is the default
+// Formatter.
+func FormatEvent(msg Event) []byte {
+	var buf bytes.Buffer
+	if id := stripLineBreaks(msg.ID); id != "" {
+		fmt.Fprintf(&buf, "id: %s\n", id)
+	}
+	if name := stripLineBreaks(msg.Event); name != "" {
+		fmt.Fprintf(&buf, "event: %s\n", name)
+	}
+	if msg.Retry > 0 {
+		fmt.Fprintf(&buf, "retry: %d\n", msg.Retry.Milliseconds())
+	}
+	// Each line of the payload must go in its own data field, or the line
+	// breaks would end the event early. The client joins them up again.
+	data := bytes.ReplaceAll(msg.Data, []byte("\r\n"), []byte("\n"))
+	data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteString("\n")
+	}
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+// Remove any line breaks from a single line field, which would otherwise end
+// the field early and let the rest be read as fields of its own.
+func stripLineBreaks(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// An event as formatted by FormatJSON.
+type jsonEvent struct {
+	ID    string `json:"id,omitempty"`
+	Event string `json:"event,omitempty"`
+	Data  string `json:"data"`
+	Retry int64  `json:"retry,omitempty"`
+}
+
+// Format an event as a single JSON object, with the fields "id", "event",
+// "data" (as a string) and "retry" (in milliseconds), leaving out any empty
+// ones but data. Used by the WebSocket transport.
+func FormatJSON(msg Event) []byte {
+	tmp, _ := json.Marshal(jsonEvent{
+		ID:    msg.ID,
+		Event: msg.Event,
+		Data:  string(msg.Data),
+		Retry: msg.Retry.Milliseconds(),
+	})
+	return tmp
+}
+
+// Content type of NDJSON streams.
+const ndjsonType = "application/x-ndjson"
+
+// Format an event as a single line of JSON, as made by FormatJSON. Used for
+// NDJSON streams, see WithNDJSON.
+func FormatNDJSON(msg Event) []byte {
+	return append(FormatJSON(msg), '\n')
+}
@@ -0,0 +1,68 @@
+package ssehandler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{"empty", Event{}, "data: \n\n"},
+		{"data", Event{Data: []byte("hello")}, "data: hello\n\n"},
+		{"all fields", Event{ID: "1", Event: "price", Retry: 1500 * time.Millisecond, Data: []byte("x")},
+			"id: 1\nevent: price\nretry: 1500\ndata: x\n\n"},
+		{"lf", Event{Data: []byte("a\nb")}, "data: a\ndata: b\n\n"},
+		{"crlf", Event{Data: []byte("a\r\nb")}, "data: a\ndata: b\n\n"},
+		{"cr", Event{Data: []byte("a\rb")}, "data: a\ndata: b\n\n"},
+		{"trailing newline", Event{Data: []byte("a\n")}, "data: a\ndata: \n\n"},
+		{"trailing crlf", Event{Data: []byte("a\r\n\r\n")}, "data: a\ndata: \ndata: \n\n"},
+		{"id line breaks", Event{ID: "1\r\nevent: x", Data: []byte("d")}, "id: 1event: x\ndata: d\n\n"},
+		{"name line breaks", Event{Event: "a\ndata: x", Data: []byte("d")}, "event: adata: x\ndata: d\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(FormatEvent(tt.event)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatNDJSON(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  string
+	}{
+		{Event{}, `{"data":""}` + "\n"},
+		{Event{Data: []byte("a\nb")}, `{"data":"a\nb"}` + "\n"},
+		{Event{ID: "1", Event: "price", Retry: time.Second, Data: []byte(`{"x":1}`)},
+			`{"id":"1","event":"price","data":"{\"x\":1}","retry":1000}` + "\n"},
+	}
+	for _, tt := range tests {
+		if got := string(FormatNDJSON(tt.event)); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestCommentBlock(t *testing.T) {
+	tests := []struct {
+		text string
+		n    int
+		want string
+	}{
+		{"", 0, ":\n\n"},
+		{"hi", 0, ": hi\n\n"},
+		{"a\nb", 2, ": ab  \n\n"},
+		{"", 3, ":   \n\n"},
+	}
+	for _, tt := range tests {
+		if got := string(commentBlock(tt.text, tt.n)); got != tt.want {
+			t.Errorf("commentBlock(%q, %d) = %q, want %q", tt.text, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// gRPC server for the SSE handler, for streaming events to backend consumers
+// with strong typing while browsers use SSE.
+
+package grpcsse
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	ssehandler "github.com/lmas/gin-sse"
+	"github.com/lmas/gin-sse/grpcsse/ssepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// A Server streams the events of a handler over gRPC, see ssepb.EventsServer.
+// Subscribers are handled like any other client of the handler, by the same
+// rate limits, authorization, topic ACL, filters and replay of missed events.
+// The hooks taking a gin context get one for a GET request made up from the
+// call, with its metadata as headers, so that for example WithAuthorize can
+// check the "authorization" metadata like the Authorization header.
+type Server struct {
+	ssepb.UnimplementedEventsServer
+
+	handler *ssehandler.SSEHandler
+	adapter http.Handler
+}
+
+// Make a new Server streaming the events of h. Register it with a gRPC server
+// using ssepb.RegisterEventsServer.
+func NewServer(h *ssehandler.SSEHandler) *Server {
+	s := &Server{handler: h}
+	s.adapter = ssehandler.Adapt(s.subscribe)
+	return s
+}
+
+// Key of the subscription in the made up request's context.
+type callKey struct{}
+
+// A single call of Subscribe.
+type call struct {
+	req    *ssepb.SubscribeRequest
+	stream ssepb.Events_SubscribeServer
+}
+
+// Subscribe to the handler's events, until the call's context is done or the
+// handler is closed. Refused subscriptions end with the gRPC status code
+// closest to the HTTP status they were refused with.
+func (s *Server) Subscribe(req *ssepb.SubscribeRequest, stream ssepb.Events_SubscribeServer) error {
+	ctx := stream.Context()
+	r, err := http.NewRequestWithContext(context.WithValue(ctx, callKey{}, call{req, stream}), http.MethodGet, "/", nil)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, values := range md {
+		if strings.HasPrefix(k, ":") {
+			continue
+		}
+		for _, v := range values {
+			r.Header.Add(k, v)
+		}
+	}
+	if req.GetLastEventId() != "" {
+		r.Header.Set("Last-Event-ID", req.GetLastEventId())
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.RemoteAddr = p.Addr.String()
+		if _, _, err := net.SplitHostPort(r.RemoteAddr); err != nil {
+			r.RemoteAddr += ":0"
+		}
+	}
+
+	w := &responseRecorder{header: make(http.Header), status: http.StatusOK}
+	s.adapter.ServeHTTP(w, r)
+	if w.status >= 400 {
+		return status.Error(codeOf(w.status), http.StatusText(w.status))
+	}
+	return ctx.Err()
+}
+
+// Subscribe the client of a call. Called through the adapter, with the call in
+// the request's context.
+func (s *Server) subscribe(c *gin.Context) {
+	cl := c.Request.Context().Value(callKey{}).(call)
+	var filter func(ssehandler.Event) bool
+	if names := cl.req.GetEvents(); len(names) > 0 {
+		filter = func(e ssehandler.Event) bool {
+			for _, n := range names {
+				if e.Event == n {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	s.handler.SubscribeStream(c, &stream{cl.stream}, filter, cl.req.GetTopics()...)
+}
+
+// Sends a subscriber's events over its call.
+type stream struct {
+	s ssepb.Events_SubscribeServer
+}
+
+func (s *stream) Send(e ssehandler.Event) error {
+	return s.s.Send(&ssepb.Event{
+		Id:    e.ID,
+		Event: e.Event,
+		Topic: e.Topic,
+		Data:  e.Data,
+		Key:   e.Key,
+	})
+}
+
+func (s *stream) Done() <-chan struct{} {
+	return s.s.Context().Done()
+}
+
+// Records the status a subscription was refused with. Nothing else is written
+// to it.
+type responseRecorder struct {
+	header http.Header
+	status int
+}
+
+func (w *responseRecorder) Header() http.Header         { return w.header }
+func (w *responseRecorder) Write(p []byte) (int, error) { return len(p), nil }
+func (w *responseRecorder) WriteHeader(status int)      { w.status = status }
+func (w *responseRecorder) Flush()                      {}
+
+// Get the gRPC status code closest to an HTTP status code.
+func codeOf(status int) codes.Code {
+	switch status {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
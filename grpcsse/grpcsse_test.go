@@ -0,0 +1,27 @@
+package grpcsse
+
+import (
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		status int
+		code   codes.Code
+	}{
+		{http.StatusBadRequest, codes.InvalidArgument},
+		{http.StatusUnauthorized, codes.Unauthenticated},
+		{http.StatusForbidden, codes.PermissionDenied},
+		{http.StatusTooManyRequests, codes.ResourceExhausted},
+		{http.StatusServiceUnavailable, codes.Unavailable},
+		{http.StatusInternalServerError, codes.Unknown},
+	}
+	for _, tt := range tests {
+		if got := codeOf(tt.status); got != tt.code {
+			t.Errorf("codeOf(%d) = %v, want %v", tt.status, got, tt.code)
+		}
+	}
+}
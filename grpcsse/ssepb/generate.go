@@ -0,0 +1,4 @@
+// Package ssepb holds the protobuf messages and gRPC service of grpcsse.
+package ssepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative events.proto
@@ -0,0 +1,70 @@
+package ssehandler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The health of a handler, see Health.
+type Health struct {
+	// Whether the handler can serve clients: its event loop is running and
+	// isn't being drained, it's subscribed to any broker and it's below any
+	// max number of clients.
+	Healthy bool `json:"healthy"`
+
+	// Whether the event loop is running.
+	Running bool `json:"running"`
+
+	// Whether the handler is being drained, see Drain.
+	Draining bool `json:"draining"`
+
+	// Whether the handler is subscribed to its broker, always true without
+	// one. See BrokerConnected.
+	BrokerConnected bool `json:"broker_connected"`
+
+	// Number of connected clients, and the max set by WithMaxClients, or
+	// zero if there's no limit.
+	Clients    int `json:"clients"`
+	MaxClients int `json:"max_clients"`
+
+	// When the last event was broadcast, if any, and the seconds since.
+	LastBroadcast    *time.Time `json:"last_broadcast,omitempty"`
+	LastBroadcastAge float64    `json:"last_broadcast_age_seconds,omitempty"`
+}
+
+// Check the health of the handler. Doesn't go through the event loop.
+func (b *SSEHandler) Health() Health {
+	h := Health{
+		Running:         b.running.Load(),
+		Draining:        b.Draining(),
+		BrokerConnected: b.BrokerConnected(),
+		Clients:         b.ClientCount(),
+		MaxClients:      b.settings().maxClients,
+	}
+	if last := b.lastBroadcast.Load(); last > 0 {
+		t := time.Unix(0, last)
+		h.LastBroadcast = &t
+		h.LastBroadcastAge = time.Since(t).Seconds()
+	}
+	h.Healthy = h.Running && !h.Draining && h.BrokerConnected &&
+		(h.MaxClients < 1 || b.connections.Load() < int64(h.MaxClients))
+	return h
+}
+
+// Get a gin handler reporting the health of the handler as JSON, see Health,
+// for readiness probes. Responds with 503 Service Unavailable while the
+// handler isn't healthy, including while it's full or being drained, so it's
+// not meant for liveness probes: a full instance would be restarted instead
+// of just getting no new clients.
+func (b *SSEHandler) HealthHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h := b.Health()
+		status := http.StatusOK
+		if !h.Healthy {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, h)
+	}
+}
@@ -0,0 +1,44 @@
+package ssehandler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHealthHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	b := NewSSEHandler(WithMaxClients(1))
+	r := gin.New()
+	r.GET("/healthz", b.HealthHandler())
+	probe := func() int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return w.Code
+	}
+
+	if got := probe(); got != http.StatusServiceUnavailable {
+		t.Errorf("got %d before the event loop was started", got)
+	}
+	b.HandleEvents()
+	if got := probe(); got != http.StatusOK {
+		t.Errorf("got %d while running", got)
+	}
+	b.Send(Event{})
+	b.Sync(context.Background())
+	if h := b.Health(); h.LastBroadcast == nil {
+		t.Errorf("got %+v after a broadcast", h)
+	}
+	b.connections.Add(1)
+	if got := probe(); got != http.StatusServiceUnavailable {
+		t.Errorf("got %d at the max number of clients", got)
+	}
+	b.connections.Add(-1)
+	b.Close(context.Background())
+	if got := probe(); got != http.StatusServiceUnavailable {
+		t.Errorf("got %d after closing", got)
+	}
+}
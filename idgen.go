@@ -0,0 +1,60 @@
+package ssehandler
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// An IDGenerator gives the events sent out without an ID their IDs, instead
+// of the handler's own counter, such as ULIDs or the next value of a database
+// sequence. See WithIDGenerator. The IDs should be unique, across all instances
+// sharing a broker, and follow the order the events are sent in, as clients
+// resume from the last ID they saw.
+type IDGenerator interface {
+	NextID(ctx context.Context) (string, error)
+}
+
+// An IDGeneratorFunc is a function used as an IDGenerator.
+type IDGeneratorFunc func(ctx context.Context) (string, error)
+
+// NextID implements IDGenerator.
+func (f IDGeneratorFunc) NextID(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// Give an event its ID, unless it has one. The handler's counter is used if
+// no IDGenerator is set, or if it fails.
+func (b *SSEHandler) assignID(ctx context.Context, e Event) Event {
+	if e.ID != "" {
+		return e
+	}
+	if b.idGenerator != nil {
+		id, err := b.idGenerator.NextID(ctx)
+		if err == nil {
+			e.ID = id
+			return e
+		}
+		b.fail("id", "", err, "Error while generating event ID")
+	}
+	e.ID = b.nextID()
+	return e
+}
+
+// Get the next value of the handler's counter, as an ID.
+func (b *SSEHandler) nextID() string {
+	for {
+		last := b.lastID.Load()
+		next := uint64(time.Now().UnixMicro())
+		if next <= last {
+			next = last + 1
+		}
+		if b.lastID.CompareAndSwap(last, next) {
+			id := strconv.FormatUint(next, 10)
+			if b.broker != nil {
+				id += "-" + b.nodeID
+			}
+			return id
+		}
+	}
+}
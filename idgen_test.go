@@ -0,0 +1,30 @@
+package ssehandler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestIDGenerator(t *testing.T) {
+	n := 0
+	b := NewSSEHandler(WithIDGenerator(IDGeneratorFunc(func(ctx context.Context) (string, error) {
+		n++
+		if n > 1 {
+			return "", errors.New("sequence unavailable")
+		}
+		return "seq-" + strconv.Itoa(n), nil
+	})))
+	if e := b.assignID(context.Background(), Event{}); e.ID != "seq-1" {
+		t.Errorf("got ID %q", e.ID)
+	}
+	if e := b.assignID(context.Background(), Event{ID: "given"}); e.ID != "given" {
+		t.Errorf("got ID %q", e.ID)
+	}
+	// The counter is used instead when the generator fails
+	if e := b.assignID(context.Background(), Event{}); strings.HasPrefix(e.ID, "seq-") || e.ID == "" {
+		t.Errorf("got ID %q", e.ID)
+	}
+}
@@ -0,0 +1,128 @@
+package ssehandler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// An Inbox keeps the events sent to users with SendToUser while they have no
+// clients connected, until one connects again. See WithInbox and MemoryInbox.
+// Its calls are made by the event loop, which waits for them.
+type Inbox interface {
+	// Keep an event for a user.
+	Put(ctx context.Context, userID string, e Event) error
+
+	// Remove and return the events kept for a user, oldest first.
+	Take(ctx context.Context, userID string) ([]Event, error)
+}
+
+// A MemoryInbox is an Inbox keeping events in memory, which are lost on a
+// restart.
+type MemoryInbox struct {
+	mu     sync.Mutex
+	limit  int
+	maxAge time.Duration
+	users  map[string][]inboxEntry
+
+	// Time the inbox was last swept of expired events.
+	swept time.Time
+}
+
+type inboxEntry struct {
+	event Event
+	added time.Time
+}
+
+// Make a new MemoryInbox keeping up to limit events for each user, dropping
+// the oldest ones, and dropping events older than maxAge. Either is unlimited
+// if 0 or less.
+func NewMemoryInbox(limit int, maxAge time.Duration) *MemoryInbox {
+	return &MemoryInbox{
+		limit:  limit,
+		maxAge: maxAge,
+		users:  make(map[string][]inboxEntry),
+	}
+}
+
+// Keep an event for a user, dropping the oldest one if the user's inbox is
+// full.
+func (m *MemoryInbox) Put(ctx context.Context, userID string, e Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.sweep(now)
+	entries := append(m.fresh(m.users[userID], now), inboxEntry{e, now})
+	if m.limit > 0 && len(entries) > m.limit {
+		entries = entries[len(entries)-m.limit:]
+	}
+	m.users[userID] = entries
+	return nil
+}
+
+// Remove and return the events kept for a user, oldest first.
+func (m *MemoryInbox) Take(ctx context.Context, userID string) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := m.fresh(m.users[userID], time.Now())
+	delete(m.users, userID)
+	events := make([]Event, len(entries))
+	for i, entry := range entries {
+		events[i] = entry.event
+	}
+	return events, nil
+}
+
+// Drop the expired events of all users, at most once per max age, so that the
+// events of users who never return aren't kept forever. Must be locked.
+func (m *MemoryInbox) sweep(now time.Time) {
+	if m.maxAge <= 0 || now.Sub(m.swept) < m.maxAge {
+		return
+	}
+	m.swept = now
+	for user, entries := range m.users {
+		if entries = m.fresh(entries, now); len(entries) > 0 {
+			m.users[user] = entries
+		} else {
+			delete(m.users, user)
+		}
+	}
+}
+
+// Get the entries younger than the max age. Must be locked.
+func (m *MemoryInbox) fresh(entries []inboxEntry, now time.Time) []inboxEntry {
+	if m.maxAge <= 0 {
+		return entries
+	}
+	for i, entry := range entries {
+		if now.Sub(entry.added) <= m.maxAge {
+			return entries[i:]
+		}
+	}
+	return nil
+}
+
+// Keep an event sent to a user without any clients in the inbox, if set.
+// Only called by the event loop.
+func (b *SSEHandler) keepForUser(userID string, e Event) {
+	if b.inbox == nil {
+		return
+	}
+	if err := b.inbox.Put(b.ctx, userID, e); err != nil {
+		b.fail("inbox", "", err, "Error while keeping event for user")
+	}
+}
+
+// Get the events kept for the user of a new client, if it's the user's first.
+// Only called by the event loop.
+func (b *SSEHandler) userInbox(s *client) []Event {
+	if b.inbox == nil || s.user == "" || len(b.users[s.user]) > 1 {
+		return nil
+	}
+	events, err := b.inbox.Take(b.ctx, s.user)
+	if err != nil {
+		b.fail("inbox", s.id, err, "Error while loading events kept for user")
+		return nil
+	}
+	return events
+}
@@ -0,0 +1,50 @@
+package ssehandler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryInbox(t *testing.T) {
+	i := NewMemoryInbox(2, 0)
+	for _, id := range []string{"1", "2", "3"} {
+		i.Put(context.Background(), "u", Event{ID: id})
+	}
+	events, _ := i.Take(context.Background(), "u")
+	if got := joinIDs(events); got != "23" {
+		t.Errorf("got %q", got)
+	}
+	if events, _ = i.Take(context.Background(), "u"); len(events) > 0 {
+		t.Errorf("events kept after being taken: %+v", events)
+	}
+}
+
+func TestMemoryInboxSweep(t *testing.T) {
+	i := NewMemoryInbox(0, time.Minute)
+	i.Put(context.Background(), "gone", Event{ID: "1"})
+	i.users["gone"][0].added = time.Now().Add(-time.Hour)
+	i.swept = time.Now().Add(-time.Hour)
+	i.Put(context.Background(), "u", Event{ID: "2"})
+	if _, ok := i.users["gone"]; ok {
+		t.Error("expired events kept for user who never returned")
+	}
+	if events, _ := i.Take(context.Background(), "u"); joinIDs(events) != "2" {
+		t.Errorf("got %+v", events)
+	}
+}
+
+func TestInbox(t *testing.T) {
+	b := NewSSEHandler(WithInbox(NewMemoryInbox(0, 0)))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	b.SendToUser("u", Event{ID: "1"})
+	b.SendToUser("other", Event{ID: "2"})
+	b.Sync(context.Background())
+
+	s := &client{user: "u"}
+	b.users["u"] = map[*client]bool{s: true}
+	if got := joinIDs(b.missedEvents(s)); got != "1" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,84 @@
+package ssehandler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The JSON body of an event POSTed to a PublishHandler.
+type publishRequest struct {
+	ID    string `json:"id"`
+	Topic string `json:"topic"`
+	Event string `json:"event"`
+	Key   string `json:"key"`
+	// Either a string, sent as is, or any other JSON value, sent as JSON.
+	Data json.RawMessage `json:"data"`
+	// Reconnection time hint in milliseconds.
+	Retry int64 `json:"retry"`
+}
+
+// Turn the request into an event.
+func (r publishRequest) event() (Event, error) {
+	e := Event{
+		ID:    r.ID,
+		Topic: r.Topic,
+		Event: r.Event,
+		Key:   r.Key,
+		Retry: time.Duration(r.Retry) * time.Millisecond,
+	}
+	if len(r.Data) > 0 && r.Data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(r.Data, &s); err != nil {
+			return e, err
+		}
+		e.Data = []byte(s)
+	} else if string(r.Data) != "null" {
+		e.Data = r.Data
+	}
+	return e, nil
+}
+
+// Get a gin handler that broadcasts the events POSTed to it, so that other,
+// non-Go services can send events over HTTP. The body is a JSON object with
+// the optional fields "id", "topic", "event", "key", "data" and "retry" (in
+// milliseconds). If data is a string it's sent as is, or otherwise as JSON.
+// Requests are refused with 403 Forbidden if authorize returns an error, and
+// 202 Accepted is returned once the event has been queued. While the clients
+// can't keep up, see WithBackpressure, 429 Too Many Requests is returned, and
+// 503 Service Unavailable if the handler isn't running or the event was only
+// sent out to this instance's clients, see WithCircuitBreaker. Panics if
+// authorize is nil, so the handler can't be left open by mistake.
+func (b *SSEHandler) PublishHandler(authorize func(c *gin.Context) error) gin.HandlerFunc {
+	if authorize == nil {
+		panic("ssehandler: publish handler requires an authorizer")
+	}
+	return func(c *gin.Context) {
+		if err := authorize(c); err != nil {
+			c.AbortWithError(http.StatusForbidden, err)
+			return
+		}
+		var req publishRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		e, err := req.event()
+		if err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		switch err := b.SendContext(c.Request.Context(), e); err {
+		case nil:
+			c.Status(http.StatusAccepted)
+		case ErrNotRunning, ErrCircuitOpen:
+			c.AbortWithError(http.StatusServiceUnavailable, err)
+		case ErrBackpressure:
+			c.AbortWithError(http.StatusTooManyRequests, err)
+		default:
+			c.AbortWithError(http.StatusInternalServerError, err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package ssehandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPublishRequestEvent(t *testing.T) {
+	tests := []struct {
+		body string
+		want Event
+	}{
+		{`{}`, Event{}},
+		{`{"data": null}`, Event{}},
+		{`{"data": "a\nb"}`, Event{Data: []byte("a\nb")}},
+		{`{"data": {"x": 1}}`, Event{Data: []byte(`{"x": 1}`)}},
+		{`{"id": "1", "topic": "t", "event": "e", "data": 2, "retry": 1500}`,
+			Event{ID: "1", Topic: "t", Event: "e", Data: []byte("2"), Retry: 1500 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		var req publishRequest
+		if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+			t.Fatal(err)
+		}
+		got, err := req.event()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != tt.want.ID || got.Topic != tt.want.Topic || got.Event != tt.want.Event ||
+			string(got.Data) != string(tt.want.Data) || got.Retry != tt.want.Retry {
+			t.Errorf("%s: got %+v, want %+v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestPublishHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	tests := []struct {
+		name  string
+		token string
+		body  string
+		setup func(b *SSEHandler)
+		want  int
+	}{
+		{"accepted", "secret", `{"data": "x"}`, func(b *SSEHandler) { b.HandleEvents() }, http.StatusAccepted},
+		{"forbidden", "wrong", `{"data": "x"}`, func(b *SSEHandler) { b.HandleEvents() }, http.StatusForbidden},
+		{"bad body", "secret", `{`, func(b *SSEHandler) { b.HandleEvents() }, http.StatusBadRequest},
+		{"not running", "secret", `{"data": "x"}`, func(b *SSEHandler) {}, http.StatusServiceUnavailable},
+		{"backpressure", "secret", `{"data": "x"}`, func(b *SSEHandler) {
+			b.running.Store(true)
+			b.pressured.Store(true)
+		}, http.StatusTooManyRequests},
+		{"circuit open", "secret", `{"data": "x"}`, func(b *SSEHandler) {
+			WithBroker(&failingBroker{})(b)
+			WithCircuitBreaker(1, time.Hour)(b)
+			b.circuit.done(errors.New("down"), time.Now())
+			b.HandleEvents()
+		}, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewSSEHandler()
+			tt.setup(b)
+			defer b.Close(context.Background())
+			r := gin.New()
+			r.POST("/publish", b.PublishHandler(func(c *gin.Context) error {
+				if c.GetHeader("Authorization") != "secret" {
+					return errors.New("bad token")
+				}
+				return nil
+			}))
+			req := httptest.NewRequest("POST", "/publish", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", tt.token)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("got %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublishHandlerWithoutAuthorize(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic without authorize")
+		}
+	}()
+	NewSSEHandler().PublishHandler(nil)
+}
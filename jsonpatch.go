@@ -0,0 +1,169 @@
+package ssehandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The last state sent out on a topic in JSON Patch mode, see WithJSONPatch.
+type patchState struct {
+	// The document, as decoded and as sent.
+	doc interface{}
+	raw []byte
+
+	// ID of the event that last changed it.
+	id string
+
+	// Number of patches sent since the last snapshot.
+	patches int
+}
+
+// Turn an event with the full state of a topic in JSON Patch mode into a
+// "patch" event, with the RFC 6902 JSON Patch from the last state sent out,
+// or into a "snapshot" event with the full state. Snapshots are sent for the
+// first state, every snapshotEvery patches, or when the patch would be larger
+// than the state. Events without a JSON document are sent as they are,
+// dropping the last state. Only called by the event loop.
+func (b *SSEHandler) patch(e Event) Event {
+	if !b.patchTopics[e.Topic] {
+		return e
+	}
+	doc, err := decodeJSON(e.Data)
+	if err != nil {
+		delete(b.patchStates, e.Topic)
+		return e
+	}
+	st := b.patchStates[e.Topic]
+	next := &patchState{doc: doc, raw: e.Data, id: e.ID}
+	b.patchStates[e.Topic] = next
+	if st != nil && (b.snapshotEvery < 1 || st.patches < b.snapshotEvery) {
+		ops := diffJSON("", st.doc, doc)
+		if data, err := json.Marshal(ops); err == nil && len(data) < len(e.Data) {
+			next.patches = st.patches + 1
+			e.Event = "patch"
+			e.Data = data
+			return e
+		}
+	}
+	e.Event = "snapshot"
+	return e
+}
+
+// Get the events a new client should be sent first, without replaying the
+// patches of topics in JSON Patch mode: a snapshot of each topic's last state
+// is sent instead, after the other events. Only called by the event loop.
+func (b *SSEHandler) withSnapshots(s *client, events []Event) []Event {
+	if len(b.patchTopics) < 1 {
+		return events
+	}
+	kept := events[:0]
+	for _, e := range events {
+		if !b.patchTopics[e.Topic] {
+			kept = append(kept, e)
+		}
+	}
+	topics := make([]string, 0, len(b.patchStates))
+	for t := range b.patchStates {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	for _, t := range topics {
+		st := b.patchStates[t]
+		e := Event{ID: st.id, Event: "snapshot", Topic: t, Data: st.raw}
+		if s.wants(e) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// A single JSON Patch operation.
+type patchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Decode a JSON document, keeping its numbers as they are.
+func decodeJSON(data []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var doc interface{}
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Get the operations turning the document a into b, at path. Objects are
+// compared key by key, while arrays of different lengths are replaced.
+func diffJSON(path string, a, b interface{}) []patchOp {
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	switch a := a.(type) {
+	case map[string]interface{}:
+		if b, ok := b.(map[string]interface{}); ok {
+			return diffObjects(path, a, b)
+		}
+	case []interface{}:
+		if b, ok := b.([]interface{}); ok && len(a) == len(b) {
+			var ops []patchOp
+			for i := range a {
+				ops = append(ops, diffJSON(path+"/"+strconv.Itoa(i), a[i], b[i])...)
+			}
+			return ops
+		}
+	}
+	return []patchOp{{Op: "replace", Path: path, Value: nullable(b)}}
+}
+
+func diffObjects(path string, a, b map[string]interface{}) []patchOp {
+	var ops []patchOp
+	for _, k := range sortedKeys(a) {
+		if _, found := b[k]; !found {
+			ops = append(ops, patchOp{Op: "remove", Path: path + "/" + escapePointer(k)})
+		}
+	}
+	for _, k := range sortedKeys(b) {
+		p := path + "/" + escapePointer(k)
+		if old, found := a[k]; found {
+			ops = append(ops, diffJSON(p, old, b[k])...)
+		} else {
+			ops = append(ops, patchOp{Op: "add", Path: p, Value: nullable(b[k])})
+		}
+	}
+	return ops
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Escape a key for a JSON Pointer, as in RFC 6901.
+func escapePointer(k string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(k)
+}
+
+// A JSON null, which omitempty would otherwise leave out of an operation.
+type jsonNull struct{}
+
+func (jsonNull) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+func nullable(v interface{}) interface{} {
+	if v == nil {
+		return jsonNull{}
+	}
+	return v
+}
@@ -0,0 +1,44 @@
+package ssehandler
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestDiffJSON(t *testing.T) {
+	a, _ := decodeJSON([]byte(`{"a":1,"b":[1,2],"c":{"d":"x"},"e/f":true,"g":[1]}`))
+	b, _ := decodeJSON([]byte(`{"a":1,"b":[1,3],"c":{"d":null},"h":2,"g":[1,2]}`))
+	data, _ := json.Marshal(diffJSON("", a, b))
+	want := `[{"op":"remove","path":"/e~1f"},{"op":"replace","path":"/b/1","value":3},` +
+		`{"op":"replace","path":"/c/d","value":null},{"op":"replace","path":"/g","value":[1,2]},` +
+		`{"op":"add","path":"/h","value":2}]`
+	if string(data) != want {
+		t.Errorf("got %s", data)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	b := NewSSEHandler(WithJSONPatch(2, "doc"))
+	state := `{"name":"a name long enough for the patch to be smaller","count":%d}`
+	var names string
+	for i := 0; i < 5; i++ {
+		e := b.patch(Event{ID: "1", Topic: "doc", Data: []byte(fmt.Sprintf(state, i))})
+		names += e.Event[:1]
+		if e.Event == "patch" && string(e.Data) != fmt.Sprintf(`[{"op":"replace","path":"/count","value":%d}]`, i) {
+			t.Errorf("got patch %s", e.Data)
+		}
+	}
+	if names != "sppsp" {
+		t.Errorf("got events %q", names)
+	}
+	if e := b.patch(Event{Topic: "other", Data: []byte("{}")}); e.Event != "" {
+		t.Errorf("patched event on other topic: %q", e.Event)
+	}
+
+	s := &client{topics: []string{"doc"}}
+	missed := b.withSnapshots(s, []Event{{ID: "0", Topic: "doc"}})
+	if len(missed) != 1 || missed[0].Event != "snapshot" || string(missed[0].Data) != fmt.Sprintf(state, 4) {
+		t.Errorf("got %+v", missed)
+	}
+}
@@ -0,0 +1,199 @@
+// Kafka source for the SSE handler, for tailing Kafka topics from browsers.
+
+package kafkasource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	ssehandler "github.com/lmas/gin-sse"
+	"github.com/segmentio/kafka-go"
+)
+
+// Bounds of the delay before retrying, after failing to fetch or send out a
+// record.
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// A Source consumes the records of Kafka topics and sends them out as events,
+// to the clients subscribed to the records' Kafka topics by default.
+type Source struct {
+	reader  *kafka.Reader
+	handler *ssehandler.SSEHandler
+	topic   func(kafka.Message) string
+	event   func(kafka.Message) string
+	logger  ssehandler.Logger
+
+	// Called for the records skipped as their events were refused.
+	deadLetter func(kafka.Message, error)
+}
+
+// An Option configures a Source, see New.
+type Option func(*Source)
+
+// Use f for getting the topic of the event sent out for each record, instead
+// of the record's Kafka topic. Records for which f returns an empty topic are
+// sent to all clients.
+func WithTopic(f func(kafka.Message) string) Option {
+	return func(s *Source) {
+		s.topic = f
+	}
+}
+
+// Use f for getting the name of the event sent out for each record. Events
+// are sent without a name by default.
+func WithEventName(f func(kafka.Message) string) Option {
+	return func(s *Source) {
+		s.event = f
+	}
+}
+
+// Log errors while consuming records to l. Nothing is logged by default.
+func WithLogger(l ssehandler.Logger) Option {
+	return func(s *Source) {
+		s.logger = l
+	}
+}
+
+// Call f for each record skipped as its event was refused by the handler, such
+// as by a middleware, with the error it was refused with. Skipped records are
+// only logged by default.
+func WithDeadLetter(f func(m kafka.Message, err error)) Option {
+	return func(s *Source) {
+		s.deadLetter = f
+	}
+}
+
+// Make a new Source consuming the records read by r and sending them out with
+// h. The reader takes care of reconnecting to the brokers. If the reader is
+// part of a consumer group, the offset of each record is committed once its
+// event has been sent out, so consuming resumes from there after a restart.
+// Records can then be sent out more than once, but aren't skipped.
+func New(r *kafka.Reader, h *ssehandler.SSEHandler, opts ...Option) *Source {
+	s := &Source{
+		reader:  r,
+		handler: h,
+		topic: func(m kafka.Message) string {
+			return m.Topic
+		},
+		event: func(kafka.Message) string { return "" },
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Get the ID of the event for a record, made of its Kafka topic, partition
+// and offset, such as "orders:3:1042".
+func EventID(m kafka.Message) string {
+	return fmt.Sprintf("%s:%d:%d", m.Topic, m.Partition, m.Offset)
+}
+
+// Make the event sent out for a record.
+func (s *Source) eventOf(m kafka.Message) ssehandler.Event {
+	return ssehandler.Event{
+		ID:    EventID(m),
+		Event: s.event(m),
+		Topic: s.topic(m),
+		Key:   string(m.Key),
+		Data:  m.Value,
+	}
+}
+
+// Consume records and send them out, until ctx is done or the handler is
+// closed. Errors while fetching records, sending them out while the handler
+// pushes back or committing their offsets are retried, with an increasing
+// delay. Records refused by the handler otherwise are skipped, see
+// WithDeadLetter, and their offsets committed. Returns ctx's error, or
+// ssehandler.ErrNotRunning once the handler is closed. The reader isn't
+// closed.
+func (s *Source) Run(ctx context.Context) error {
+	grouped := s.reader.Config().GroupID != ""
+	backoff := minBackoff
+	for {
+		m, err := s.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.logError("Error while fetching Kafka record", "err", err)
+			if err := wait(ctx, &backoff); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := s.send(ctx, m, &backoff); err != nil {
+			return err
+		}
+
+		if grouped {
+			if err := s.reader.CommitMessages(ctx, m); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				// The offset is committed along with a later one
+				s.logError("Error while committing Kafka offset", "id", EventID(m), "err", err)
+				if err := wait(ctx, &backoff); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		backoff = minBackoff
+	}
+}
+
+// Send out the event for a record, trying again later while the handler
+// pushes back. Records refused for any other reason are skipped, as trying
+// again wouldn't help and would hold up the rest of the partition. Returns
+// ctx's error, or ssehandler.ErrNotRunning once the handler is closed.
+func (s *Source) send(ctx context.Context, m kafka.Message, backoff *time.Duration) error {
+	e := s.eventOf(m)
+	for {
+		err := s.handler.SendContext(ctx, e)
+		switch {
+		case err == nil || errors.Is(err, ssehandler.ErrCircuitOpen):
+			// Sent out, if only to this instance's clients
+			return nil
+		case errors.Is(err, ssehandler.ErrNotRunning) || ctx.Err() != nil:
+			return err
+		case !errors.Is(err, ssehandler.ErrBackpressure):
+			s.logError("Skipping refused Kafka record", "id", e.ID, "err", err)
+			if s.deadLetter != nil {
+				s.deadLetter(m, err)
+			}
+			return nil
+		}
+		s.logError("Error while sending Kafka record", "id", e.ID, "err", err)
+		if err := wait(ctx, backoff); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Source) logError(msg string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.Error(msg, args...)
+	}
+}
+
+// Wait for the backoff, doubling it for the next time, unless ctx is done
+// first.
+func wait(ctx context.Context, backoff *time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(*backoff):
+	}
+	*backoff *= 2
+	if *backoff > maxBackoff {
+		*backoff = maxBackoff
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package kafkasource
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	ssehandler "github.com/lmas/gin-sse"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestEventOf(t *testing.T) {
+	m := kafka.Message{Topic: "orders", Partition: 3, Offset: 1042, Key: []byte("k"), Value: []byte("v")}
+	tests := []struct {
+		opts             []Option
+		topic, eventName string
+	}{
+		{nil, "orders", ""},
+		{[]Option{
+			WithTopic(func(kafka.Message) string { return "shop" }),
+			WithEventName(func(m kafka.Message) string { return m.Topic }),
+		}, "shop", "orders"},
+	}
+	for _, tt := range tests {
+		e := New(nil, nil, tt.opts...).eventOf(m)
+		if e.ID != "orders:3:1042" || e.Topic != tt.topic || e.Event != tt.eventName ||
+			e.Key != "k" || string(e.Data) != "v" {
+			t.Errorf("got %+v", e)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	h := ssehandler.NewSSEHandler()
+	refused := errors.New("invalid record")
+	h.Use(func(next ssehandler.Sender) ssehandler.Sender {
+		return func(ctx context.Context, e ssehandler.Event) error {
+			if string(e.Data) == "bad" {
+				return refused
+			}
+			return next(ctx, e)
+		}
+	})
+	h.HandleEvents()
+	defer h.Close(context.Background())
+	var dead []error
+	s := New(nil, h, WithDeadLetter(func(m kafka.Message, err error) {
+		dead = append(dead, err)
+	}))
+
+	tests := []struct {
+		value string
+		dead  int
+	}{
+		{"good", 0},
+		{"bad", 1},
+	}
+	for _, tt := range tests {
+		backoff := minBackoff
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err := s.send(ctx, kafka.Message{Topic: "orders", Value: []byte(tt.value)}, &backoff)
+		cancel()
+		if err != nil {
+			t.Errorf("%s: got %v", tt.value, err)
+		}
+		if len(dead) != tt.dead {
+			t.Errorf("%s: got dead letters %v", tt.value, dead)
+		}
+	}
+	if len(dead) > 0 && dead[0] != refused {
+		t.Errorf("got %v, want %v", dead[0], refused)
+	}
+}
@@ -0,0 +1,125 @@
+package ssehandler
+
+import (
+	"container/list"
+	"sort"
+)
+
+// Identifies the latest event of a topic, or of a key within a topic.
+type latestKey struct {
+	topic string
+	key   string
+}
+
+// An event kept in the cache of latest events.
+type latestEvent struct {
+	event Event
+	seq   uint64
+}
+
+// A cache of the latest event sent out for each topic, or each key within a
+// topic, see WithLatest. Only touched by the event loop.
+type latestCache struct {
+	events  map[latestKey]*list.Element
+	topics  map[string]*list.List // Most recently sent key first
+	maxKeys int
+	seq     uint64
+}
+
+func newLatestCache(maxKeys int) *latestCache {
+	return &latestCache{
+		events:  make(map[latestKey]*list.Element),
+		topics:  make(map[string]*list.List),
+		maxKeys: maxKeys,
+	}
+}
+
+// Keep an event as the latest one of its topic and key, dropping the least
+// recently sent key of the topic if it has too many.
+func (lc *latestCache) put(e Event) {
+	lc.seq++
+	k := latestKey{e.Topic, e.Key}
+	le := latestEvent{event: e, seq: lc.seq}
+	if el, found := lc.events[k]; found {
+		el.Value = le
+		lc.topics[e.Topic].MoveToFront(el)
+		return
+	}
+	keys := lc.topics[e.Topic]
+	if keys == nil {
+		keys = list.New()
+		lc.topics[e.Topic] = keys
+	}
+	lc.events[k] = keys.PushFront(le)
+	if lc.maxKeys > 0 && keys.Len() > lc.maxKeys {
+		oldest := keys.Back()
+		lc.drop(latestKey{e.Topic, oldest.Value.(latestEvent).event.Key}, oldest)
+	}
+}
+
+// Drop the event of a topic and key.
+func (lc *latestCache) drop(k latestKey, el *list.Element) {
+	delete(lc.events, k)
+	keys := lc.topics[k.topic]
+	keys.Remove(el)
+	if keys.Len() < 1 {
+		delete(lc.topics, k.topic)
+	}
+}
+
+// Get the latest events wanted by a client, oldest first, dropping any that
+// have gone stale.
+func (lc *latestCache) wanted(s *client) []Event {
+	var found []latestEvent
+	for k, el := range lc.events {
+		le := el.Value.(latestEvent)
+		if expired(le.event) {
+			lc.drop(k, el)
+			continue
+		}
+		if s.wants(le.event) {
+			found = append(found, le)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].seq < found[j].seq
+	})
+	events := make([]Event, len(found))
+	for i, le := range found {
+		events[i] = le.event
+	}
+	return events
+}
+
+// Drop the events of the topics matching left that no client follows anymore,
+// as told by watched, after a client left them.
+func (lc *latestCache) forget(left, watched func(topic string) bool) {
+	for topic, keys := range lc.topics {
+		if !left(topic) || watched(topic) {
+			continue
+		}
+		for el := keys.Front(); el != nil; el = el.Next() {
+			delete(lc.events, latestKey{topic, el.Value.(latestEvent).event.Key})
+		}
+		delete(lc.topics, topic)
+	}
+}
+
+// Check if any client receives the events of a topic, by being subscribed to
+// it or a pattern matching it. Only called by the event loop.
+func (b *SSEHandler) watched(topic string) bool {
+	if topic == "" {
+		return len(b.clients) > 0
+	}
+	for _, sh := range b.shards {
+		if len(sh.topics[topic]) > 0 {
+			return true
+		}
+		for p := range sh.patterns {
+			if topicMatches(p, topic) {
+				return true
+			}
+		}
+	}
+	return false
+}
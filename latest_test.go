@@ -0,0 +1,77 @@
+package ssehandler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLatestCache(t *testing.T) {
+	lc := newLatestCache(0)
+	lc.put(Event{ID: "1", Topic: "a"})
+	lc.put(Event{ID: "2", Topic: "b"})
+	lc.put(Event{ID: "3", Topic: "a"})
+	lc.put(Event{ID: "4", Topic: "a", Key: "x"})
+	lc.put(Event{ID: "5", Topic: "a", Key: "y"})
+	lc.put(Event{ID: "6", Topic: "a", Key: "x"})
+	lc.put(Event{ID: "7"})
+
+	tests := []struct {
+		topics []string
+		want   string
+	}{
+		{nil, "7"},
+		{[]string{"a"}, "3567"},
+		{[]string{"a", "b"}, "23567"},
+	}
+	for _, tt := range tests {
+		s := &client{topics: tt.topics}
+		if got := joinIDs(lc.wanted(s)); got != tt.want {
+			t.Errorf("topics %v: got %q, want %q", tt.topics, got, tt.want)
+		}
+	}
+}
+
+func TestLatestCacheLimits(t *testing.T) {
+	lc := newLatestCache(2)
+	lc.put(Event{ID: "1", Topic: "a", Key: "x"})
+	lc.put(Event{ID: "2", Topic: "a", Key: "y"})
+	lc.put(Event{ID: "3", Topic: "a", Key: "x"})
+	lc.put(Event{ID: "4", Topic: "a", Key: "z"})
+	lc.put(Event{ID: "5", Topic: "b", Expires: time.Now().Add(-time.Second)})
+	lc.put(Event{ID: "6", Topic: "c"})
+	s := &client{topics: []string{"#"}}
+	if got := joinIDs(lc.wanted(s)); got != "346" {
+		t.Errorf("got %q", got)
+	}
+	if len(lc.events) != 3 || lc.topics["b"] != nil {
+		t.Errorf("stale or dropped events kept: %v", lc.events)
+	}
+
+	lc.forget(func(topic string) bool { return topic != "c" }, func(string) bool { return false })
+	if got := joinIDs(lc.wanted(s)); got != "6" {
+		t.Errorf("got %q after forgetting", got)
+	}
+}
+
+func TestLatestForgotten(t *testing.T) {
+	b := testHandler(WithLatest(0))
+	defer b.Close(context.Background())
+	_, removed := subscribeTest(t, b, "a", nil, "orders")
+	b.Send(Event{ID: "1", Topic: "orders", Data: []byte("1")})
+	b.Sync(context.Background())
+	s, _ := subscribeTest(t, b, "b", nil, "orders")
+	if got := s.next(time.Second); got != "1" {
+		t.Errorf("got %q, want the latest event", got)
+	}
+	b.Disconnect("a", "")
+	b.Disconnect("b", "")
+	<-removed
+	for b.ClientCount() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	s, _ = subscribeTest(t, b, "c", nil, "orders")
+	if got := s.next(50 * time.Millisecond); got != "" {
+		t.Errorf("got %q for a topic without subscribers", got)
+	}
+}
@@ -0,0 +1,59 @@
+package ssehandler
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+// A Logger receives the handler's internal events, such as clients connecting
+// or being dropped and errors. The arguments following msg are alternating
+// keys and values, as with log/slog, so a *slog.Logger can be used as is. See
+// WithLogger.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// The slog package is supported without any adapter.
+var _ Logger = (*slog.Logger)(nil)
+
+// A Logger dropping everything, used by default.
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// A Logger writing to a logger of the standard log package.
+type stdLogger struct {
+	l *log.Logger
+}
+
+// Make a Logger writing to l, or the standard logger if nil, with the keys and
+// values formatted as "key=value".
+func StdLogger(l *log.Logger) Logger {
+	if l == nil {
+		l = log.Default()
+	}
+	return stdLogger{l}
+}
+
+func (s stdLogger) Debug(msg string, args ...interface{}) { s.print("DEBUG", msg, args) }
+func (s stdLogger) Info(msg string, args ...interface{})  { s.print("INFO", msg, args) }
+func (s stdLogger) Error(msg string, args ...interface{}) { s.print("ERROR", msg, args) }
+
+func (s stdLogger) print(level, msg string, args []interface{}) {
+	var sb strings.Builder
+	sb.WriteString(level + " " + msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&sb, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&sb, " %v", args[i])
+		}
+	}
+	s.l.Print(sb.String())
+}
@@ -0,0 +1,187 @@
+package ssehandler
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prometheus metrics of a handler, see Collector.
+type metrics struct {
+	clients     prometheus.Gauge
+	connects    prometheus.Counter
+	disconnects prometheus.Counter
+	broadcasts  prometheus.Counter
+	bytes       prometheus.Counter
+	dropped     prometheus.Counter
+	evictions   prometheus.Counter
+	expired     prometheus.Counter
+	resyncs     prometheus.Counter
+	hookDrops   prometheus.Counter
+	latency     prometheus.Histogram
+	broker      prometheus.Gauge
+	circuit     prometheus.Gauge
+
+	// Number of clients by the value of their metadata, if a key is set
+	// by WithMetadataLabel.
+	labeled *prometheus.GaugeVec
+	label   string
+
+	// Clients, events and refused clients and events by tenant, collected
+	// with WithTenants.
+	tenants          bool
+	tenantClients    *prometheus.GaugeVec
+	tenantEvents     *prometheus.CounterVec
+	tenantRejections *prometheus.CounterVec
+}
+
+func newMetrics(namespace, label string, tenants bool) *metrics {
+	m := &metrics{
+		clients: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "clients",
+			Help:      "Number of connected clients.",
+		}),
+		connects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "connects_total",
+			Help:      "Total number of clients connected.",
+		}),
+		disconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "disconnects_total",
+			Help:      "Total number of clients disconnected.",
+		}),
+		broadcasts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "broadcasts_total",
+			Help:      "Total number of events broadcast.",
+		}),
+		bytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "written_bytes_total",
+			Help:      "Total number of bytes written to clients.",
+		}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dropped_total",
+			Help:      "Total number of messages dropped for slow clients.",
+		}),
+		evictions: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "evictions_total",
+			Help:      "Total number of clients disconnected after a failed write.",
+		}),
+		expired: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "expired_total",
+			Help:      "Total number of stale events dropped instead of being sent.",
+		}),
+		resyncs: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "snapshot_resends_total",
+			Help:      "Total number of snapshots resent to clients that missed deltas.",
+		}),
+		hookDrops: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dropped_hook_calls_total",
+			Help:      "Total number of errors and dead letters dropped as their hooks fell behind.",
+		}),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "broadcast_duration_seconds",
+			Help:      "Time spent pushing an event to all of its clients.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 8),
+		}),
+		broker: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "broker_connected",
+			Help:      "Whether the handler is subscribed to its broker (1) or not (0).",
+		}),
+		circuit: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "broker_circuit_state",
+			Help:      "State of the broker's circuit breaker: closed (0), open (1) or half-open (2).",
+		}),
+	}
+	m.tenants = tenants
+	m.tenantClients = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tenant_clients",
+		Help:      "Number of connected clients, by tenant.",
+	}, []string{"tenant"})
+	m.tenantEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tenant_events_total",
+		Help:      "Total number of events sent to tenants, by tenant.",
+	}, []string{"tenant"})
+	m.tenantRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tenant_rejections_total",
+		Help:      "Total number of clients and events refused for going over a tenant's quota, by tenant.",
+	}, []string{"tenant"})
+	if label != "" {
+		m.label = label
+		m.labeled = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "clients_by_" + label,
+			Help:      "Number of connected clients, by their " + label + " metadata.",
+		}, []string{label})
+	}
+	return m
+}
+
+func (m *metrics) collectors() []prometheus.Collector {
+	c := []prometheus.Collector{
+		m.clients, m.connects, m.disconnects, m.broadcasts, m.bytes,
+		m.dropped, m.evictions, m.expired, m.resyncs, m.hookDrops, m.latency,
+		m.broker, m.circuit,
+	}
+	if m.labeled != nil {
+		c = append(c, m.labeled)
+	}
+	if m.tenants {
+		c = append(c, m.tenantClients, m.tenantEvents, m.tenantRejections)
+	}
+	return c
+}
+
+// Count a client connecting or disconnecting, by its metadata.
+func (m *metrics) addLabeled(s *client, delta float64) {
+	if m.labeled == nil {
+		return
+	}
+	var value string
+	if v, found := s.metadata[m.label]; found {
+		value = fmt.Sprint(v)
+	}
+	m.labeled.WithLabelValues(value).Add(delta)
+}
+
+// Remove the series of a tenant that's been forgotten, see WithTenants.
+func (m *metrics) forgetTenant(key string) {
+	m.tenantClients.DeleteLabelValues(key)
+	m.tenantEvents.DeleteLabelValues(key)
+	m.tenantRejections.DeleteLabelValues(key)
+}
+
+// Describe implements prometheus.Collector.
+func (m *metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (m *metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// Get a collector of the handler's metrics, ready to be registered with a
+// prometheus registry. The metric names are prefixed with the namespace set
+// by WithMetricsNamespace, or "sse" by default.
+func (b *SSEHandler) Collector() prometheus.Collector {
+	return b.metrics
+}
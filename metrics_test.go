@@ -0,0 +1,38 @@
+package ssehandler
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetadataLabel(t *testing.T) {
+	b := NewSSEHandler(WithMetadataLabel("region"))
+	clients := []*client{
+		{id: "a", metadata: map[string]interface{}{"region": "eu"}},
+		{id: "b", metadata: map[string]interface{}{"region": "eu"}},
+		{id: "c", metadata: map[string]interface{}{"region": "us"}},
+		{id: "d"},
+	}
+	for _, s := range clients {
+		s.events = make(chan message)
+		s.gone = make(chan struct{})
+		b.addClient(s)
+	}
+	b.removeClient(clients[1])
+
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"eu", 1},
+		{"us", 1},
+		{"", 1},
+	}
+	for _, tt := range tests {
+		got := testutil.ToFloat64(b.metrics.labeled.WithLabelValues(tt.value))
+		if got != tt.want {
+			t.Errorf("region %q: got %v clients, want %v", tt.value, got, tt.want)
+		}
+	}
+}
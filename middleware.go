@@ -0,0 +1,32 @@
+package ssehandler
+
+import "context"
+
+// A Sender sends out an event to all clients, or those subscribed to its
+// topic. See Use.
+type Sender func(ctx context.Context, e Event) error
+
+// A Middleware wraps the Sender next, such as for enriching, validating or
+// redacting events before passing them on. It can drop an event by not
+// calling next, or refuse it by returning an error, which is returned by
+// SendContext and TrySend.
+type Middleware func(next Sender) Sender
+
+// Pass all events sent out to all clients, or those subscribed to a topic,
+// through the middleware, in order. Events sent to single clients or users
+// aren't passed through it. Must be called before HandleEvents.
+func (b *SSEHandler) Use(mw ...Middleware) {
+	b.middleware = append(b.middleware, mw...)
+}
+
+// Wrap a sender in all of the middleware, with the first one called first,
+// and in the tracing if enabled.
+func (b *SSEHandler) intercept(send Sender) Sender {
+	for i := len(b.middleware) - 1; i >= 0; i-- {
+		send = b.middleware[i](send)
+	}
+	if b.tracer != nil {
+		send = b.tracePublish(send)
+	}
+	return send
+}
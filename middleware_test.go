@@ -0,0 +1,42 @@
+package ssehandler
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	b := NewSSEHandler()
+	var order []string
+	b.Use(func(next Sender) Sender {
+		return func(ctx context.Context, e Event) error {
+			order = append(order, "first")
+			if e.Topic == "secret" {
+				return errors.New("refused")
+			}
+			e.Event = "enriched"
+			return next(ctx, e)
+		}
+	}, func(next Sender) Sender {
+		return func(ctx context.Context, e Event) error {
+			order = append(order, "second")
+			return next(ctx, e)
+		}
+	})
+
+	var got Event
+	send := b.intercept(func(ctx context.Context, e Event) error {
+		got = e
+		return nil
+	})
+	if err := send(context.Background(), Event{Data: []byte("x")}); err != nil {
+		t.Fatal(err)
+	}
+	if got.Event != "enriched" || len(order) != 2 || order[0] != "first" {
+		t.Fatalf("got %+v, order %v", got, order)
+	}
+	if err := send(context.Background(), Event{Topic: "secret"}); err == nil {
+		t.Fatal("secret event not refused")
+	}
+}
@@ -0,0 +1,129 @@
+// MQTT source for the SSE handler, for streaming IoT telemetry to web
+// dashboards.
+
+package mqttsource
+
+import (
+	"context"
+	"errors"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	ssehandler "github.com/lmas/gin-sse"
+)
+
+// A Source subscribes to MQTT topic filters and sends out the messages as
+// events, with the payload as data. The MQTT topics map onto SSE topics as
+// is, by default, so clients can subscribe to the same hierarchy of topics
+// with the same wildcards, such as "sensors/+/temp".
+type Source struct {
+	handler *ssehandler.SSEHandler
+	filters []string
+	qos     byte
+	topic   func(mqttTopic string) string
+	event   func(mqttTopic string) string
+	logger  ssehandler.Logger
+}
+
+// An Option configures a Source, see New.
+type Option func(*Source)
+
+// Subscribe with the quality of service level, instead of 0 (at most once).
+func WithQoS(qos byte) Option {
+	return func(s *Source) {
+		s.qos = qos
+	}
+}
+
+// Use f for getting the SSE topic of the events sent out for the messages of
+// each MQTT topic, such as for stripping a prefix. Messages for which f returns
+// an empty topic are sent to all clients.
+func WithTopic(f func(mqttTopic string) string) Option {
+	return func(s *Source) {
+		s.topic = f
+	}
+}
+
+// Use f for getting the name of the events sent out for the messages of each
+// MQTT topic. Events are sent without a name by default.
+func WithEventName(f func(mqttTopic string) string) Option {
+	return func(s *Source) {
+		s.event = f
+	}
+}
+
+// Log errors while subscribing or sending out messages to l. Nothing is
+// logged by default.
+func WithLogger(l ssehandler.Logger) Option {
+	return func(s *Source) {
+		s.logger = l
+	}
+}
+
+// Make a new Source for the MQTT topic filters, sending out their messages
+// with h. Set the source's OnConnect as the OnConnect handler of the MQTT
+// client's options, so the subscriptions are renewed whenever the client
+// reconnects.
+func New(h *ssehandler.SSEHandler, filters []string, opts ...Option) *Source {
+	s := &Source{
+		handler: h,
+		filters: filters,
+		topic:   func(t string) string { return t },
+		event:   func(string) string { return "" },
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Subscribe the client to the topic filters, logging any error. Meant to be
+// used as the client's mqtt.OnConnectHandler.
+func (s *Source) OnConnect(c mqtt.Client) {
+	if err := s.Subscribe(c); err != nil {
+		s.logError("Error while subscribing to MQTT topics", "err", err)
+	}
+}
+
+// Subscribe the client to the topic filters, forwarding their messages.
+func (s *Source) Subscribe(c mqtt.Client) error {
+	filters := make(map[string]byte, len(s.filters))
+	for _, f := range s.filters {
+		filters[f] = s.qos
+	}
+	t := c.SubscribeMultiple(filters, s.forward)
+	t.Wait()
+	return t.Error()
+}
+
+// Unsubscribe the client from the topic filters.
+func (s *Source) Unsubscribe(c mqtt.Client) error {
+	t := c.Unsubscribe(s.filters...)
+	t.Wait()
+	return t.Error()
+}
+
+// Send out a message as an event. Called by the MQTT client, which waits for
+// the event to be queued before handling the next message, keeping them in
+// order. Messages that can't be sent out, such as when the handler pushes
+// back, are dropped.
+func (s *Source) forward(_ mqtt.Client, m mqtt.Message) {
+	e := s.eventOf(m.Topic(), m.Payload())
+	if err := s.handler.SendContext(context.Background(), e); err != nil && !errors.Is(err, ssehandler.ErrCircuitOpen) {
+		s.logError("Error while sending MQTT message", "topic", m.Topic(), "err", err)
+	}
+}
+
+// Make the event sent out for a message of the MQTT topic.
+func (s *Source) eventOf(mqttTopic string, payload []byte) ssehandler.Event {
+	return ssehandler.Event{
+		Event: s.event(mqttTopic),
+		Topic: s.topic(mqttTopic),
+		Data:  payload,
+	}
+}
+
+func (s *Source) logError(msg string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.Error(msg, args...)
+	}
+}
@@ -0,0 +1,25 @@
+package mqttsource
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEventOf(t *testing.T) {
+	tests := []struct {
+		opts             []Option
+		topic, eventName string
+	}{
+		{nil, "site/sensors/1/temp", ""},
+		{[]Option{
+			WithTopic(func(t string) string { return strings.TrimPrefix(t, "site/") }),
+			WithEventName(func(string) string { return "reading" }),
+		}, "sensors/1/temp", "reading"},
+	}
+	for _, tt := range tests {
+		e := New(nil, []string{"site/#"}, tt.opts...).eventOf("site/sensors/1/temp", []byte("21.5"))
+		if e.Topic != tt.topic || e.Event != tt.eventName || string(e.Data) != "21.5" {
+			t.Errorf("got %+v", e)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// NATS broker for the SSE handler, for broadcasting events across multiple
+// instances.
+
+package natsbroker
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	ssehandler "github.com/lmas/gin-sse"
+	"github.com/nats-io/nats.go"
+)
+
+// A Broker publishes events to NATS subjects, shared by all instances. Events
+// without a topic are published to the prefix subject itself and events with
+// a topic to "<prefix>.<topic>". The levels of the topic are separated by "."
+// in the subject instead of "/", so "orders/eu" can be subscribed to as
+// "<prefix>.orders.*", and any characters within a level that aren't allowed
+// in a subject token (".", "*", ">" and whitespace) are percent-encoded, as is
+// "%" itself. Empty levels become a single "%".
+type Broker struct {
+	conn   *nats.Conn
+	prefix string
+}
+
+// Make a new Broker using the NATS connection and subject prefix. The broker
+// relies on the connection's own reconnect settings: once the connection is
+// closed, events are no longer published or received. See Connect.
+func New(conn *nats.Conn, prefix string) *Broker {
+	return &Broker{
+		conn:   conn,
+		prefix: prefix,
+	}
+}
+
+// Connect to the NATS server at url and make a new Broker using the subject
+// prefix. The connection keeps trying to reconnect forever if it's lost, on
+// top of any other options.
+func Connect(url, prefix string, opts ...nats.Option) (*Broker, error) {
+	opts = append([]nats.Option{nats.MaxReconnects(-1)}, opts...)
+	conn, err := nats.Connect(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return New(conn, prefix), nil
+}
+
+// Get the subject for a topic.
+func (b *Broker) subject(topic string) string {
+	if topic == "" {
+		return b.prefix
+	}
+	levels := strings.Split(topic, "/")
+	for i, l := range levels {
+		levels[i] = escapeToken(l)
+	}
+	return b.prefix + "." + strings.Join(levels, ".")
+}
+
+// Percent-encode the characters not allowed in a subject token, along with
+// "%" itself.
+var escaper = strings.NewReplacer(
+	"%", "%25", ".", "%2E", "*", "%2A", ">", "%3E",
+	" ", "%20", "\t", "%09", "\r", "%0D", "\n", "%0A",
+)
+
+func escapeToken(s string) string {
+	if s == "" {
+		// Tokens can't be empty, and a lone "%" can't come from escaping
+		return "%"
+	}
+	return escaper.Replace(s)
+}
+
+// Publish an event to all instances. The event is buffered by the NATS
+// connection, so Publish doesn't block, but nothing is published if ctx is
+// already done.
+func (b *Broker) Publish(ctx context.Context, e ssehandler.Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return b.conn.Publish(b.subject(e.Topic), data)
+}
+
+// Subscribe to the events published by all instances, until ctx is done. The
+// subscriptions are kept by the NATS connection while it's reconnecting.
+func (b *Broker) Subscribe(ctx context.Context) (<-chan ssehandler.Event, error) {
+	messages := make(chan *nats.Msg, 64)
+	var subs []*nats.Subscription
+	for _, subject := range []string{b.prefix, b.prefix + ".>"} {
+		sub, err := b.conn.ChanSubscribe(subject, messages)
+		if err != nil {
+			for _, s := range subs {
+				s.Unsubscribe()
+			}
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+
+	events := make(chan ssehandler.Event)
+	go func() {
+		defer close(events)
+		defer func() {
+			for _, s := range subs {
+				s.Unsubscribe()
+			}
+		}()
+		for {
+			select {
+			case msg := <-messages:
+				var e ssehandler.Event
+				if err := json.Unmarshal(msg.Data, &e); err != nil {
+					// Not one of ours
+					continue
+				}
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
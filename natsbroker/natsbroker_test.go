@@ -0,0 +1,38 @@
+package natsbroker
+
+import "testing"
+
+func TestEscapeToken(t *testing.T) {
+	tests := []struct {
+		token, want string
+	}{
+		{"orders", "orders"},
+		{"", "%"},
+		{"v1.2", "v1%2E2"},
+		{"a*b>c", "a%2Ab%3Ec"},
+		{"a b\tc", "a%20b%09c"},
+		{"100%", "100%25"},
+	}
+	for _, tt := range tests {
+		if got := escapeToken(tt.token); got != tt.want {
+			t.Errorf("escapeToken(%q) = %q, want %q", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestSubject(t *testing.T) {
+	b := New(nil, "sse")
+	tests := map[string]string{
+		"":               "sse",
+		"orders":         "sse.orders",
+		"orders/eu":      "sse.orders.eu",
+		"v1.2/eu":        "sse.v1%2E2.eu",
+		"orders//eu":     "sse.orders.%.eu",
+		"orders/eu west": "sse.orders.eu%20west",
+	}
+	for topic, want := range tests {
+		if got := b.subject(topic); got != want {
+			t.Errorf("subject(%q) = %q, want %q", topic, got, want)
+		}
+	}
+}
@@ -0,0 +1,737 @@
+package ssehandler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// An Option configures a SSEHandler, see NewSSEHandler.
+type Option func(*SSEHandler)
+
+// Buffer up to n messages waiting to be sent out by the event loop, before
+// the send methods start blocking. Defaults to 10.
+func WithQueueSize(n int) Option {
+	return func(b *SSEHandler) {
+		b.queueSize = n
+	}
+}
+
+// Send the headers to new clients, on top of the default ones. Headers with
+// the same name replace the defaults, or remove them if they have no values.
+// The defaults keep proxies from buffering or transforming the stream:
+//
+//	Content-Type: text/event-stream
+//	Cache-Control: no-cache, no-transform
+//	Connection: keep-alive
+//	X-Accel-Buffering: no
+func WithHeaders(h http.Header) Option {
+	return func(b *SSEHandler) {
+		for k, v := range h {
+			if len(v) < 1 {
+				delete(b.headers, http.CanonicalHeaderKey(k))
+				continue
+			}
+			b.headers[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+}
+
+// Start the stream of each new SSE client with a comment of the text and at
+// least n spaces of padding, written along with the headers as soon as the
+// client is registered. Some proxies and older browsers hold back the start
+// of a response until enough bytes have arrived, which the padding makes up
+// for, such as 2048 bytes for Internet Explorer's polyfills. The headers are
+// flushed right away even without this option.
+func WithInitialComment(text string, n int) Option {
+	return func(b *SSEHandler) {
+		b.initialComment = text
+		b.padding = n
+	}
+}
+
+// Call f for each new SSE client, with the headers about to be sent to it, so
+// it can set any extra headers for the subscription, such as a
+// Content-Security-Policy, caching headers or cookies with Set-Cookie. It's
+// called after the headers of WithHeaders are set, and before the client is
+// registered. WebSocket clients are sent the headers set by f as well, with
+// the upgrade response, but not those of WithHeaders.
+func WithHeaderFunc(f func(c *gin.Context, h http.Header)) Option {
+	return func(b *SSEHandler) {
+		b.headerFunc = f
+	}
+}
+
+// Log the handler's internal events to l, such as clients connecting or being
+// dropped and errors. Nothing is logged by default. Use StdLogger for loggers
+// of the standard log package.
+func WithLogger(l Logger) Option {
+	return func(b *SSEHandler) {
+		b.logger = l
+	}
+}
+
+// Call f with the errors the handler runs into but can't return, so that they
+// can be alerted on: failed writes to clients, store and broker failures, see
+// HandlerError, and recovered panics, see PanicError. Errors are logged as
+// well. f is called from a goroutine of its own, one error at a time, and
+// errors are dropped if it falls too far behind, as counted by the
+// dropped_hook_calls_total metric.
+func WithOnError(f func(error)) Option {
+	return func(b *SSEHandler) {
+		b.onError = f
+	}
+}
+
+// Call f with the events that couldn't be delivered, so that none disappear
+// without a trace: events gone stale before being written to a client, events
+// dropped for slow clients or while paused, and events the broker failed to
+// publish. See DeadLetter. f is called like the hook of WithOnError, from the
+// same goroutine, and any error it returns is reported to that hook.
+func WithDeadLetter(f func(DeadLetter) error) Option {
+	return func(b *SSEHandler) {
+		b.deadLetter = f
+	}
+}
+
+// Keep the last n events in history, so that reconnecting clients sending a
+// Last-Event-ID header can be sent the events they missed, before receiving
+// any new ones. Short for WithEventStore(NewRingStore(n)).
+func WithReplay(n int) Option {
+	return WithEventStore(NewRingStore(n))
+}
+
+// Keep the history of events in s, so that reconnecting clients sending a
+// Last-Event-ID header can be sent the events they missed, before receiving
+// any new ones. The history is read by the event loop, for each new client,
+// so a slow store holds up all other clients meanwhile.
+func WithEventStore(s EventStore) Option {
+	return func(b *SSEHandler) {
+		b.store = s
+	}
+}
+
+// Send the last n events kept in history to new clients, before any new ones.
+// Requires an event store, see WithEventStore.
+func WithSendLast(n int) Option {
+	return func(b *SSEHandler) {
+		b.sendLast = n
+	}
+}
+
+// Tell new clients to wait d before trying to reconnect, after losing their
+// connection. Browsers use their own default if this isn't set.
+func WithRetry(d time.Duration) Option {
+	return reloadable(func(b *SSEHandler) {
+		b.retry = d
+	})
+}
+
+// Send a heartbeat comment to each client every d, keeping idle connections
+// from being closed by proxies and load balancers.
+func WithHeartbeat(d time.Duration) Option {
+	return reloadable(func(b *SSEHandler) {
+		b.heartbeat = d
+	})
+}
+
+// Use f for formatting events, instead of the standard SSE wire format.
+func WithFormatter(f Formatter) Option {
+	return func(b *SSEHandler) {
+		b.formatter = f
+	}
+}
+
+// Prefix the names of the handler's prometheus metrics with ns, instead of
+// "sse". See Collector.
+func WithMetricsNamespace(ns string) Option {
+	return func(b *SSEHandler) {
+		b.metricsNamespace = ns
+	}
+}
+
+// Refuse new clients with 503 Service Unavailable, while n clients are
+// already connected.
+func WithMaxClients(n int) Option {
+	return reloadable(func(b *SSEHandler) {
+		b.maxClients = n
+	})
+}
+
+// Tell clients refused by WithMaxClients to retry after d, using the
+// Retry-After header. Defaults to 10 seconds, or no header if d is 0.
+// d is rounded up to whole seconds.
+func WithRetryAfter(d time.Duration) Option {
+	return func(b *SSEHandler) {
+		b.retryAfter = d
+	}
+}
+
+// Limit the rate of new clients from each IP address to r per second, with
+// bursts of up to burst clients. Clients over the limit are refused with 429
+// Too Many Requests.
+func WithRateLimit(r rate.Limit, burst int) Option {
+	return func(b *SSEHandler) {
+		key := (*gin.Context).ClientIP
+		if b.rateLimiter != nil {
+			key = b.rateLimiter.key
+		}
+		b.rateLimiter = newRateLimiter(r, burst)
+		b.rateLimiter.key = key
+	}
+}
+
+// Use f for getting the keys clients are rate limited by, such as API keys
+// or user IDs, instead of their IP addresses. See WithRateLimit.
+func WithRateLimitKey(f func(*gin.Context) string) Option {
+	return func(b *SSEHandler) {
+		if b.rateLimiter == nil {
+			b.rateLimiter = newRateLimiter(rate.Inf, 0)
+		}
+		b.rateLimiter.key = f
+	}
+}
+
+// Call f to authorize each new client, before it's subscribed. Clients are
+// refused with the status set by WithAuthorizeStatus (401 Unauthorized by
+// default) if an error is returned. Any ID, user ID and claims in the returned
+// info are used for the client, instead of the ones from WithClientID and
+// WithUserID.
+func WithAuthorize(f func(*gin.Context) (ClientInfo, error)) Option {
+	return func(b *SSEHandler) {
+		b.authorize = f
+	}
+}
+
+// Refuse unauthorized clients with the status code, see WithAuthorize.
+func WithAuthorizeStatus(code int) Option {
+	return func(b *SSEHandler) {
+		b.authorizeStatus = code
+	}
+}
+
+// Call f for each client and event broadcast to it, only sending the event
+// to the client if it returns true. Clients get the same info as given to the
+// hooks. It's called by the event loop and must not block. Events sent to
+// single clients or users are always sent.
+func WithEventAuthorize(f func(ClientInfo, Event) bool) Option {
+	return func(b *SSEHandler) {
+		b.authorizeEvent = f
+	}
+}
+
+// Call f to respond to clients refused a subscription, instead of aborting
+// with a bare status code, such as for sending JSON problem documents. The
+// error is a *RejectedError, holding the status code the client would have
+// been refused with and the reason, such as ErrRateLimited or the error from
+// WithAuthorize. The request is aborted once f returns.
+func WithRejectHandler(f func(c *gin.Context, err error)) Option {
+	return func(b *SSEHandler) {
+		b.rejectHandler = f
+	}
+}
+
+// Let new clients list more topics to subscribe to in the query parameter,
+// separated by commas, such as "/events?topics=orders,shipments" for a
+// parameter named "topics". The topics are added to the ones given to
+// Subscribe or Handler. Any client can then subscribe to any topic, unless
+// limited by WithTopicACL. See also WithTopicEventNames.
+func WithTopicsParam(name string) Option {
+	return func(b *SSEHandler) {
+		b.topicsParam = name
+	}
+}
+
+// Send the events published to a topic without a name of their own named
+// after the topic, so that clients subscribed to many topics can tell them
+// apart with addEventListener(topic, ...). Only the SSE stream of the events
+// is affected, while filters and hooks see the events as they were sent.
+func WithTopicEventNames() Option {
+	return func(b *SSEHandler) {
+		b.topicEventNames = true
+	}
+}
+
+// Call f for each new client, after it's authorized, to get the topics it's
+// allowed to receive, such as with AllowTopics. Any other topics the client
+// asks for are left out, rooms it's not allowed in can't be joined, and
+// events published to other topics are never delivered to it. Events without
+// a topic aren't affected. Reserved topics, such as DebugTopic, are only
+// delivered to clients allowed them by f.
+func WithTopicACL(f func(c *gin.Context, info ClientInfo) func(topic string) bool) Option {
+	return func(b *SSEHandler) {
+		b.topicACL = f
+	}
+}
+
+// Call f whenever a new client has connected. It's called from its own
+// goroutine once the client is registered, while messages are already being
+// written to it, so it may call any of the handler's methods, including ones
+// for the client itself such as Join or SendTo. The client's request handler
+// waits for f to return before it returns, so the gin context stays valid,
+// but f must not write to the response.
+func WithOnConnect(f func(*gin.Context, ClientInfo)) Option {
+	return func(b *SSEHandler) {
+		b.onConnect = f
+	}
+}
+
+// Call f whenever a client has disconnected, including when the handler is
+// closed. It's called from the client's own request handler.
+func WithOnDisconnect(f func(ClientInfo)) Option {
+	return func(b *SSEHandler) {
+		b.onDisconnect = f
+	}
+}
+
+// Send all events through br, so they reach the clients connected to the
+// handlers on all instances. Events sent to single clients or users are only
+// sent to the clients connected to this instance.
+func WithBroker(br Broker) Option {
+	return func(b *SSEHandler) {
+		b.broker = br
+	}
+}
+
+// Stop publishing through the broker for a while, after threshold publishes
+// in a row have failed, instead of having each publish wait on a broker that's
+// down. After cooldown, 1 second if 0 or less, a single publish is let through
+// to see if it's back, doubling the cooldown each time it isn't, up to 30
+// seconds. Meanwhile the events are still sent out to the clients connected to
+// this instance, with SendContext returning ErrCircuitOpen, as are events
+// published while the broker subscription is down. The circuit's state is
+// exported as a metric, and opening it is reported to WithOnError as well.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(b *SSEHandler) {
+		if threshold < 1 {
+			threshold = 1
+		}
+		if cooldown <= 0 {
+			cooldown = time.Second
+		}
+		b.circuit = &circuit{threshold: threshold, cooldown: cooldown}
+	}
+}
+
+// Batch up the writes to each client, flushing them at most every d or once
+// size bytes are waiting, instead of after every event. This trades latency
+// for throughput under high rates of events. A size of 0 or less only flushes
+// on time. Heartbeats are always flushed right away.
+func WithFlushInterval(d time.Duration, size int) Option {
+	return func(b *SSEHandler) {
+		b.flushInterval = d
+		b.flushSize = size
+	}
+}
+
+// Disconnect clients when writing an event to them takes longer than d, as
+// when they've stopped reading. The deadline is set anew before each write,
+// overriding any WriteTimeout of the http.Server.
+func WithWriteTimeout(d time.Duration) Option {
+	return reloadable(func(b *SSEHandler) {
+		b.writeTimeout = d
+	})
+}
+
+// Compress the responses of the clients for which enable returns true and
+// that accept gzip or deflate, using the level of compress/flate. The
+// compressor is flushed after each event, so events still arrive right away.
+// Some proxies buffer compressed responses, so compression is opt-in for each
+// connection, such as by a query parameter.
+func WithCompression(level int, enable func(c *gin.Context) bool) Option {
+	return func(b *SSEHandler) {
+		b.compressLevel = level
+		b.compressFor = enable
+	}
+}
+
+// Upgrade the connections of WebSocket clients with u, such as for allowing
+// other origins with u.CheckOrigin. See SubscribeWebSocket.
+func WithWebSocketUpgrader(u *websocket.Upgrader) Option {
+	return func(b *SSEHandler) {
+		b.upgrader = u
+	}
+}
+
+// Stream NDJSON to all clients instead of SSE, for consumers like command line
+// tools and log shippers. Each event is sent as a single line of JSON, made by
+// FormatNDJSON, and the heartbeat is an empty line. Without this option,
+// NDJSON is only streamed to clients asking for it with an Accept header
+// of "application/x-ndjson".
+func WithNDJSON() Option {
+	return func(b *SSEHandler) {
+		b.ndjson = true
+	}
+}
+
+// Limit the events broadcast to the clients subscribed to topic to r per
+// second, with bursts of up to burst events. Events over the limit are held
+// back until they're due, and replaced by any newer event meanwhile, so that
+// clients only miss the intermediate updates of a chatty producer. The events
+// replaced are never sent out, nor kept in history unless by a SharedStore,
+// and get an empty result from PublishEvent.
+func WithTopicThrottle(topic string, r rate.Limit, burst int) Option {
+	return func(b *SSEHandler) {
+		if b.throttles == nil {
+			b.throttles = make(map[string]*throttle)
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		b.throttles[topic] = &throttle{limiter: rate.NewLimiter(r, burst)}
+	}
+}
+
+// Coalesce the events with keys, for high-frequency sources such as cursor
+// positions or sensor readings: an event is held back for d, and if newer
+// events with the same topic and key arrive meanwhile, only the latest one is
+// sent out once d has passed. Events without a key are sent out right away.
+// The events replaced are treated like those replaced by WithTopicThrottle.
+func WithCoalesce(d time.Duration) Option {
+	return func(b *SSEHandler) {
+		b.coalesceWindow = d
+	}
+}
+
+// Trace the events sent out with OpenTelemetry, using the tracers of tp: each
+// event gets a span for publishing it, as a child of any span in the ctx
+// given to SendContext or PublishEvent, and one for broadcasting it, as a
+// child of the first one. The trace context is carried between them in the
+// event's attributes, so a trace also spans the instances of a broker. If
+// deliveries is true, each write of a broadcast event to a client gets a span
+// of its own as well, which adds up with many clients. Events queued by
+// TrySend for a broker or shared store start new traces.
+func WithTracing(tp trace.TracerProvider, deliveries bool) Option {
+	return func(b *SSEHandler) {
+		b.tracer = tp.Tracer(tracerName)
+		b.traceDeliveries = deliveries
+	}
+}
+
+// Push back on producers while the clients can't keep up, instead of blocking
+// or dropping events: SendContext, TrySend and PublishEvent return
+// ErrBackpressure while the handler's queue is full or, for the last event
+// broadcast, at least ratio (between 0 and 1) of its clients had full
+// buffers. Send keeps blocking as usual. While producers are pushed back, the
+// clients are checked again every 100 milliseconds. The optional hook f is
+// called by the event loop whenever producers start or stop being pushed
+// back, and must not block.
+func WithBackpressure(ratio float64, f func(pushedBack bool)) Option {
+	return func(b *SSEHandler) {
+		b.backpressure = ratio
+		b.onBackpressure = f
+	}
+}
+
+// Give the events sent out without an ID their IDs with g, instead of the
+// handler's counter, so that they can match existing identifiers. The IDs
+// are used as they are, without the suffix added with a broker. See
+// IDGenerator.
+func WithIDGenerator(g IDGenerator) Option {
+	return func(b *SSEHandler) {
+		b.idGenerator = g
+	}
+}
+
+// Encode the objects sent out with e, instead of as JSON, such as with
+// SendJSON. See Encoder.
+func WithEncoder(e Encoder) Option {
+	return func(b *SSEHandler) {
+		b.encoder = e
+	}
+}
+
+// Encode the objects published to topic with e, instead of with the handler's
+// encoder. See PublishObject.
+func WithTopicEncoder(topic string, e Encoder) Option {
+	return func(b *SSEHandler) {
+		if b.topicEncoders == nil {
+			b.topicEncoders = make(map[string]Encoder)
+		}
+		b.topicEncoders[topic] = e
+	}
+}
+
+// Give the events of topic the priority p, unless they have one of their own.
+// See Priority.
+func WithTopicPriority(topic string, p Priority) Option {
+	return func(b *SSEHandler) {
+		if b.topicPriorities == nil {
+			b.topicPriorities = make(map[string]Priority)
+		}
+		b.topicPriorities[topic] = p
+	}
+}
+
+// Call f to get the priority of events without one of their own, or of their
+// topic. See Priority.
+func WithPriority(f func(e Event) Priority) Option {
+	return func(b *SSEHandler) {
+		b.priority = f
+	}
+}
+
+// Send new clients the latest event sent out for each of their topics, or
+// for each key within them if set, before any new ones, so that they can show
+// the current state right away. Clients reconnecting with a Last-Event-ID
+// header are sent the events they missed instead. Up to maxKeys keys are kept
+// for each topic, if above zero, dropping the least recently sent ones. Stale
+// events are dropped, see Event.Expires, as are the events of topics once no
+// client is subscribed to them anymore.
+func WithLatest(maxKeys int) Option {
+	return func(b *SSEHandler) {
+		b.latest = newLatestCache(maxKeys)
+	}
+}
+
+// Send the events of the topics as RFC 6902 JSON Patches, for large JSON
+// documents that change a little at a time. Each event sent on them carries
+// the topic's full state, which the handler compares with the last state sent
+// out, sending a "patch" event with the changes instead. A "snapshot" event
+// with the full state is sent for the first state, after every snapshotEvery
+// patches if above zero, and whenever the patch would be larger than the state
+// itself, so clients can resync. New clients are sent a snapshot of each
+// topic's last state, instead of replaying its patches.
+func WithJSONPatch(snapshotEvery int, topics ...string) Option {
+	return func(b *SSEHandler) {
+		if b.patchTopics == nil {
+			b.patchTopics = make(map[string]bool)
+		}
+		for _, t := range topics {
+			b.patchTopics[t] = true
+		}
+		b.snapshotEvery = snapshotEvery
+	}
+}
+
+// Send the events of the topics as numbered deltas, for clients keeping a
+// copy of some state, such as a document being edited together. New clients
+// are sent a "snapshot" event with the state of each topic they're subscribed
+// to, as loaded by f, followed by "delta" events with the changes sent since.
+// The data of both is a JSON object with the sequence number, "seq", and the
+// event's own data, "data". Deltas are numbered by their Seq, or one after the
+// last delta on the topic if it's not set. Deltas already included in a
+// client's snapshot are skipped, and a fresh snapshot is loaded for clients
+// that miss any deltas, such as after falling behind. f should be quick, as it
+// holds up the client's writes while it runs.
+func WithSnapshots(f func(ctx context.Context, topic string) (Snapshot, error), topics ...string) Option {
+	return func(b *SSEHandler) {
+		if b.snapshotTopics == nil {
+			b.snapshotTopics = make(map[string]bool)
+		}
+		for _, t := range topics {
+			b.snapshotTopics[t] = true
+		}
+		b.snapshot = f
+	}
+}
+
+// Number the events sent out on each topic, so clients can tell if they've
+// missed any. The data of each event is sent as a JSON object with its
+// sequence number within its topic, "seq", and the event's own data, "data",
+// as a JSON document or else a string. Events are numbered by their Seq, or
+// one after the last event on the topic if it's not set. Clients reconnecting
+// with a Last-Event-ID header are sent a ReplayEvent after the events they
+// missed, telling them whether they should refetch their state.
+func WithSequenceNumbers() Option {
+	return func(b *SSEHandler) {
+		b.sequenceAll = true
+	}
+}
+
+// Keep the events written to each client until it acknowledges them with the
+// AckHandler, sending them again when a client with the same ID reconnects,
+// for at-least-once delivery. Client IDs must then stay the same between
+// connections, see WithClientID. At most limit events are kept for each client
+// if above zero, dropping the oldest, and the events of clients neither sent
+// nor acknowledging any events for longer than retain are dropped, if above
+// zero. Only events with IDs can be acknowledged.
+func WithAcks(limit int, retain time.Duration) Option {
+	return func(b *SSEHandler) {
+		b.acks = newAckStore(limit, retain)
+	}
+}
+
+// Keep the events sent with SendToUser to users without any clients connected
+// in the inbox, sending them to the user's first client when one connects,
+// before any events replayed from history. See Inbox and NewMemoryInbox.
+// Users are only looked up among the clients of this instance, so with several
+// instances an inbox shared by them needs sticky sessions, such as routing
+// each user to the same instance by their ID, or else events sent to a user
+// connected to another instance are kept until the user next connects.
+func WithInbox(i Inbox) Option {
+	return func(b *SSEHandler) {
+		b.inbox = i
+	}
+}
+
+// Call f for each new client, before it's subscribed, to load the events it's
+// sent before any others, such as recent rows from a database. They're sent
+// as they are, without being kept in history or given IDs, followed by any
+// events replayed from history. The client is subscribed without them if an
+// error is returned. ctx is the client's request context.
+func WithBackfill(f func(ctx context.Context, info ClientInfo) ([]Event, error)) Option {
+	return func(b *SSEHandler) {
+		b.backfill = f
+	}
+}
+
+// Send e to all clients before disconnecting them, when the handler is closed.
+func WithShutdownEvent(e Event) Option {
+	return func(b *SSEHandler) {
+		b.shutdownEvent = &e
+	}
+}
+
+// Send e to all clients when the handler is drained, instead of the default
+// "server-closing" event. See Drain.
+func WithDrainEvent(e Event) Option {
+	return func(b *SSEHandler) {
+		b.drainEvent = &e
+	}
+}
+
+// Hold back up to n events, or batches of events, sent while the handler is
+// paused, sending them out once it's resumed. Any others are dropped, as are
+// all events sent while paused without this. See Pause.
+func WithPauseBuffer(n int) Option {
+	return func(b *SSEHandler) {
+		b.pauseBuffer = n
+	}
+}
+
+// Buffer up to n messages for each client, so that a slow client doesn't hold
+// up sending messages to the other clients until its buffer is full. Clients
+// are unbuffered by default.
+func WithClientBuffer(n int) Option {
+	return reloadable(func(b *SSEHandler) {
+		b.clientBuffer = n
+	})
+}
+
+// Write messages to clients using a pool of n writers, instead of each
+// client's own request handler. Bounds the number of concurrent writes, while
+// the event loop only has to push messages into the clients' buffers. Clients
+// get a buffer of at least one message.
+func WithWriters(n int) Option {
+	return func(b *SSEHandler) {
+		b.writers = n
+	}
+}
+
+// Decide what to do with new messages when a client's buffer is full, instead
+// of blocking until there's room. Only useful together with WithClientBuffer,
+// as otherwise all clients are considered slow while they're busy writing.
+func WithSlowClientPolicy(p SlowClientPolicy) Option {
+	return func(b *SSEHandler) {
+		b.slowClientPolicy = p
+	}
+}
+
+// Split up the clients in n shards, each with its own worker pushing events
+// to its clients, so that broadcasting to many clients runs in parallel.
+// Filters and authorization hooks are called concurrently, by the workers of
+// different shards. Defaults to a single shard, without any workers.
+func WithShards(n int) Option {
+	return func(b *SSEHandler) {
+		if n > 0 {
+			b.numShards = n
+		}
+	}
+}
+
+// Use f for getting the user IDs of new clients, so events can be sent to all
+// clients of a user with SendToUser. Clients with an empty user ID aren't
+// associated with any user.
+func WithUserID(f func(*gin.Context) string) Option {
+	return func(b *SSEHandler) {
+		b.userID = f
+	}
+}
+
+// Send out a "presence" event to topic whenever a user connects their first
+// client or disconnects their last one, with data such as
+// {"user":"alice","status":"join"} or "leave". Requires user IDs, see
+// WithUserID. Presence is tracked by each instance for its own clients, so
+// with a broker a user connected to several instances can be announced more
+// than once. With WithTenants the events go to the tenant's own topic, see
+// TenantTopic. See Presence.
+func WithPresence(topic string) Option {
+	return func(b *SSEHandler) {
+		b.presenceTopic = topic
+	}
+}
+
+// Use f for getting metadata about new clients, such as values from their
+// headers or query parameters. The metadata is given to the hooks, along with
+// each client's IP address and user agent, and listed by the admin endpoints.
+func WithMetadata(f func(*gin.Context) map[string]interface{}) Option {
+	return func(b *SSEHandler) {
+		b.metadata = f
+	}
+}
+
+// Count the connected clients by the value of their metadata under key, in
+// the metric "clients_by_<key>" labelled by key, such as clients by "region"
+// or "plan". The key must be a valid prometheus label name. Clients without
+// the key are counted under an empty value. Keep the number of different
+// values small, as each gets a time series of its own. See WithMetadata.
+func WithMetadataLabel(key string) Option {
+	return func(b *SSEHandler) {
+		b.metadataLabel = key
+	}
+}
+
+// Isolate the clients of each tenant, such as each customer, as given by key.
+// key is called after WithAuthorize, with the info it returned, so the tenant
+// can be taken from the client's verified claims instead of anything the
+// client sends. A client's topics, ID and user ID are namespaced by its
+// tenant, see TenantTopic, so that clients of other tenants can't be reached
+// even if their IDs are the same. Events are sent to a tenant's clients with
+// SendToTenant, or to single clients and users with SendToTenantClient and
+// SendToTenantUser.
+// Clients without a tenant, or whose tenant has "/", "+" or "#" in it, are
+// refused with 403 Forbidden. limits gives the quotas of each tenant, if set,
+// called the first time a tenant is seen. The clients, events and refusals of
+// each tenant are counted by the metrics. Up to 10000 tenants are kept track
+// of at once, forgetting those without clients once their quotas have filled
+// up again, and clients of new tenants are refused with 503 Service
+// Unavailable while there's no room. Events sent without a topic, such as
+// with Send, still reach the clients of all tenants.
+func WithTenants(key func(c *gin.Context, info ClientInfo) string, limits func(tenant string) TenantLimits) Option {
+	return func(b *SSEHandler) {
+		b.tenants = &tenants{
+			key:     key,
+			limits:  limits,
+			max:     maxTenants,
+			tenants: make(map[string]*tenant),
+		}
+	}
+}
+
+// Use f for creating the IDs of new clients, instead of random ones. The IDs
+// must be unique among the connected clients.
+func WithClientID(f func(*gin.Context) string) Option {
+	return func(b *SSEHandler) {
+		b.clientID = f
+	}
+}
+
+// Allow cross-origin clients to subscribe from the origins of c, such as an
+// EventSource on another site. Clients from other origins are refused with
+// 403 Forbidden, while requests without an Origin header are let through.
+// OPTIONS requests, such as preflights, are answered with 204 No Content, if
+// the subscribe handler is registered for OPTIONS as well as GET. WebSocket
+// clients are checked too, but their upgrader decides on its own which origins
+// it accepts, see WithWebSocketUpgrader. Panics if c allows credentials for
+// the "*" origin.
+func WithCORS(c CORS) Option {
+	return func(b *SSEHandler) {
+		b.cors = newCORS(c)
+	}
+}
@@ -0,0 +1,66 @@
+package ssehandler
+
+// Hold off sending out events, such as during maintenance, until Resume is
+// called. Clients stay connected and keep getting heartbeats meanwhile, while
+// the events sent are held back, up to the number set by WithPauseBuffer, and
+// any others are dropped. Clients connecting meanwhile are still sent the
+// events they missed.
+func (b *SSEHandler) Pause() {
+	b.pushPause(true)
+}
+
+// Send out the events held back since Pause was called, in order, and go back
+// to sending out events as they come.
+func (b *SSEHandler) Resume() {
+	b.pushPause(false)
+}
+
+// Check if the handler is paused, see Pause.
+func (b *SSEHandler) Paused() bool {
+	return b.pausedFlag.Load()
+}
+
+func (b *SSEHandler) pushPause(pause bool) {
+	select {
+	case b.pauses <- pause:
+	case <-b.quit:
+	}
+}
+
+// Pause or resume sending out events. Only called by the event loop.
+func (b *SSEHandler) setPaused(pause bool) {
+	if pause == b.paused {
+		return
+	}
+	b.paused = pause
+	b.pausedFlag.Store(pause)
+	if pause {
+		b.logger.Info("Paused sending events")
+		return
+	}
+	held := b.held
+	b.held = nil
+	b.logger.Info("Resumed sending events", "held", len(held))
+	for _, send := range held {
+		send()
+	}
+}
+
+// Hold back sending out the events while paused, calling send once resumed,
+// or drop them if too many are held already. Returns false if not paused.
+// Only called by the event loop.
+func (b *SSEHandler) hold(send func(), events ...Event) bool {
+	if !b.paused {
+		return false
+	}
+	if len(b.held) < b.pauseBuffer {
+		b.held = append(b.held, send)
+		return true
+	}
+	for _, e := range events {
+		b.logger.Debug("Dropped event while paused", "event", e.ID)
+		b.report(e.ID, BroadcastResult{})
+		b.deadEvent(DeadLetter{Event: e, Reason: "paused"})
+	}
+	return true
+}
@@ -0,0 +1,28 @@
+package ssehandler
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPause(t *testing.T) {
+	b := NewSSEHandler(WithPauseBuffer(1))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	b.Pause()
+	b.Send(Event{ID: "1"})
+	b.Send(Event{ID: "2"})
+	b.Sync(context.Background())
+	if !b.Paused() {
+		t.Error("not paused")
+	}
+	if got := b.Stats().EventsSent; got != 0 {
+		t.Errorf("got %d events sent while paused", got)
+	}
+
+	b.Resume()
+	b.Sync(context.Background())
+	if got := b.Stats().EventsSent; got != 1 {
+		t.Errorf("got %d events sent after resuming", got)
+	}
+}
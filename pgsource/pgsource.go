@@ -0,0 +1,148 @@
+// Postgres source for the SSE handler, for driving real-time updates from
+// database triggers with LISTEN/NOTIFY.
+
+package pgsource
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	ssehandler "github.com/lmas/gin-sse"
+)
+
+// Bounds of the delay before reconnecting, after losing the connection.
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// A Source listens on Postgres channels and sends out their notifications as
+// events, with the payload as data, to the clients subscribed to the topic
+// of the same name as the channel by default.
+type Source struct {
+	connString string
+	channels   []string
+	handler    *ssehandler.SSEHandler
+	topic      func(channel string) string
+	event      func(channel string) string
+	logger     ssehandler.Logger
+}
+
+// An Option configures a Source, see New.
+type Option func(*Source)
+
+// Use f for getting the topic of the events sent out for the notifications
+// on each channel, instead of the channel's name. Notifications on channels
+// for which f returns an empty topic are sent to all clients.
+func WithTopic(f func(channel string) string) Option {
+	return func(s *Source) {
+		s.topic = f
+	}
+}
+
+// Use f for getting the name of the events sent out for the notifications on
+// each channel. Events are sent without a name by default.
+func WithEventName(f func(channel string) string) Option {
+	return func(s *Source) {
+		s.event = f
+	}
+}
+
+// Log errors while listening to l. Nothing is logged by default.
+func WithLogger(l ssehandler.Logger) Option {
+	return func(s *Source) {
+		s.logger = l
+	}
+}
+
+// Make a new Source listening on the channels of the Postgres database at
+// connString, sending out their notifications with h.
+func New(connString string, h *ssehandler.SSEHandler, channels []string, opts ...Option) *Source {
+	s := &Source{
+		connString: connString,
+		channels:   channels,
+		handler:    h,
+		topic:      func(channel string) string { return channel },
+		event:      func(string) string { return "" },
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Listen for notifications and send them out, until ctx is done or the
+// handler is closed. The connection is reopened whenever it's lost, with an
+// increasing delay. Notifications sent while the source isn't connected are
+// missed, as Postgres doesn't keep them. Returns ctx's error, or
+// ssehandler.ErrNotRunning once the handler is closed.
+func (s *Source) Run(ctx context.Context) error {
+	backoff := minBackoff
+	for {
+		err := s.listen(ctx, func() { backoff = minBackoff })
+		if errors.Is(err, ssehandler.ErrNotRunning) || ctx.Err() != nil {
+			return err
+		}
+		s.logError("Error while listening on Postgres", "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// Connect and listen on the channels, sending out any notifications until
+// the connection fails. Calls listening once it's listening on all channels.
+func (s *Source) listen(ctx context.Context, listening func()) error {
+	conn, err := pgx.Connect(ctx, s.connString)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	for _, ch := range s.channels {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{ch}.Sanitize()); err != nil {
+			return err
+		}
+	}
+	listening()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		e := s.eventOf(n)
+		if err := s.handler.SendContext(ctx, e); err != nil && !errors.Is(err, ssehandler.ErrCircuitOpen) {
+			if errors.Is(err, ssehandler.ErrNotRunning) || ctx.Err() != nil {
+				return err
+			}
+			// Such as ErrBackpressure, in which case the
+			// notification is dropped as there's no way to get it
+			// back later.
+			s.logError("Error while sending Postgres notification", "channel", n.Channel, "err", err)
+		}
+	}
+}
+
+// Make the event sent out for a notification.
+func (s *Source) eventOf(n *pgconn.Notification) ssehandler.Event {
+	return ssehandler.Event{
+		Event: s.event(n.Channel),
+		Topic: s.topic(n.Channel),
+		Data:  []byte(n.Payload),
+	}
+}
+
+func (s *Source) logError(msg string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.Error(msg, args...)
+	}
+}
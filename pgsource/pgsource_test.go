@@ -0,0 +1,27 @@
+package pgsource
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestEventOf(t *testing.T) {
+	n := &pgconn.Notification{Channel: "orders", Payload: `{"id":1}`}
+	tests := []struct {
+		opts             []Option
+		topic, eventName string
+	}{
+		{nil, "orders", ""},
+		{[]Option{
+			WithTopic(func(string) string { return "" }),
+			WithEventName(func(channel string) string { return channel }),
+		}, "", "orders"},
+	}
+	for _, tt := range tests {
+		e := New("", nil, []string{"orders"}, tt.opts...).eventOf(n)
+		if e.Topic != tt.topic || e.Event != tt.eventName || string(e.Data) != `{"id":1}` {
+			t.Errorf("got %+v", e)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package ssehandler
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A stream collecting the events for a single long-polling request, which are
+// then sent all at once as a JSON array.
+type pollStream struct {
+	c       *gin.Context
+	timeout time.Duration
+
+	events [][]byte
+
+	// Closed once the first event has been collected, or the timeout ran
+	// out, ending the request.
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// Get a gin handler for long-polling clients, for environments where
+// streaming doesn't work at all. A client sends the ID of the last event it
+// saw in the "since" query parameter and receives the events it missed, as
+// kept in the event store, as a JSON array of objects made by FormatJSON. If
+// there are none, the request waits for up to timeout for the next event.
+// An empty array is sent if none arrived meanwhile. The clients are otherwise
+// handled as with Subscribe.
+func (b *SSEHandler) PollHandler(timeout time.Duration, topics ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b.subscribe(c, nil, topics, func(c *gin.Context, cl *client) bool {
+			cl.lastEventID = c.Query("since")
+			cl.w = &pollStream{c: c, timeout: timeout, done: make(chan struct{})}
+			cl.format = FormatJSON
+			return true
+		})
+	}
+}
+
+func (s *pollStream) finish() {
+	s.doneOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *pollStream) Open() (<-chan struct{}, error) {
+	ctx := s.c.Request.Context()
+	go func() {
+		t := time.NewTimer(s.timeout)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+		case <-s.done:
+		}
+		s.finish()
+	}()
+	return s.done, nil
+}
+
+// Collect an event. Any missed events are all written at once by the event
+// loop, before the request is ended.
+func (s *pollStream) Write(p []byte) (int, error) {
+	s.events = append(s.events, append([]byte(nil), p...))
+	s.finish()
+	return len(p), nil
+}
+
+// Nothing is sent until the request ends.
+func (s *pollStream) Flush() error { return nil }
+
+func (s *pollStream) SetWriteDeadline(time.Time) error { return nil }
+
+// The request ends long before any proxy would time it out.
+func (s *pollStream) Ping() error { return nil }
+
+// Send the collected events.
+func (s *pollStream) Close() error {
+	s.finish()
+	body := append([]byte("["), bytes.Join(s.events, []byte(","))...)
+	body = append(body, ']')
+	s.c.Data(http.StatusOK, "application/json", body)
+	return nil
+}
@@ -0,0 +1,73 @@
+package ssehandler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPollHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	tests := []struct {
+		name  string
+		since string
+		send  string // Sent once the client is waiting, if set
+		want  []string
+	}{
+		{"timeout", "3", "", []string{}},
+		{"long poll", "3", "4", []string{"4"}},
+		{"cursor", "1", "", []string{"2", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewSSEHandler(WithReplay(10))
+			b.HandleEvents()
+			defer b.Close(context.Background())
+			for _, id := range []string{"1", "2", "3"} {
+				b.Send(Event{ID: id, Data: []byte(id)})
+			}
+			b.Sync(context.Background())
+			r := gin.New()
+			r.GET("/poll", b.PollHandler(50*time.Millisecond))
+
+			done := make(chan *httptest.ResponseRecorder)
+			go func() {
+				rec := httptest.NewRecorder()
+				r.ServeHTTP(rec, httptest.NewRequest("GET", "/poll?since="+tt.since, nil))
+				done <- rec
+			}()
+			if tt.send != "" {
+				for b.ClientCount() < 1 {
+					time.Sleep(time.Millisecond)
+				}
+				b.Send(Event{ID: tt.send, Data: []byte(tt.send)})
+			}
+			rec := <-done
+
+			var events []jsonEvent
+			if err := json.Unmarshal(rec.Body.Bytes(), &events); err != nil {
+				t.Fatalf("got %q: %v", rec.Body, err)
+			}
+			got := make([]string, 0, len(events))
+			for _, e := range events {
+				got = append(got, e.ID)
+			}
+			if rec.Code != http.StatusOK || len(got) != len(tt.want) {
+				t.Fatalf("got %d %q, want %q", rec.Code, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %q, want %q", got, tt.want)
+				}
+			}
+			if b.ClientCount() != 0 {
+				t.Errorf("got %d clients left", b.ClientCount())
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package ssehandler
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A user present on the handler, see Presence.
+type UserInfo struct {
+	// ID of the user, as identified by WithUserID or WithAuthorize.
+	ID string `json:"id"`
+
+	// Number of the user's connected clients.
+	Clients int `json:"clients"`
+
+	// Time the user's oldest client connected.
+	Since time.Time `json:"since"`
+}
+
+// The data of a presence event, see WithPresence.
+type presenceEvent struct {
+	User   string `json:"user"`
+	Status string `json:"status"`
+}
+
+// A request for the users present in a topic, see Presence.
+type presenceRequest struct {
+	topic string
+	reply chan []UserInfo
+}
+
+// Get the users with clients connected to this handler and subscribed to
+// topic, or all connected users if the topic is empty, sorted by ID. Clients
+// without a user aren't included. Returns nothing if the event loop isn't
+// running.
+func (b *SSEHandler) Presence(topic string) []UserInfo {
+	if !b.running.Load() {
+		return nil
+	}
+	req := presenceRequest{topic: topic, reply: make(chan []UserInfo, 1)}
+	select {
+	case b.presenceRequests <- req:
+		return <-req.reply
+	case <-b.done:
+		return nil
+	}
+}
+
+// Find the users present in a topic. Only called by the event loop.
+func (b *SSEHandler) presence(topic string) []UserInfo {
+	var users []UserInfo
+	for id, clients := range b.users {
+		u := UserInfo{ID: id}
+		for s := range clients {
+			if topic != "" && !s.subscribed(topic) {
+				continue
+			}
+			u.Clients++
+			if u.Since.IsZero() || s.connected.Before(u.Since) {
+				u.Since = s.connected
+			}
+		}
+		if u.Clients > 0 {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	return users
+}
+
+// Send out a presence event for the user of a client, if enabled, on the
+// presence topic of its tenant, if any. Only called by the event loop, so the
+// event is sent from elsewhere, through any middleware and broker.
+func (b *SSEHandler) announcePresence(s *client, status string) {
+	if b.presenceTopic == "" {
+		return
+	}
+	select {
+	case <-b.quit:
+		// Everyone's leaving
+		return
+	default:
+	}
+	user, topic := s.user, b.presenceTopic
+	if s.tenant != "" {
+		user = strings.TrimPrefix(user, s.tenant+"/")
+		topic = TenantTopic(s.tenant, topic)
+	}
+	data, _ := json.Marshal(presenceEvent{User: user, Status: status})
+	e := Event{Event: "presence", Topic: topic, Data: data}
+	go b.Send(e)
+}
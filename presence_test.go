@@ -0,0 +1,48 @@
+package ssehandler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPresence(t *testing.T) {
+	b := NewSSEHandler()
+	now := time.Now()
+	clients := []*client{
+		{user: "bob", topics: []string{"a"}, connected: now},
+		{user: "alice", topics: []string{"a", "b"}, connected: now.Add(time.Second)},
+		{user: "alice", topics: []string{"b"}, connected: now},
+		{topics: []string{"a"}, connected: now},
+	}
+	for _, s := range clients {
+		if s.user == "" {
+			continue
+		}
+		if b.users[s.user] == nil {
+			b.users[s.user] = make(map[*client]bool)
+		}
+		b.users[s.user][s] = true
+	}
+
+	tests := []struct {
+		topic string
+		want  []UserInfo
+	}{
+		{"", []UserInfo{{"alice", 2, now}, {"bob", 1, now}}},
+		{"a", []UserInfo{{"alice", 1, now.Add(time.Second)}, {"bob", 1, now}}},
+		{"b", []UserInfo{{"alice", 2, now}}},
+		{"c", nil},
+	}
+	for _, tt := range tests {
+		got := b.presence(tt.topic)
+		if len(got) != len(tt.want) {
+			t.Errorf("topic %q: got %v, want %v", tt.topic, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("topic %q: got %v, want %v", tt.topic, got, tt.want)
+			}
+		}
+	}
+}
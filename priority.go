@@ -0,0 +1,78 @@
+package ssehandler
+
+// The Priority of an event decides which events are dropped for a client that
+// falls behind, once its buffer is full, see WithClientBuffer. Low priority
+// events are dropped right away, instead of being handled by the slow client
+// policy. Critical events make room by dropping the oldest of the events in
+// the buffer with the lowest priority below critical, before the policy
+// kicks in. That's only done with a pool of writers, see WithWriters, while
+// none of them is writing to the client. Otherwise the oldest event in the
+// buffer is dropped.
+type Priority int
+
+const (
+	// Dropped first, such as for frequent updates that are soon outdated.
+	PriorityLow Priority = -1
+
+	// The default.
+	PriorityNormal Priority = 0
+
+	// Dropped last, such as for alerts.
+	PriorityCritical Priority = 1
+)
+
+// Get the priority of an event, by itself or else by its topic or the
+// handler's WithPriority.
+func (b *SSEHandler) priorityOf(e Event) Priority {
+	if e.Priority != PriorityNormal {
+		return e.Priority
+	}
+	if p, found := b.topicPriorities[e.Topic]; found {
+		return p
+	}
+	if b.priority != nil {
+		return b.priority(e)
+	}
+	return PriorityNormal
+}
+
+// Make room in a client's full buffer for a critical message, by dropping the
+// oldest of the messages with the lowest priority below critical.
+func (b *SSEHandler) preempt(s *client) {
+	if b.writers < 1 || !s.mu.TryLock() {
+		// The messages are taken out of the buffer and put back, so
+		// no one else may take any meanwhile, which the client's
+		// request handler does without the lock. Dropping the oldest
+		// keeps the rest in order.
+		select {
+		case old := <-s.events:
+			b.dropMessage(s, old)
+		default:
+		}
+		return
+	}
+	defer s.mu.Unlock()
+	queued := make([]message, 0, len(s.events))
+	for taken := true; taken; {
+		select {
+		case m := <-s.events:
+			queued = append(queued, m)
+		default:
+			taken = false
+		}
+	}
+	victim := -1
+	for i, m := range queued {
+		if m.priority < PriorityCritical && (victim < 0 || m.priority < queued[victim].priority) {
+			victim = i
+		}
+	}
+	for i, m := range queued {
+		if i != victim {
+			s.events <- m
+		}
+	}
+	if victim >= 0 {
+		b.dropMessage(s, queued[victim])
+	}
+}
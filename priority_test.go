@@ -0,0 +1,63 @@
+package ssehandler
+
+import (
+	"testing"
+)
+
+func TestPriorityOf(t *testing.T) {
+	b := NewSSEHandler(WithTopicPriority("alerts", PriorityCritical), WithPriority(func(e Event) Priority {
+		if e.Event == "tick" {
+			return PriorityLow
+		}
+		return PriorityNormal
+	}))
+	tests := []struct {
+		e    Event
+		want Priority
+	}{
+		{Event{}, PriorityNormal},
+		{Event{Topic: "alerts"}, PriorityCritical},
+		{Event{Topic: "alerts", Priority: PriorityLow}, PriorityLow},
+		{Event{Event: "tick"}, PriorityLow},
+		{Event{Event: "tick", Topic: "alerts"}, PriorityCritical},
+	}
+	for _, tt := range tests {
+		if got := b.priorityOf(tt.e); got != tt.want {
+			t.Errorf("%+v: got %v, want %v", tt.e, got, tt.want)
+		}
+	}
+}
+
+func TestPriorityDelivery(t *testing.T) {
+	tests := []struct {
+		writers int
+		want    string
+	}{
+		// The lowest priority message is dropped to make room
+		{1, "13C"},
+		// Only the oldest message can be dropped
+		{0, "23C"},
+	}
+	for _, tt := range tests {
+		b := NewSSEHandler(WithWriters(tt.writers), WithSlowClientPolicy(DropNewest))
+		s := &client{events: make(chan message, 3)}
+		for _, m := range []message{
+			{event: Event{ID: "1"}},
+			{event: Event{ID: "2"}, priority: PriorityLow},
+			{event: Event{ID: "3"}},
+			{event: Event{ID: "L"}, priority: PriorityLow},
+			{event: Event{ID: "N"}},
+			{event: Event{ID: "C"}, priority: PriorityCritical},
+		} {
+			b.offer(s, m)
+		}
+		close(s.events)
+		var got string
+		for m := range s.events {
+			got += m.event.ID
+		}
+		if got != tt.want {
+			t.Errorf("%d writers: got %q, want %q", tt.writers, got, tt.want)
+		}
+	}
+}
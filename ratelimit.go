@@ -0,0 +1,60 @@
+package ssehandler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// Limits the rate of new subscriptions, using a token bucket per key. See
+// WithRateLimit.
+type rateLimiter struct {
+	limit rate.Limit
+	burst int
+	key   func(*gin.Context) string
+
+	mu        sync.Mutex
+	limiters  map[string]*rate.Limiter
+	lastSweep time.Time
+}
+
+func newRateLimiter(limit rate.Limit, burst int) *rateLimiter {
+	return &rateLimiter{
+		limit:     limit,
+		burst:     burst,
+		key:       (*gin.Context).ClientIP,
+		limiters:  make(map[string]*rate.Limiter),
+		lastSweep: time.Now(),
+	}
+}
+
+// Check if the client is allowed to subscribe.
+func (r *rateLimiter) allow(c *gin.Context) bool {
+	key := r.key(c)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sweep()
+	lim, found := r.limiters[key]
+	if !found {
+		lim = rate.NewLimiter(r.limit, r.burst)
+		r.limiters[key] = lim
+	}
+	return lim.Allow()
+}
+
+// Forget about the keys whose buckets have filled up again, now and then, so
+// the map doesn't grow forever. They would start over with a full bucket
+// anyway.
+func (r *rateLimiter) sweep() {
+	if time.Since(r.lastSweep) < time.Minute {
+		return
+	}
+	r.lastSweep = time.Now()
+	for key, lim := range r.limiters {
+		if lim.Tokens() >= float64(r.burst) {
+			delete(r.limiters, key)
+		}
+	}
+}
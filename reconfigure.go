@@ -0,0 +1,92 @@
+package ssehandler
+
+import "time"
+
+// The settings that can be changed while the handler is running, see
+// Reconfigure.
+type settings struct {
+	heartbeat    time.Duration
+	retry        time.Duration
+	writeTimeout time.Duration
+	clientBuffer int
+	maxClients   int
+
+	// Closed once the settings have been replaced, letting the connected
+	// clients pick up the new ones.
+	replaced chan struct{}
+}
+
+// Get the settings the handler was configured with.
+func (b *SSEHandler) configured() *settings {
+	s := &settings{
+		heartbeat:    b.heartbeat,
+		retry:        b.retry,
+		writeTimeout: b.writeTimeout,
+		clientBuffer: b.clientBuffer,
+		maxClients:   b.maxClients,
+		replaced:     make(chan struct{}),
+	}
+	if b.writers > 0 && s.clientBuffer < 1 {
+		// The writers need somewhere to pick up messages from
+		s.clientBuffer = 1
+	}
+	return s
+}
+
+// Get the current settings.
+func (b *SSEHandler) settings() *settings {
+	return b.live.Load()
+}
+
+// Change the settings of a running handler, without dropping any clients. The
+// options are applied all at once, and only these can be given: WithHeartbeat,
+// for all clients; WithRetry, WithClientBuffer and WithMaxClients, for the
+// clients connecting afterwards; and WithWriteTimeout, for the writes started
+// afterwards. Returns ErrNotReloadable, without changing anything, if any
+// other option is given.
+func (b *SSEHandler) Reconfigure(opts ...Option) error {
+	b.reconfiguring.Lock()
+	defer b.reconfiguring.Unlock()
+	old := b.settings()
+	// The options are applied to a handler only holding the settings, which
+	// is thrown away unless they're all reloadable
+	next := &SSEHandler{
+		heartbeat:    old.heartbeat,
+		retry:        old.retry,
+		writeTimeout: old.writeTimeout,
+		clientBuffer: old.clientBuffer,
+		maxClients:   old.maxClients,
+		writers:      b.writers,
+	}
+	for _, o := range opts {
+		if !next.reload(o) {
+			return ErrNotReloadable
+		}
+	}
+	b.live.Store(next.configured())
+	close(old.replaced)
+	b.logger.Info("Handler reconfigured")
+	return nil
+}
+
+// Mark an option as one that can be given to Reconfigure, as it only changes
+// the settings.
+func reloadable(o Option) Option {
+	return func(b *SSEHandler) {
+		o(b)
+		b.reloaded = true
+	}
+}
+
+// Apply an option, reporting if it's marked as reloadable. Other options might
+// panic, as the handler only holds the settings.
+func (b *SSEHandler) reload(o Option) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	b.reloaded = false
+	o(b)
+	return b.reloaded
+}
@@ -0,0 +1,76 @@
+package ssehandler
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReconfigure(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	b := NewSSEHandler()
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	r := gin.New()
+	r.GET("/events", b.Handler())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	for b.ClientCount() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	tests := []struct {
+		opts []Option
+		want error
+	}{
+		{[]Option{WithHeartbeat(time.Hour), WithHeaders(http.Header{"X-Refused": {"1"}})}, ErrNotReloadable},
+		{[]Option{WithTopicThrottle("t", 1, 1)}, ErrNotReloadable},
+		{[]Option{WithBroker(downBroker{})}, ErrNotReloadable},
+		{[]Option{WithHeaders(http.Header{"X-Ignored": nil})}, ErrNotReloadable},
+		{[]Option{func(b *SSEHandler) {}}, ErrNotReloadable},
+		{[]Option{WithRetry(time.Second), WithClientBuffer(5), WithWriteTimeout(time.Second)}, nil},
+		{[]Option{WithHeartbeat(10 * time.Millisecond), WithMaxClients(1)}, nil},
+	}
+	for _, tt := range tests {
+		if err := b.Reconfigure(tt.opts...); err != tt.want {
+			t.Errorf("got %v, want %v", err, tt.want)
+		}
+	}
+	if got := b.Health().MaxClients; got != 1 {
+		t.Errorf("got max clients %d", got)
+	}
+	pinged := make(chan bool)
+	go func() {
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			if sc.Text() == ": ping" {
+				pinged <- true
+				return
+			}
+		}
+	}()
+	select {
+	case <-pinged:
+	case <-time.After(time.Second):
+		t.Error("connected client got no heartbeat")
+	}
+
+	more, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	more.Body.Close()
+	if more.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got %d over the new limit", more.StatusCode)
+	}
+}
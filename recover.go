@@ -0,0 +1,28 @@
+package ssehandler
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// A PanicError is reported for a panic recovered by the handler, such as in a
+// hook, filter or formatter, see WithOnError.
+type PanicError struct {
+	// Where the panic was recovered, such as "event loop".
+	Where string
+
+	// Value passed to panic, and the stack of the goroutine that panicked.
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %s: %v", e.Where, e.Value)
+}
+
+// Report a recovered panic to the logger and the error hook.
+func (b *SSEHandler) recovered(where string, v interface{}) {
+	err := &PanicError{Where: where, Value: v, Stack: debug.Stack()}
+	b.logger.Error("Recovered from panic", "in", where, "panic", v, "stack", string(err.Stack))
+	b.reportError(err)
+}
@@ -0,0 +1,59 @@
+package ssehandler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRecoverEventLoop(t *testing.T) {
+	errs := make(chan error, 1)
+	b := NewSSEHandler(WithReplay(10), WithOnError(func(err error) { errs <- err }),
+		WithFormatter(func(e Event) []byte {
+			if string(e.Data) == "boom" {
+				panic("bad event")
+			}
+			return FormatEvent(e)
+		}))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+
+	b.Send(Event{ID: "1", Data: []byte("boom")})
+	b.Send(Event{ID: "2", Data: []byte("fine")})
+	if err := b.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := history(t, b); got != "12" {
+		t.Errorf("got %q after the panic", got)
+	}
+	select {
+	case err := <-errs:
+		var pe *PanicError
+		if !errors.As(err, &pe) || pe.Where != "event loop" || pe.Value != "bad event" || len(pe.Stack) < 1 {
+			t.Errorf("got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("panic wasn't reported")
+	}
+}
+
+func TestRecoverSync(t *testing.T) {
+	b := NewSSEHandler(WithFormatter(func(e Event) []byte { panic("bad event") }))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	// Queued events are sent out by Sync, which mustn't be left waiting
+	// when they panic.
+	b.messages <- Event{}
+	b.messages <- Event{}
+	done := make(chan error)
+	go func() { done <- b.Sync(context.Background()) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Sync didn't return")
+	}
+}
@@ -0,0 +1,76 @@
+// Redis pub/sub broker for the SSE handler, for broadcasting events across
+// multiple instances.
+
+package redisbroker
+
+import (
+	"context"
+	"encoding/json"
+
+	ssehandler "github.com/lmas/gin-sse"
+	"github.com/redis/go-redis/v9"
+)
+
+// A Broker publishes events to a redis pub/sub channel, shared by all
+// instances.
+type Broker struct {
+	client  redis.UniversalClient
+	channel string
+}
+
+// Make a new Broker using the redis channel.
+func New(client redis.UniversalClient, channel string) *Broker {
+	return &Broker{
+		client:  client,
+		channel: channel,
+	}
+}
+
+// Publish an event to all instances.
+func (b *Broker) Publish(ctx context.Context, e ssehandler.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, b.channel, data).Err()
+}
+
+// Subscribe to the events published by all instances, until ctx is done. The
+// redis client takes care of reconnecting if the connection is lost.
+func (b *Broker) Subscribe(ctx context.Context) (<-chan ssehandler.Event, error) {
+	sub := b.client.Subscribe(ctx, b.channel)
+	// Wait for the subscription to be confirmed, so no events are missed
+	// after returning.
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	events := make(chan ssehandler.Event)
+	go func() {
+		defer close(events)
+		defer sub.Close()
+		messages := sub.Channel()
+		for {
+			select {
+			case msg, open := <-messages:
+				if !open {
+					return
+				}
+				var e ssehandler.Event
+				if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+					// Not one of ours
+					continue
+				}
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
@@ -0,0 +1,173 @@
+package redisbroker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ssehandler "github.com/lmas/gin-sse"
+	"github.com/redis/go-redis/v9"
+)
+
+// A fake redis server, only knowing enough of pub/sub for the broker.
+type fakeRedis struct {
+	ln          net.Listener
+	mu          sync.Mutex
+	conns       map[net.Conn]bool
+	subscribers map[string]map[net.Conn]bool
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{
+		ln:          ln,
+		conns:       make(map[net.Conn]bool),
+		subscribers: make(map[string]map[net.Conn]bool),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns[conn] = true
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+		f.drop()
+	})
+	return f
+}
+
+// Close all connections, as when the server restarts.
+func (f *fakeRedis) drop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = make(map[net.Conn]bool)
+	f.subscribers = make(map[string]map[net.Conn]bool)
+}
+
+// Reply to the commands of a connection.
+func (f *fakeRedis) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		f.mu.Lock()
+		switch strings.ToUpper(args[0]) {
+		case "HELLO":
+			fmt.Fprint(conn, "-ERR unknown command\r\n")
+		case "PING":
+			fmt.Fprint(conn, "*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+		case "SUBSCRIBE":
+			for i, ch := range args[1:] {
+				if f.subscribers[ch] == nil {
+					f.subscribers[ch] = make(map[net.Conn]bool)
+				}
+				f.subscribers[ch][conn] = true
+				fmt.Fprintf(conn, "*3\r\n%s%s:%d\r\n", bulk("subscribe"), bulk(ch), i+1)
+			}
+		case "PUBLISH":
+			for sub := range f.subscribers[args[1]] {
+				fmt.Fprintf(sub, "*3\r\n%s%s%s", bulk("message"), bulk(args[1]), bulk(args[2]))
+			}
+			fmt.Fprintf(conn, ":%d\r\n", len(f.subscribers[args[1]]))
+		default:
+			fmt.Fprint(conn, "+OK\r\n")
+		}
+		f.mu.Unlock()
+	}
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+// Read a command sent as an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("bad command %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestBroker(t *testing.T) {
+	f := newFakeRedis(t)
+	client := redis.NewClient(&redis.Options{Addr: f.ln.Addr().String(), MaxRetries: -1})
+	defer client.Close()
+	b := New(client, "events")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := b.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Publish until an event arrives, as the subscription might be
+	// reconnecting.
+	roundTrip := func(data string) {
+		t.Helper()
+		deadline := time.After(5 * time.Second)
+		for {
+			b.Publish(ctx, ssehandler.Event{Topic: "orders", Data: []byte(data)})
+			select {
+			case e := <-events:
+				if e.Topic != "orders" || string(e.Data) != data {
+					t.Errorf("got %+v", e)
+				}
+				return
+			case <-time.After(50 * time.Millisecond):
+			case <-deadline:
+				t.Fatalf("no event %q received", data)
+			}
+		}
+	}
+	roundTrip("before")
+	f.drop()
+	roundTrip("after")
+
+	cancel()
+	for range events {
+		// Closed once ctx is done
+	}
+}
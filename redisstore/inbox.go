@@ -0,0 +1,84 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	ssehandler "github.com/lmas/gin-sse"
+	"github.com/redis/go-redis/v9"
+)
+
+// An Inbox keeps the events sent to offline users in redis lists, one for
+// each user, surviving restarts and shared by the handlers on all instances.
+// The handlers only look for a user's clients among their own, so users must
+// stick to one instance, see ssehandler.WithInbox.
+type Inbox struct {
+	client  redis.UniversalClient
+	prefix  string
+	limit   int64
+	maxAge  time.Duration
+	timeout time.Duration
+}
+
+// Make a new Inbox using the redis lists prefixed with prefix, keeping up to
+// limit events for each user, dropping the oldest ones, if above zero. A
+// user's events are dropped once no more have been added for maxAge, if above
+// zero, so users that never return don't keep their events forever.
+func NewInbox(client redis.UniversalClient, prefix string, limit int64, maxAge time.Duration) *Inbox {
+	return &Inbox{
+		client:  client,
+		prefix:  prefix,
+		limit:   limit,
+		maxAge:  maxAge,
+		timeout: time.Second,
+	}
+}
+
+// Keep an event for a user.
+func (i *Inbox) Put(ctx context.Context, userID string, e ssehandler.Event) error {
+	ctx, cancel := context.WithTimeout(ctx, i.timeout)
+	defer cancel()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	key := i.prefix + userID
+	_, err = i.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.RPush(ctx, key, data)
+		if i.limit > 0 {
+			p.LTrim(ctx, key, -i.limit, -1)
+		}
+		if i.maxAge > 0 {
+			p.Expire(ctx, key, i.maxAge)
+		}
+		return nil
+	})
+	return err
+}
+
+// Remove and return the events kept for a user, oldest first, skipping any
+// that are malformed.
+func (i *Inbox) Take(ctx context.Context, userID string) ([]ssehandler.Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, i.timeout)
+	defer cancel()
+	key := i.prefix + userID
+	var entries *redis.StringSliceCmd
+	_, err := i.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		entries = p.LRange(ctx, key, 0, -1)
+		p.Del(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var events []ssehandler.Event
+	for _, data := range entries.Val() {
+		var e ssehandler.Event
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
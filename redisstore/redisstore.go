@@ -0,0 +1,215 @@
+// Redis Streams event store for the SSE handler, for replaying missed events
+// to reconnecting clients even after a restart.
+//
+// The store is shared by the handlers on all instances using the same stream,
+// so events are inserted by the handler sending them and get the ID of their
+// stream entry, if they had none. Reading the history is done by each
+// handler's event loop when a client connects, which is held up until redis
+// replies or the timeout set by WithTimeout runs out.
+//
+// The Inbox keeps the events sent to offline users in redis lists as well,
+// see ssehandler.WithInbox.
+
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	ssehandler "github.com/lmas/gin-sse"
+	"github.com/redis/go-redis/v9"
+)
+
+// A Store keeps the history of events in a redis stream.
+type Store struct {
+	client  redis.UniversalClient
+	key     string
+	maxLen  int64
+	maxAge  time.Duration
+	limit   int64
+	timeout time.Duration
+}
+
+// An Option configures a Store.
+type Option func(*Store)
+
+// Keep at most n events in the stream. The stream is trimmed approximately,
+// so it can hold slightly more events for a while.
+func WithMaxLen(n int64) Option {
+	return func(s *Store) {
+		s.maxLen = n
+	}
+}
+
+// Drop events older than d from the stream.
+func WithMaxAge(d time.Duration) Option {
+	return func(s *Store) {
+		s.maxAge = d
+	}
+}
+
+// Replay at most n events to a reconnecting client, the most recent ones if
+// it missed more. Defaults to 1000.
+func WithRangeLimit(n int64) Option {
+	return func(s *Store) {
+		s.limit = n
+	}
+}
+
+// Give up on redis calls after d. Defaults to 1 second.
+func WithTimeout(d time.Duration) Option {
+	return func(s *Store) {
+		s.timeout = d
+	}
+}
+
+// Make a new Store using the redis stream at key. Without any options the
+// stream grows forever.
+func New(client redis.UniversalClient, key string, opts ...Option) *Store {
+	s := &Store{
+		client:  client,
+		key:     key,
+		limit:   1000,
+		timeout: time.Second,
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Append an event to the stream.
+func (s *Store) Append(e ssehandler.Event) error {
+	_, err := s.Insert(context.Background(), e)
+	return err
+}
+
+// Insert an event into the stream, setting its ID to the ID of the stream
+// entry if it had none.
+func (s *Store) Insert(ctx context.Context, e ssehandler.Event) (ssehandler.Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+	id, err := s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.key,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{"event": data},
+	}).Result()
+	if err != nil {
+		return e, err
+	}
+	if e.ID == "" {
+		e.ID = id
+	}
+	return e, s.trim(ctx)
+}
+
+// Get the events appended after the one with the given ID, the most recent
+// ones up to the range limit.
+func (s *Store) Range(sinceID string) ([]ssehandler.Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	stored, err := s.stored(ctx, sinceID)
+	if err != nil {
+		return nil, err
+	}
+	// Read from right after the event if it's in the stream, or otherwise
+	// look for it among the most recent ones
+	start := "-"
+	if stored {
+		start = "(" + sinceID
+	}
+	entries, err := s.client.XRevRangeN(ctx, s.key, "+", start, s.limit).Result()
+	if err != nil {
+		return nil, err
+	}
+	events := s.decode(entries)
+	for i := len(events) - 1; i >= 0 && !stored; i-- {
+		if sinceID != "" && events[i].ID == sinceID {
+			// Only the events after this one were missed
+			events = events[:i]
+			break
+		}
+	}
+	// Oldest first
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, nil
+}
+
+// Check if an event ID is the ID of its own entry in the stream. Event IDs
+// come from clients and events can have IDs of their own, so an ID looking
+// like an entry ID can't be trusted to be one.
+func (s *Store) stored(ctx context.Context, id string) (bool, error) {
+	ms, seq, ok := strings.Cut(id, "-")
+	if !ok {
+		return false, nil
+	}
+	if _, err := strconv.ParseUint(ms, 10, 64); err != nil {
+		return false, nil
+	}
+	if _, err := strconv.ParseUint(seq, 10, 64); err != nil {
+		return false, nil
+	}
+	entries, err := s.client.XRangeN(ctx, s.key, id, id, 1).Result()
+	if err != nil {
+		return false, err
+	}
+	events := s.decode(entries)
+	return len(events) == 1 && events[0].ID == id, nil
+}
+
+// Decode the events of stream entries, skipping any that are malformed or
+// older than the max age.
+func (s *Store) decode(entries []redis.XMessage) []ssehandler.Event {
+	var events []ssehandler.Event
+	for _, entry := range entries {
+		if s.expired(entry.ID) {
+			continue
+		}
+		data, ok := entry.Values["event"].(string)
+		if !ok {
+			continue
+		}
+		var e ssehandler.Event
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			continue
+		}
+		if e.ID == "" {
+			e.ID = entry.ID
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// Check if a stream entry is older than the max age, but hasn't been trimmed
+// yet.
+func (s *Store) expired(id string) bool {
+	if s.maxAge < 1 {
+		return false
+	}
+	ms, _, _ := strings.Cut(id, "-")
+	t, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return false
+	}
+	return t < time.Now().Add(-s.maxAge).UnixMilli()
+}
+
+// Drop the events older than the max age, if set.
+func (s *Store) trim(ctx context.Context) error {
+	if s.maxAge < 1 {
+		return nil
+	}
+	minID := strconv.FormatInt(time.Now().Add(-s.maxAge).UnixMilli(), 10)
+	return s.client.XTrimMinIDApprox(ctx, s.key, minID, 0).Err()
+}
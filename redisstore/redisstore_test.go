@@ -0,0 +1,121 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	ssehandler "github.com/lmas/gin-sse"
+	"github.com/redis/go-redis/v9"
+)
+
+// A fake redis client keeping a single stream, with IDs like "1-0".
+type fakeStream struct {
+	redis.UniversalClient
+	entries []redis.XMessage
+}
+
+func (f *fakeStream) XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd {
+	id := fmt.Sprintf("%d-0", len(f.entries)+1)
+	values := map[string]interface{}{}
+	for k, v := range a.Values.(map[string]interface{}) {
+		values[k] = string(v.([]byte))
+	}
+	f.entries = append(f.entries, redis.XMessage{ID: id, Values: values})
+	return redis.NewStringResult(id, nil)
+}
+
+func (f *fakeStream) XRangeN(ctx context.Context, stream, start, stop string, count int64) *redis.XMessageSliceCmd {
+	var entries []redis.XMessage
+	for _, e := range f.entries {
+		if inRange(e.ID, start, stop) && int64(len(entries)) < count {
+			entries = append(entries, e)
+		}
+	}
+	return redis.NewXMessageSliceCmdResult(entries, nil)
+}
+
+func (f *fakeStream) XRevRangeN(ctx context.Context, stream, start, stop string, count int64) *redis.XMessageSliceCmd {
+	var entries []redis.XMessage
+	for i := len(f.entries) - 1; i >= 0; i-- {
+		if e := f.entries[i]; inRange(e.ID, stop, start) && int64(len(entries)) < count {
+			entries = append(entries, e)
+		}
+	}
+	return redis.NewXMessageSliceCmdResult(entries, nil)
+}
+
+// Check if an ID is between start and stop, like XRANGE.
+func inRange(id, start, stop string) bool {
+	n := func(id string) int {
+		ms, _, _ := strings.Cut(strings.TrimPrefix(id, "("), "-")
+		i, _ := strconv.Atoi(ms)
+		return i
+	}
+	after := start == "-" || n(id) > n(start) || (n(id) == n(start) && start[0] != '(')
+	before := stop == "+" || n(id) < n(stop) || (n(id) == n(stop) && stop[0] != '(')
+	return after && before
+}
+
+func TestRange(t *testing.T) {
+	f := &fakeStream{}
+	s := New(f, "events", WithRangeLimit(4))
+	for i := 1; i <= 6; i++ {
+		e := ssehandler.Event{Data: []byte(strconv.Itoa(i))}
+		if i == 5 {
+			// Looks like an entry ID, but isn't the ID of its entry
+			e.ID = "3-1"
+		}
+		if _, err := s.Insert(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A malformed entry is skipped
+	f.entries = append(f.entries, redis.XMessage{ID: "7-0", Values: map[string]interface{}{"event": "{"}})
+
+	tests := []struct {
+		since string
+		want  string
+	}{
+		{"", "4 3-1 6"},
+		{"1-0", "4 3-1 6"},
+		{"4-0", "3-1 6"},
+		{"6-0", ""},
+		{"3-1", "6"},
+		{"5-0", "4 3-1 6"},
+		{"99999999999999999999-0", "4 3-1 6"},
+		{"unknown", "4 3-1 6"},
+	}
+	for _, tt := range tests {
+		events, err := s.Range(tt.since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range events {
+			if e.ID == "3-1" {
+				got = append(got, e.ID)
+			} else {
+				got = append(got, string(e.Data))
+			}
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("Range(%q) = %q, want %q", tt.since, got, tt.want)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	data, _ := json.Marshal(ssehandler.Event{Data: []byte("a")})
+	s := New(nil, "events")
+	events := s.decode([]redis.XMessage{
+		{ID: "1-0", Values: map[string]interface{}{"event": string(data)}},
+		{ID: "2-0", Values: map[string]interface{}{"other": string(data)}},
+	})
+	if len(events) != 1 || events[0].ID != "1-0" || string(events[0].Data) != "a" {
+		t.Errorf("got %+v", events)
+	}
+}
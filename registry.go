@@ -0,0 +1,94 @@
+package ssehandler
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// A Registry owns a set of independent, named handlers, such as one for each
+// of notifications, metrics and chat, so that they can be looked up by name
+// and closed together. It's safe for concurrent use.
+type Registry struct {
+	opts []Option
+
+	mu       sync.Mutex
+	handlers map[string]*SSEHandler
+	closed   bool
+}
+
+// Make a new, empty Registry. The options are used for every handler it
+// creates, before any options specific to the handler. Handlers whose
+// collectors are registered with the same prometheus registry need their own
+// WithMetricsNamespace.
+func NewRegistry(opts ...Option) *Registry {
+	return &Registry{
+		opts:     opts,
+		handlers: make(map[string]*SSEHandler),
+	}
+}
+
+// Get the handler with the name, creating and starting it if there's none
+// yet. The options are only used when creating it, after the registry's own.
+// Once the registry is closed, new handlers are created closed.
+func (r *Registry) Handler(name string, opts ...Option) *SSEHandler {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b, found := r.handlers[name]; found {
+		return b
+	}
+	all := append(append([]Option(nil), r.opts...), opts...)
+	b := NewSSEHandler(all...)
+	if r.closed {
+		b.Close(context.Background())
+	} else {
+		b.HandleEvents()
+	}
+	r.handlers[name] = b
+	return b
+}
+
+// Get the handler with the name, if there is one.
+func (r *Registry) Lookup(name string) (*SSEHandler, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, found := r.handlers[name]
+	return b, found
+}
+
+// Get the names of all handlers, sorted.
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.handlers))
+	for name := range r.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close all handlers at once, see SSEHandler.Close. Blocks until all of them
+// have stopped or ctx is done, returning any errors joined together.
+func (r *Registry) Close(ctx context.Context) error {
+	r.mu.Lock()
+	r.closed = true
+	handlers := make([]*SSEHandler, 0, len(r.handlers))
+	for _, b := range r.handlers {
+		handlers = append(handlers, b)
+	}
+	r.mu.Unlock()
+
+	errs := make([]error, len(handlers))
+	var wg sync.WaitGroup
+	for i, b := range handlers {
+		wg.Add(1)
+		go func(i int, b *SSEHandler) {
+			defer wg.Done()
+			errs[i] = b.Close(ctx)
+		}(i, b)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
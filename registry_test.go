@@ -0,0 +1,35 @@
+package ssehandler
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(WithQueueSize(1))
+	chat := r.Handler("chat")
+	if r.Handler("chat") != chat {
+		t.Fatal("got a new handler for the same name")
+	}
+	r.Handler("metrics", WithQueueSize(2))
+	if b, found := r.Lookup("metrics"); !found || b.queueSize != 2 {
+		t.Fatal("metrics handler not found or without its own options")
+	}
+	if _, found := r.Lookup("nope"); found {
+		t.Fatal("found a handler never created")
+	}
+	if got := strings.Join(r.Names(), ","); got != "chat,metrics" {
+		t.Fatalf("got names %q", got)
+	}
+
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := chat.SendContext(context.Background(), Event{}); err != ErrNotRunning {
+		t.Fatalf("got %v from a closed handler", err)
+	}
+	if err := r.Handler("late").SendContext(context.Background(), Event{}); err != ErrNotRunning {
+		t.Fatalf("got %v from a handler created after closing", err)
+	}
+}
@@ -0,0 +1,36 @@
+package ssehandler
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A RejectedError tells why a client was refused a subscription, see
+// WithRejectHandler.
+type RejectedError struct {
+	// HTTP status code the client is refused with by default.
+	Status int
+
+	// Reason the client was refused.
+	Err error
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("subscription rejected (%d): %s", e.Status, e.Err)
+}
+
+func (e *RejectedError) Unwrap() error {
+	return e.Err
+}
+
+// Refuse a client a subscription, using the rejection handler if set.
+func (b *SSEHandler) reject(c *gin.Context, status int, err error) {
+	rejected := &RejectedError{Status: status, Err: err}
+	if b.rejectHandler == nil {
+		c.AbortWithError(status, rejected)
+		return
+	}
+	b.rejectHandler(c, rejected)
+	c.Abort()
+}
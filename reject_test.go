@@ -0,0 +1,39 @@
+package ssehandler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRejectHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	denied := errors.New("denied")
+	b := NewSSEHandler(
+		WithAuthorize(func(*gin.Context) (ClientInfo, error) {
+			return ClientInfo{}, denied
+		}),
+		WithAuthorizeStatus(http.StatusForbidden),
+		WithRejectHandler(func(c *gin.Context, err error) {
+			var rejected *RejectedError
+			if !errors.As(err, &rejected) || !errors.Is(err, denied) {
+				t.Errorf("got error %v", err)
+			}
+			c.JSON(rejected.Status, gin.H{"detail": rejected.Err.Error()})
+		}),
+	)
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	r := gin.New()
+	r.GET("/events", b.Handler())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/events", nil))
+	if w.Code != http.StatusForbidden || w.Body.String() != `{"detail":"denied"}` {
+		t.Errorf("got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,123 @@
+package ssehandler
+
+import "context"
+
+// A report of the clients an event was delivered to, see PublishEvent.
+type BroadcastResult struct {
+	// Number of clients the event was pushed into the buffers of.
+	Enqueued int
+
+	// Number of clients subscribed to the event's topic, that were skipped
+	// by their filters or authorization.
+	Filtered int
+
+	// Number of clients that dropped the event, or were disconnected, as
+	// their buffers were full. See WithSlowClientPolicy.
+	Dropped int
+}
+
+// A request for the result of broadcasting the event with the ID, or to stop
+// waiting for it.
+type reportRequest struct {
+	id     string
+	reply  chan BroadcastResult
+	cancel bool
+}
+
+// Send out an event to all clients, or those subscribed to its topic, and
+// wait until it has been broadcast to report who it was delivered to.
+// Returns ErrNotRunning if the event loop isn't running, ErrBackpressure if
+// the clients can't keep up (see WithBackpressure), any error from the
+// middleware, or ctx's error. An event dropped by the middleware gets an
+// empty result. With a broker, only the clients on this instance are counted,
+// once the event has come back through the broker, so ctx should have a
+// deadline in case it never does.
+func (b *SSEHandler) PublishEvent(ctx context.Context, e Event) (BroadcastResult, error) {
+	if !b.running.Load() {
+		return BroadcastResult{}, ErrNotRunning
+	}
+	if b.pressured.Load() {
+		return BroadcastResult{}, ErrBackpressure
+	}
+	var req reportRequest
+	err := b.intercept(func(ctx context.Context, e Event) error {
+		e = b.prepare(ctx, e)
+		r := reportRequest{id: e.ID, reply: make(chan BroadcastResult, 1)}
+		if err := b.pushReport(ctx, r); err != nil {
+			return err
+		}
+		req = r
+		return b.emit(ctx, e)
+	})(ctx, e)
+	if req.reply == nil {
+		// Refused or dropped by the middleware
+		return BroadcastResult{}, err
+	}
+	if err != nil {
+		b.unwatch(req)
+		return BroadcastResult{}, err
+	}
+
+	select {
+	case result := <-req.reply:
+		return result, nil
+	case <-b.done:
+		select {
+		case result := <-req.reply:
+			// Broadcast during shutdown
+			return result, nil
+		default:
+			return BroadcastResult{}, ErrNotRunning
+		}
+	case <-ctx.Done():
+		b.unwatch(req)
+		return BroadcastResult{}, ctx.Err()
+	}
+}
+
+// Push a request for a result to the event loop.
+func (b *SSEHandler) pushReport(ctx context.Context, r reportRequest) error {
+	select {
+	case b.reports <- r:
+		return nil
+	case <-b.done:
+		return ErrNotRunning
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stop waiting for a result.
+func (b *SSEHandler) unwatch(r reportRequest) {
+	r.cancel = true
+	b.pushReport(context.Background(), r)
+}
+
+// Start or stop waiting for the result of an event. Only called by the event
+// loop.
+func (b *SSEHandler) watch(r reportRequest) {
+	if !r.cancel {
+		b.waiting[r.id] = append(b.waiting[r.id], r.reply)
+		return
+	}
+	var left []chan BroadcastResult
+	for _, reply := range b.waiting[r.id] {
+		if reply != r.reply {
+			left = append(left, reply)
+		}
+	}
+	if len(left) > 0 {
+		b.waiting[r.id] = left
+	} else {
+		delete(b.waiting, r.id)
+	}
+}
+
+// Hand the result of broadcasting an event to anyone waiting for it. Only
+// called by the event loop.
+func (b *SSEHandler) report(id string, result BroadcastResult) {
+	for _, reply := range b.waiting[id] {
+		reply <- result
+	}
+	delete(b.waiting, id)
+}
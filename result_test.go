@@ -0,0 +1,36 @@
+package ssehandler
+
+import "testing"
+
+func TestFanOutResult(t *testing.T) {
+	tests := []struct {
+		policy SlowClientPolicy
+		want   BroadcastResult
+	}{
+		{DropNewest, BroadcastResult{Enqueued: 1, Filtered: 1, Dropped: 1}},
+		{DropOldest, BroadcastResult{Enqueued: 2, Filtered: 1}},
+		{Disconnect, BroadcastResult{Enqueued: 1, Filtered: 1, Dropped: 1}},
+	}
+	for _, tt := range tests {
+		b := NewSSEHandler(WithSlowClientPolicy(tt.policy), WithShards(2))
+		full := &client{id: "full", events: make(chan message, 1), topics: []string{"a"}}
+		full.events <- message{}
+		clients := []*client{
+			{id: "ok", events: make(chan message, 1), topics: []string{"a"}},
+			{id: "filtered", events: make(chan message, 1), topics: []string{"a"},
+				filter: func(Event) bool { return false }},
+			{id: "other", events: make(chan message, 1), topics: []string{"b"}},
+			full,
+		}
+		for _, s := range clients {
+			s.gone = make(chan struct{})
+			b.addClient(s)
+		}
+		b.startShards()
+		got := b.fanOut(b.newMessage(Event{Topic: "a"}))
+		b.stopShards()
+		if got != tt.want {
+			t.Errorf("policy %d: got %+v, want %+v", tt.policy, got, tt.want)
+		}
+	}
+}
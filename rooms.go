@@ -0,0 +1,89 @@
+package ssehandler
+
+import "strings"
+
+// A client joining or leaving a room.
+type membership struct {
+	clientID string
+	room     string
+	join     bool
+}
+
+// Let a connected client join a room, receiving all events broadcast to it
+// until it leaves. Rooms are topics that clients join and leave while they're
+// connected, so a client joining a room is the same as it subscribing to a
+// topic with the same name, within the client's tenant if it has one. Unknown
+// clients are ignored.
+func (b *SSEHandler) Join(clientID, room string) {
+	b.pushMembership(membership{clientID: clientID, room: room, join: true})
+}
+
+// Let a connected client leave a room, or unsubscribe from a topic. Unknown
+// clients are ignored.
+func (b *SSEHandler) Leave(clientID, room string) {
+	b.pushMembership(membership{clientID: clientID, room: room})
+}
+
+// Send out an event to all clients in the room.
+func (b *SSEHandler) BroadcastRoom(room string, e Event) {
+	e.Topic = room
+	b.Send(e)
+}
+
+func (b *SSEHandler) pushMembership(m membership) {
+	select {
+	case b.memberships <- m:
+	case <-b.quit:
+	}
+}
+
+// Add the comma separated topics of a query parameter to the topics, leaving
+// out any duplicates. The topics are copied, as they might be shared with
+// other clients.
+func queryTopics(topics []string, param string) []string {
+	seen := make(map[string]bool)
+	var all []string
+	for _, t := range append(append([]string(nil), topics...), strings.Split(param, ",")...) {
+		t = strings.TrimSpace(t)
+		if t != "" && !seen[t] {
+			seen[t] = true
+			all = append(all, t)
+		}
+	}
+	return all
+}
+
+// Add or remove a client to a room. Only called by the event loop.
+func (b *SSEHandler) changeMembership(m membership) {
+	s, found := b.ids[m.clientID]
+	if !found {
+		return
+	}
+	if m.join && !s.mayReceive(m.room) {
+		b.logger.Debug("Client not allowed to join room", "client", s.id, "room", m.room)
+		return
+	}
+	if s.tenant != "" {
+		m.room = TenantTopic(s.tenant, m.room)
+	}
+
+	// The topics are copied on change, as the slice might still be in use.
+	var topics []string
+	for _, t := range s.topics {
+		if t != m.room {
+			topics = append(topics, t)
+		}
+	}
+	if m.join {
+		topics = append(topics, m.room)
+		s.shard.addToTopic(s, m.room)
+	} else {
+		s.shard.removeFromTopic(s, m.room)
+	}
+	s.topics = topics
+	if !m.join && b.latest != nil {
+		b.latest.forget(func(topic string) bool {
+			return topicMatches(m.room, topic)
+		}, b.watched)
+	}
+}
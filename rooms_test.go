@@ -0,0 +1,42 @@
+package ssehandler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQueryTopics(t *testing.T) {
+	tests := []struct {
+		topics []string
+		param  string
+		want   string
+	}{
+		{nil, "", ""},
+		{[]string{"a"}, "", "a"},
+		{nil, "orders,shipments", "orders,shipments"},
+		{[]string{"a"}, " b, ,a,c,b ", "a,b,c"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(queryTopics(tt.topics, tt.param), ","); got != tt.want {
+			t.Errorf("queryTopics(%q, %q) = %q, want %q", tt.topics, tt.param, got, tt.want)
+		}
+	}
+}
+
+func TestTopicEventNames(t *testing.T) {
+	b := NewSSEHandler(WithTopicEventNames())
+	tests := []struct {
+		e    Event
+		want string
+	}{
+		{Event{Data: []byte("x")}, "data: x\n\n"},
+		{Event{Topic: "orders", Data: []byte("x")}, "event: orders\ndata: x\n\n"},
+		{Event{Topic: "orders", Event: "new", Data: []byte("x")}, "event: new\ndata: x\n\n"},
+	}
+	for _, tt := range tests {
+		m := b.newMessage(tt.e)
+		if string(m.raw) != tt.want || m.event.Event != tt.e.Event {
+			t.Errorf("%+v: got %q, want %q", tt.e, m.raw, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package ssehandler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A Scheduled event, waiting to be sent out. See SendAfter.
+type Scheduled struct {
+	b     *SSEHandler
+	timer *time.Timer
+}
+
+// Cancel the event, if it hasn't been sent out yet. Returns false if it has
+// been sent or canceled already.
+func (s *Scheduled) Cancel() bool {
+	if !s.timer.Stop() {
+		return false
+	}
+	s.b.unschedule(s)
+	return true
+}
+
+// Scheduled events that haven't been sent out yet.
+type schedule struct {
+	mu      sync.Mutex
+	pending map[*Scheduled]bool
+}
+
+// Send out an event to all clients, or those subscribed to its topic, once d
+// has passed. The event is dropped if the handler is closed before then.
+func (b *SSEHandler) SendAfter(d time.Duration, e Event) *Scheduled {
+	s := &Scheduled{b: b}
+	b.scheduled.mu.Lock()
+	defer b.scheduled.mu.Unlock()
+	s.timer = time.AfterFunc(d, func() {
+		b.unschedule(s)
+		b.Send(e)
+	})
+	if b.scheduled.pending == nil {
+		b.scheduled.pending = make(map[*Scheduled]bool)
+	}
+	b.scheduled.pending[s] = true
+	return s
+}
+
+// Send out an event to all clients, or those subscribed to its topic, at t.
+// See SendAfter.
+func (b *SSEHandler) SendAt(t time.Time, e Event) *Scheduled {
+	return b.SendAfter(time.Until(t), e)
+}
+
+func (b *SSEHandler) unschedule(s *Scheduled) {
+	b.scheduled.mu.Lock()
+	defer b.scheduled.mu.Unlock()
+	delete(b.scheduled.pending, s)
+}
+
+// Cancel all scheduled events, when the handler is closed.
+func (b *SSEHandler) cancelScheduled() {
+	b.scheduled.mu.Lock()
+	defer b.scheduled.mu.Unlock()
+	for s := range b.scheduled.pending {
+		s.timer.Stop()
+	}
+	b.scheduled.pending = nil
+}
+
+// Send out the events made by produce every d, until the handler is closed or
+// the returned function is called. Errors returned by produce are logged, and
+// no event is sent out for them. The ctx given to produce is cancelled when the
+// handler is closed. Panics if d isn't positive.
+func (b *SSEHandler) Every(d time.Duration, produce func(ctx context.Context) (Event, error)) (stop func()) {
+	return b.every(d, produce, b.SendContext)
+}
+
+// Send out the events made by produce every d with send, see Every.
+func (b *SSEHandler) every(d time.Duration, produce func(ctx context.Context) (Event, error), send func(context.Context, Event) error) (stop func()) {
+	if d <= 0 {
+		panic("ssehandler: interval must be positive, got " + d.String())
+	}
+	stopped := make(chan struct{})
+	var once sync.Once
+	go func() {
+		t := time.NewTicker(d)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+			case <-stopped:
+				return
+			case <-b.quit:
+				return
+			}
+			e, err := produce(b.ctx)
+			if err != nil {
+				b.fail("produce", "", err, "Error while producing event")
+				continue
+			}
+			if err := send(b.ctx, e); err != nil && err != ErrNotRunning && err != context.Canceled {
+				b.fail("publish", "", err, "Error while sending event")
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() {
+			close(stopped)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package ssehandler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEvery(t *testing.T) {
+	tests := []struct {
+		name string
+		end  func(b *SSEHandler, stop func())
+	}{
+		{"stop", func(b *SSEHandler, stop func()) { stop(); stop() }},
+		{"close", func(b *SSEHandler, stop func()) { b.Close(context.Background()) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewSSEHandler(WithReplay(100))
+			b.HandleEvents()
+			defer b.Close(context.Background())
+			var produced atomic.Int32
+			stop := b.Every(5*time.Millisecond, func(ctx context.Context) (Event, error) {
+				produced.Add(1)
+				return Event{Data: []byte("tick")}, nil
+			})
+			for produced.Load() < 2 {
+				time.Sleep(time.Millisecond)
+			}
+			b.Sync(context.Background())
+			if events, _ := b.store.Range(""); len(events) < 1 || string(events[0].Data) != "tick" {
+				t.Errorf("got events %+v", events)
+			}
+
+			tt.end(b, stop)
+			// A tick might be in progress while ending.
+			time.Sleep(10 * time.Millisecond)
+			n := produced.Load()
+			time.Sleep(20 * time.Millisecond)
+			if got := produced.Load(); got != n {
+				t.Errorf("got %d events produced after ending, want %d", got, n)
+			}
+		})
+	}
+}
+
+func TestEveryInvalidInterval(t *testing.T) {
+	for _, d := range []time.Duration{0, -time.Second} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("no panic for %v", d)
+				}
+			}()
+			NewSSEHandler().Every(d, func(ctx context.Context) (Event, error) {
+				return Event{}, nil
+			})
+		}()
+	}
+}
+
+func TestSendAfter(t *testing.T) {
+	tests := []struct {
+		name      string
+		schedule  func(b *SSEHandler, e Event) *Scheduled
+		cancel    bool
+		close     bool
+		delivered bool
+	}{
+		{"after", func(b *SSEHandler, e Event) *Scheduled { return b.SendAfter(20*time.Millisecond, e) }, false, false, true},
+		{"at", func(b *SSEHandler, e Event) *Scheduled { return b.SendAt(time.Now().Add(20*time.Millisecond), e) }, false, false, true},
+		{"canceled", func(b *SSEHandler, e Event) *Scheduled { return b.SendAfter(20*time.Millisecond, e) }, true, false, false},
+		{"closed", func(b *SSEHandler, e Event) *Scheduled { return b.SendAfter(20*time.Millisecond, e) }, false, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewSSEHandler(WithReplay(10))
+			b.HandleEvents()
+			defer b.Close(context.Background())
+			s := tt.schedule(b, Event{Data: []byte("later")})
+			if tt.cancel && !s.Cancel() {
+				t.Error("couldn't cancel pending event")
+			}
+			if tt.close {
+				b.Close(context.Background())
+			}
+
+			b.Sync(context.Background())
+			if events, _ := b.store.Range(""); len(events) > 0 {
+				t.Fatalf("got events %+v before the delay", events)
+			}
+			time.Sleep(50 * time.Millisecond)
+			b.Sync(context.Background())
+			events, _ := b.store.Range("")
+			if got := len(events) == 1; got != tt.delivered {
+				t.Errorf("got events %+v", events)
+			}
+			if s.Cancel() {
+				t.Error("canceled an event that was sent or dropped")
+			}
+			b.scheduled.mu.Lock()
+			defer b.scheduled.mu.Unlock()
+			if len(b.scheduled.pending) > 0 {
+				t.Errorf("got %d events still pending", len(b.scheduled.pending))
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package ssehandler
+
+import "encoding/json"
+
+// Name of the control event sent to clients reconnecting with a Last-Event-ID
+// header, with WithSequenceNumbers, after the events they missed. Its data is
+// {"complete":true} if all of them were replayed, or {"complete":false} if
+// some of them are no longer in history, or the ID is unknown, in which case
+// the client should refetch its state in full.
+const ReplayEvent = "replay"
+
+// Envelope of the events numbered by WithSequenceNumbers, and of the
+// "snapshot" and "delta" events of the topics given to WithSnapshots.
+type sequenced struct {
+	Seq  uint64          `json:"seq"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Wrap the data of an event, with its sequence number.
+func wrapSequenced(seq uint64, data []byte) []byte {
+	if !json.Valid(data) {
+		data, _ = json.Marshal(string(data))
+	}
+	wrapped, _ := json.Marshal(sequenced{Seq: seq, Data: data})
+	return wrapped
+}
+
+// Number an event with WithSequenceNumbers, or on a topic given to
+// WithSnapshots, giving it its topic's next sequence number unless it has one.
+// Events on the latter are turned into "delta" events. Only called by the
+// event loop.
+func (b *SSEHandler) sequence(e Event) Event {
+	delta := b.snapshotTopics[e.Topic]
+	if !b.sequenceAll && !delta {
+		return e
+	}
+	if e.Seq == 0 {
+		e.Seq = b.topicSeqs[e.Topic] + 1
+	}
+	b.topicSeqs[e.Topic] = e.Seq
+	if delta {
+		e.Event = "delta"
+	}
+	e.Data = wrapSequenced(e.Seq, e.Data)
+	return e
+}
+
+// Get the control event telling a reconnecting client whether all the events
+// it missed were replayed.
+func replayEvent(complete bool) Event {
+	data, _ := json.Marshal(struct {
+		Complete bool `json:"complete"`
+	}{complete})
+	return Event{Event: ReplayEvent, Data: data}
+}
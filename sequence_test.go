@@ -0,0 +1,35 @@
+package ssehandler
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSequenceNumbers(t *testing.T) {
+	b := NewSSEHandler(WithReplay(10), WithSequenceNumbers())
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	b.Send(Event{ID: "1", Topic: "a", Data: []byte(`{"x":1}`)})
+	b.Send(Event{ID: "2", Topic: "b", Data: []byte("text")})
+	b.Send(Event{ID: "3", Topic: "a", Data: []byte("2")})
+	b.Sync(context.Background())
+
+	missed := b.missedEvents(&client{lastEventID: "1", topics: []string{"a", "b"}})
+	if len(missed) != 3 {
+		t.Fatalf("got %+v", missed)
+	}
+	if got := string(missed[0].Data); got != `{"seq":1,"data":"text"}` {
+		t.Errorf("got %s", got)
+	}
+	if got := string(missed[1].Data); got != `{"seq":2,"data":2}` {
+		t.Errorf("got %s", got)
+	}
+	if got := missed[2]; got.Event != ReplayEvent || string(got.Data) != `{"complete":true}` {
+		t.Errorf("got %+v", got)
+	}
+
+	missed = b.missedEvents(&client{lastEventID: "unknown"})
+	if got := missed[len(missed)-1]; string(got.Data) != `{"complete":false}` {
+		t.Errorf("got %+v", got)
+	}
+}
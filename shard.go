@@ -0,0 +1,226 @@
+package ssehandler
+
+import "sync"
+
+// A shard of the client registry. Each shard can have its own worker pushing
+// broadcast events to its clients, so that the fan-out to many clients runs
+// in parallel. The maps are only changed by the event loop, while none of the
+// workers are busy.
+type shard struct {
+	// Map of the shard's clients. (The values are just booleans and are
+	// meaningless.)
+	clients map[*client]bool
+
+	// Map of topics and the shard's clients subscribed to them, and of
+	// patterns with wildcards, which are matched against each topic.
+	topics   map[string]map[*client]bool
+	patterns map[string]map[*client]bool
+
+	// Channel into which broadcasts are pushed for the worker
+	work chan *fanout
+
+	// Clients disconnected by the slow client policy during the last
+	// broadcast, to be removed by the event loop.
+	kicked []*client
+
+	// Counts of the shard's clients the last broadcast was delivered to,
+	// and of those whose buffers are full, with WithBackpressure.
+	result    BroadcastResult
+	saturated int
+}
+
+// A single event, or batch of them, being pushed out by the shard workers.
+type fanout struct {
+	msg   message
+	batch []message
+	wg    sync.WaitGroup
+}
+
+func newShard() *shard {
+	return &shard{
+		clients:  make(map[*client]bool),
+		topics:   make(map[string]map[*client]bool),
+		patterns: make(map[string]map[*client]bool),
+		work:     make(chan *fanout),
+	}
+}
+
+// Add a client to the shard and its topics.
+func (sh *shard) add(s *client) {
+	sh.clients[s] = true
+	for _, t := range s.topics {
+		sh.addToTopic(s, t)
+	}
+}
+
+// Remove a client from the shard and its topics.
+func (sh *shard) remove(s *client) {
+	delete(sh.clients, s)
+	for _, t := range s.topics {
+		sh.removeFromTopic(s, t)
+	}
+}
+
+// Add a client to the map of a topic's clients.
+func (sh *shard) addToTopic(s *client, topic string) {
+	topics := sh.topics
+	if isPattern(topic) {
+		topics = sh.patterns
+	}
+	if topics[topic] == nil {
+		topics[topic] = make(map[*client]bool)
+	}
+	topics[topic][s] = true
+}
+
+// Remove a client from the map of a topic's clients.
+func (sh *shard) removeFromTopic(s *client, topic string) {
+	topics := sh.topics
+	if isPattern(topic) {
+		topics = sh.patterns
+	}
+	delete(topics[topic], s)
+	if len(topics[topic]) < 1 {
+		delete(topics, topic)
+	}
+}
+
+// Push a broadcast event to the shard's clients, or only those subscribed to
+// the event's topic or a pattern matching it.
+func (sh *shard) push(b *SSEHandler, m message) {
+	clients := sh.clients
+	if m.event.Topic != "" {
+		clients = sh.topics[m.event.Topic]
+	}
+	for s, _ := range clients {
+		sh.pushTo(b, s, m)
+	}
+	if m.event.Topic == "" || len(sh.patterns) < 1 {
+		return
+	}
+	// Clients subscribed to the topic as well as patterns, or to many
+	// patterns, only get the event once.
+	var seen map[*client]bool
+	for p, matched := range sh.patterns {
+		if !topicMatches(p, m.event.Topic) {
+			continue
+		}
+		for s := range matched {
+			if clients[s] || seen[s] {
+				continue
+			}
+			if seen == nil {
+				seen = make(map[*client]bool)
+			}
+			seen[s] = true
+			sh.pushTo(b, s, m)
+		}
+	}
+}
+
+// Push a broadcast event to a single client of the shard, if it accepts it.
+// The event is dropped for the client if its filter panics.
+func (sh *shard) pushTo(b *SSEHandler, s *client, m message) {
+	defer func() {
+		if v := recover(); v != nil {
+			b.recovered("fan-out", v)
+			sh.result.Dropped++
+		}
+	}()
+	if !s.accepts(m.event) {
+		sh.result.Filtered++
+		return
+	}
+	sh.offer(b, s, m)
+}
+
+// Push a message the client accepts into its buffer.
+func (sh *shard) offer(b *SSEHandler, s *client, m message) {
+	switch b.offer(s, m) {
+	case delivered:
+		sh.result.Enqueued++
+	case dropped:
+		sh.result.Dropped++
+	case refused:
+		sh.result.Dropped++
+		sh.kicked = append(sh.kicked, s)
+	}
+	if b.backpressure > 0 && saturated(s) {
+		sh.saturated++
+	}
+}
+
+// Push a fan-out's event, or batch of them, to the shard's clients.
+func (sh *shard) do(b *SSEHandler, f *fanout) {
+	if f.batch != nil {
+		sh.pushBatch(b, f.batch)
+	} else {
+		sh.push(b, f.msg)
+	}
+}
+
+// Run the shard's worker, until the work channel is closed.
+func (sh *shard) run(b *SSEHandler) {
+	for f := range sh.work {
+		sh.do(b, f)
+		f.wg.Done()
+	}
+}
+
+// Push a broadcast event to the clients of all shards. See spread.
+func (b *SSEHandler) fanOut(m message) BroadcastResult {
+	return b.spread(&fanout{msg: m})
+}
+
+// Push a fan-out to the clients of all shards, in parallel if there's more
+// than one, then remove any clients disconnected by the slow client policy.
+// Returns the counts of the clients it was delivered to.
+func (b *SSEHandler) spread(f *fanout) BroadcastResult {
+	if len(b.shards) == 1 {
+		b.shards[0].do(b, f)
+	} else {
+		f.wg.Add(len(b.shards))
+		for _, sh := range b.shards {
+			sh.work <- f
+		}
+		f.wg.Wait()
+	}
+	var result BroadcastResult
+	var full int
+	for _, sh := range b.shards {
+		for _, s := range sh.kicked {
+			b.removeClient(s)
+		}
+		sh.kicked = sh.kicked[:0]
+		result.Enqueued += sh.result.Enqueued
+		result.Filtered += sh.result.Filtered
+		result.Dropped += sh.result.Dropped
+		sh.result = BroadcastResult{}
+		full += sh.saturated
+		sh.saturated = 0
+	}
+	if b.backpressure > 0 {
+		b.measurePressure(full, result.Enqueued+result.Dropped)
+	}
+	return result
+}
+
+// Start the shard workers, if there's more than one shard.
+func (b *SSEHandler) startShards() {
+	if len(b.shards) < 2 {
+		return
+	}
+	for _, sh := range b.shards {
+		go sh.run(b)
+	}
+}
+
+// Stop the shard workers.
+func (b *SSEHandler) stopShards() {
+	if len(b.shards) < 2 {
+		return
+	}
+	for _, sh := range b.shards {
+		close(sh.work)
+	}
+}
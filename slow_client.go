@@ -0,0 +1,115 @@
+package ssehandler
+
+// A SlowClientPolicy decides what happens with new messages, when a client's
+// buffer is full. See WithSlowClientPolicy.
+type SlowClientPolicy int
+
+const (
+	// Wait for the client to catch up, holding up all other clients.
+	Block SlowClientPolicy = iota
+
+	// Drop the oldest message in the client's buffer, to make room for the
+	// new one.
+	DropOldest
+
+	// Drop the new message.
+	DropNewest
+
+	// Disconnect the client.
+	Disconnect
+)
+
+// Counts how often the slow client policy was triggered.
+type SlowClientCounts struct {
+	// Number of messages dropped.
+	Dropped uint64
+
+	// Number of clients disconnected.
+	Disconnected uint64
+}
+
+// Get the counts of how often the slow client policy was triggered.
+func (b *SSEHandler) SlowClientCounts() SlowClientCounts {
+	return SlowClientCounts{
+		Dropped:      b.slowDropped.Load(),
+		Disconnected: b.slowDisconnected.Load(),
+	}
+}
+
+// Count a message dropped by the slow client policy, handing it to the dead
+// letter sink.
+func (b *SSEHandler) dropMessage(s *client, msg message) {
+	b.slowDropped.Add(1)
+	b.metrics.dropped.Inc()
+	b.logger.Debug("Dropped message for slow client", "client", s.id)
+	b.deadMessage(s, msg, "dropped")
+}
+
+// The outcome of pushing a message into a client's buffer, see offer.
+type delivery int
+
+const (
+	// The message was pushed into the buffer.
+	delivered delivery = iota
+
+	// The message was dropped by the slow client policy.
+	dropped
+
+	// The message was refused and the client should be disconnected.
+	refused
+)
+
+// Push a message into a client's buffer, applying the slow client policy if
+// it's full. Low priority messages are dropped instead, while critical ones
+// make room by dropping a message with a lower priority, see Priority.
+// Returns false if the client should be disconnected, which is left to the
+// caller as it might not be the event loop.
+func (b *SSEHandler) deliver(s *client, msg message) bool {
+	return b.offer(s, msg) != refused
+}
+
+// Same as deliver, but tells whether the message was pushed or dropped.
+func (b *SSEHandler) offer(s *client, msg message) delivery {
+	defer b.schedule(s)
+	defer s.measureQueue()
+	if msg.priority != PriorityNormal && saturated(s) {
+		if msg.priority < PriorityNormal {
+			b.dropMessage(s, msg)
+			return dropped
+		}
+		b.preempt(s)
+	}
+	if b.slowClientPolicy == Block {
+		s.events <- msg
+		return delivered
+	}
+
+	select {
+	case s.events <- msg:
+		return delivered
+	default:
+	}
+
+	switch b.slowClientPolicy {
+	case DropOldest:
+		select {
+		case old := <-s.events:
+			b.dropMessage(s, old)
+		default:
+		}
+		select {
+		case s.events <- msg:
+		default:
+			b.dropMessage(s, msg)
+			return dropped
+		}
+	case DropNewest:
+		b.dropMessage(s, msg)
+		return dropped
+	case Disconnect:
+		b.slowDisconnected.Add(1)
+		b.logger.Info("Disconnecting slow client", "client", s.id)
+		return refused
+	}
+	return delivered
+}
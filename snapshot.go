@@ -0,0 +1,96 @@
+package ssehandler
+
+import (
+	"context"
+	"sort"
+)
+
+// The state of a topic, as loaded for WithSnapshots.
+type Snapshot struct {
+	// The state, sent as is if it's a JSON document or as a JSON string
+	// otherwise.
+	Data []byte
+
+	// Seq of the last delta included in the state.
+	Seq uint64
+}
+
+// Load a snapshot of a topic's state, as a "snapshot" event.
+func (b *SSEHandler) loadSnapshot(ctx context.Context, s *client, topic string) (Event, error) {
+	snap, err := b.snapshot(ctx, topic)
+	if err != nil {
+		b.fail("snapshot", s.id, err, "Error while loading snapshot")
+		return Event{}, err
+	}
+	return Event{
+		Event: "snapshot",
+		Topic: topic,
+		Data:  wrapSequenced(snap.Seq, snap.Data),
+		Seq:   snap.Seq,
+	}, nil
+}
+
+// Load the snapshots of the topics a new client is subscribed to, sent after
+// any backfill.
+func (b *SSEHandler) loadSnapshots(ctx context.Context, s *client) []Event {
+	topics := make([]string, 0, len(b.snapshotTopics))
+	for t := range b.snapshotTopics {
+		if s.follows(t) {
+			topics = append(topics, t)
+		}
+	}
+	sort.Strings(topics)
+	var snaps []Event
+	for _, t := range topics {
+		if e, err := b.loadSnapshot(ctx, s, t); err == nil && s.accepts(e) {
+			snaps = append(snaps, e)
+		}
+	}
+	return snaps
+}
+
+// Check if a message should be written to a client, which must be locked,
+// keeping the deltas of the topics given to WithSnapshots in sequence. Deltas
+// the client has seen already, or that are included in its last snapshot,
+// are skipped. If any deltas were missed, such as after being dropped for a
+// slow client, a fresh snapshot is written first.
+func (b *SSEHandler) inSequence(s *client, msg message) bool {
+	e := msg.event
+	if !b.snapshotTopics[e.Topic] {
+		return true
+	}
+	if s.seqs == nil {
+		s.seqs = make(map[string]uint64)
+	}
+	switch e.Event {
+	case "snapshot":
+		s.seqs[e.Topic] = e.Seq
+		return true
+	case "delta":
+	default:
+		return true
+	}
+	last, seen := s.seqs[e.Topic]
+	if seen && e.Seq <= last {
+		return false
+	}
+	if seen && e.Seq == last+1 {
+		s.seqs[e.Topic] = e.Seq
+		return true
+	}
+
+	b.metrics.resyncs.Inc()
+	snap, err := b.loadSnapshot(b.ctx, s, e.Topic)
+	if err != nil {
+		// Send the delta anyway, the client can tell it's out of sequence
+		s.seqs[e.Topic] = e.Seq
+		return true
+	}
+	b.write(s, b.newMessage(snap))
+	if e.Seq <= snap.Seq {
+		return false
+	}
+	// Even if the snapshot is behind the delta, loading another won't help
+	s.seqs[e.Topic] = e.Seq
+	return true
+}
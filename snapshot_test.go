@@ -0,0 +1,72 @@
+package ssehandler
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A stream keeping the events sent to it.
+type recordStream struct {
+	mu     sync.Mutex
+	events []Event
+	done   chan struct{}
+}
+
+func (s *recordStream) Send(e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *recordStream) Done() <-chan struct{} { return s.done }
+
+func (s *recordStream) sent() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var got string
+	for _, e := range s.events {
+		got += fmt.Sprintf("%s %s\n", e.Event, e.Data)
+	}
+	return got
+}
+
+func TestSnapshots(t *testing.T) {
+	var seq atomic.Uint64
+	seq.Store(2)
+	b := NewSSEHandler(WithSnapshots(func(ctx context.Context, topic string) (Snapshot, error) {
+		return Snapshot{Data: []byte("state"), Seq: seq.Load()}, nil
+	}, "doc"))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	s := &recordStream{done: make(chan struct{})}
+	go b.SubscribeStream(c, s, nil, "doc")
+	for b.ClientCount() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	b.Send(Event{Topic: "doc", Seq: 2, Data: []byte(`"old"`)})
+	b.Send(Event{Topic: "doc", Seq: 3, Data: []byte(`"next"`)})
+	seq.Store(5)
+	b.Send(Event{Topic: "doc", Seq: 5, Data: []byte(`"missed"`)})
+	b.Send(Event{Topic: "doc", Data: []byte(`"last"`)})
+	b.Sync(context.Background())
+
+	want := `snapshot {"seq":2,"data":"state"}
+delta {"seq":3,"data":"next"}
+snapshot {"seq":5,"data":"state"}
+delta {"seq":6,"data":"last"}
+`
+	if got := s.sent(); got != want {
+		t.Errorf("got:\n%s", got)
+	}
+}
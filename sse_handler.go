@@ -5,37 +5,478 @@
 package ssehandler
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// Returned when sending messages to a handler whose event loop isn't
+	// running, see HandleEvents and Close.
+	ErrNotRunning = errors.New("event loop not running")
+
+	// Returned when the queue of messages waiting to be sent out is full.
+	ErrBufferFull = errors.New("message buffer full")
+
+	// Returned when the clients can't keep up with the events sent out, see
+	// WithBackpressure.
+	ErrBackpressure = errors.New("clients can't keep up")
+
+	// Given to the rejection handler for clients refused by WithRateLimit
+	// or WithMaxClients, see WithRejectHandler.
+	ErrRateLimited    = errors.New("too many subscriptions")
+	ErrTooManyClients = errors.New("too many clients")
+
+	// Given to the rejection handler for clients whose responses can't be
+	// streamed, or that didn't ask for a WebSocket upgrade when they should.
+	ErrStreamingUnsupported = errors.New("streaming unsupported")
+	ErrNotWebSocket         = errors.New("not a websocket upgrade")
+
+	// Returned when a client isn't connected to the handler.
+	ErrClientNotFound = errors.New("client not connected")
+
+	// Given to the rejection handler for clients refused while the handler
+	// is being drained, see Drain.
+	ErrDraining = errors.New("server closing")
+
+	// Reported when the subscription to the broker ends, before the handler
+	// resubscribes, see WithOnError.
+	ErrBrokerDisconnected = errors.New("broker subscription ended")
+
+	// Reported when the circuit opens for a broker that keeps failing, and
+	// returned for the events then only sent out to this instance's
+	// clients, see WithCircuitBreaker.
+	ErrCircuitOpen = errors.New("broker circuit open")
+
+	// Returned when using a transaction that's been committed or rolled
+	// back already, see Tx.
+	ErrTxDone = errors.New("transaction already committed or rolled back")
+
+	// Returned when a webhook's signature doesn't match, see Webhook.
+	ErrBadSignature = errors.New("invalid webhook signature")
+
+	// Given to the rejection handler for clients without a valid tenant, and
+	// returned when sending events to a tenant over its quota, see
+	// WithTenants.
+	ErrInvalidTenant = errors.New("missing or invalid tenant")
+	ErrOverQuota     = errors.New("tenant over quota")
+
+	// Given to the rejection handler for clients of a new tenant, and
+	// returned when sending events to one, while the handler can't keep
+	// track of any more tenants, see WithTenants.
+	ErrTooManyTenants = errors.New("too many tenants")
+
+	// Given to the rejection handler for clients from an origin not
+	// allowed by WithCORS.
+	ErrOriginNotAllowed = errors.New("origin not allowed")
+
+	// Returned when reconfiguring a handler with an option that can only be
+	// given to NewSSEHandler, see Reconfigure.
+	ErrNotReloadable = errors.New("option can't be changed while running")
 )
 
 type SSEHandler struct {
-	// Create a map of clients, the keys of the map are the channels over
-	// which we can push messages to attached clients. (The values are just
-	// booleans and are meaningless.)
-	clients map[chan string]bool
+	// Create a map of clients, the keys of the map are the attached clients.
+	// (The values are just booleans and are meaningless.)
+	clients map[*client]bool
+
+	// The clients split up in shards, each with its own map of topics and
+	// clients subscribed to them. New clients are added to the shards in
+	// turn.
+	shards    []*shard
+	numShards int
+	nextShard int
+
+	// Map of client IDs and their clients.
+	ids map[string]*client
+
+	// Map of user IDs and their clients.
+	users map[string]map[*client]bool
+
+	// Gets the user IDs of new clients, if set.
+	userID func(*gin.Context) string
+
+	// Query parameter new clients can list more topics in, if set, and
+	// whether events without names are sent named after their topics.
+	topicsParam     string
+	topicEventNames bool
+
+	// Gets the topics each new client may receive, if set.
+	topicACL func(*gin.Context, ClientInfo) func(topic string) bool
+
+	// Gets the metadata of new clients, if set, and the key of the metadata
+	// the clients are counted by in the metrics.
+	metadata      func(*gin.Context) map[string]interface{}
+	metadataLabel string
+
+	// Creates the IDs for new clients, random ones if nil.
+	clientID func(*gin.Context) string
 
 	// Channel into which new clients can be pushed
-	newClients chan chan string
+	newClients chan *client
 
 	// Channel into which disconnected clients should be pushed
-	defunctClients chan chan string
+	defunctClients chan *client
 
 	// Channel into which messages are pushed to be broadcast out
-	messages chan string
+	messages chan Event
+
+	// Channel into which batches of messages are pushed, see SendBatch.
+	batches chan []Event
+
+	// Channel into which TrySend pushes messages to be published, with a
+	// broker or shared store
+	outbound chan Event
+
+	// Channel into which messages are pushed to be sent to a single client
+	direct chan directMessage
+
+	// Size of the message channels' buffers.
+	queueSize int
+
+	// Headers sent to new clients.
+	headers http.Header
+
+	// Responds to refused clients, if set.
+	rejectHandler func(*gin.Context, error)
+
+	// Comment and padding written to new SSE clients, if set.
+	initialComment string
+	padding        int
+
+	// Sets the headers of each new client, if set.
+	headerFunc func(*gin.Context, http.Header)
+
+	// Logs internal events and errors.
+	logger Logger
+
+	// Called with the errors the handler runs into, if set.
+	onError func(error)
+
+	// Called with the events that couldn't be delivered, if set.
+	deadLetter func(DeadLetter) error
+
+	// Calls waiting for the hooks above.
+	hooks hookQueue
+
+	// Last ID assigned to an event without a user supplied ID, as the time
+	// in microseconds or higher, so that IDs keep increasing across restarts.
+	lastID atomic.Uint64
+
+	// Gives events their IDs instead of the counter, if set.
+	idGenerator IDGenerator
+
+	// Random suffix for the assigned IDs, keeping them unique between the
+	// instances sharing a broker.
+	nodeID string
+
+	// History of events, replayed to reconnecting clients, if set.
+	store EventStore
+
+	// Number of recent events sent to new clients.
+	sendLast int
+
+	// Size of each client's channel buffer.
+	clientBuffer int
+
+	// Longest time and most bytes written to a client before flushing, if
+	// set.
+	flushInterval time.Duration
+	flushSize     int
+
+	// Longest time a single write to a client may take, if set.
+	writeTimeout time.Duration
+
+	// Decides which clients get compressed responses, and the compression
+	// level, if set.
+	compressFor   func(*gin.Context) bool
+	compressLevel int
+
+	// Upgrades the connections of WebSocket clients.
+	upgrader *websocket.Upgrader
+
+	// Stream NDJSON to all clients, instead of SSE.
+	ndjson bool
+
+	// Events scheduled to be sent out later, see SendAfter.
+	scheduled schedule
+
+	// Latest event sent out for each topic and key, if enabled.
+	latest *latestCache
+
+	// Topics sent out as JSON Patches, the last state sent on each, and the
+	// number of patches between snapshots, see WithJSONPatch.
+	patchTopics   map[string]bool
+	patchStates   map[string]*patchState
+	snapshotEvery int
+
+	// Topics sent as numbered deltas, and the loader of their snapshots, see
+	// WithSnapshots.
+	snapshotTopics map[string]bool
+	snapshot       func(context.Context, string) (Snapshot, error)
+
+	// Number all events by topic, see WithSequenceNumbers, and the last
+	// number given on each topic.
+	sequenceAll bool
+	topicSeqs   map[string]uint64
+
+	// Middleware events are passed through before being sent out, see Use.
+	middleware []Middleware
+
+	// Encode objects sent out, for all topics or single ones.
+	encoder       Encoder
+	topicEncoders map[string]Encoder
+
+	// Priorities of the events of each topic, and of all events, if set.
+	topicPriorities map[string]Priority
+	priority        func(Event) Priority
+
+	// Size of the pool of writers and the channel into which clients with
+	// messages waiting are pushed for them, if set.
+	writers int
+	ready   chan *client
+
+	// What to do when a client's buffer is full.
+	slowClientPolicy SlowClientPolicy
+
+	// Counts how often the slow client policy was triggered.
+	slowDropped      atomic.Uint64
+	slowDisconnected atomic.Uint64
+
+	// Interval between heartbeats sent to each client, if set.
+	heartbeat time.Duration
+
+	// Reconnection time hint sent to new clients, if set.
+	retry time.Duration
+
+	// Formats events before writing them to clients.
+	formatter Formatter
+
+	// Prometheus metrics of the handler, prefixed with the namespace.
+	metrics          *metrics
+	metricsNamespace string
+
+	// Authorizes new clients before they're subscribed, if set. Refused
+	// clients get the status code.
+	authorize       func(*gin.Context) (ClientInfo, error)
+	authorizeStatus int
+
+	// Decides which events a client is allowed to receive, if set.
+	authorizeEvent func(ClientInfo, Event) bool
+
+	// Loads the events sent to new clients before any others, if set.
+	backfill func(context.Context, ClientInfo) ([]Event, error)
+
+	// Events written to clients but not yet acknowledged, if enabled.
+	acks *ackStore
+
+	// Namespaces clients and topics by tenant, if set.
+	tenants *tenants
+
+	// Cross-origin access to the subscribe endpoints, if set.
+	cors *cors
+
+	// Keeps the events sent to users while they're offline, if set.
+	inbox Inbox
+
+	// Lifecycle hooks called when clients connect and disconnect, if set.
+	onConnect    func(*gin.Context, ClientInfo)
+	onDisconnect func(ClientInfo)
+
+	// Final event sent to all clients when the handler is closed, if set.
+	shutdownEvent *Event
+
+	// Sent to all clients by Drain, instead of the default one, if set, and
+	// whether the handler is being drained.
+	drainEvent *Event
+	draining   atomic.Bool
+
+	// Channel closed when the handler is closed, to stop the event loop
+	quit     chan struct{}
+	quitOnce sync.Once
+
+	// Context cancelled when the handler is closed
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Distributes events between instances, if set.
+	broker Broker
+
+	// Set while subscribed to the broker
+	brokerConnected atomic.Bool
+
+	// Guards the publishes to the broker, if set.
+	circuit *circuit
+
+	// Channel closed by the event loop once it has stopped
+	done chan struct{}
+
+	// The settings changed by Reconfigure, and the lock held while they're
+	// being changed.
+	live          atomic.Pointer[settings]
+	reconfiguring sync.Mutex
+
+	// Set by the options that can be given to Reconfigure, see reloadable.
+	reloaded bool
+
+	// Set while the event loop is running
+	running atomic.Bool
+
+	// Set once HandleEvents has been called
+	launched atomic.Bool
+
+	// Time the event loop was started
+	started time.Time
+
+	// Channel into which clients joining or leaving rooms are pushed
+	memberships chan membership
+
+	// Channel into which Pause and Resume are pushed, whether the event loop
+	// is paused, and the sending of the events held back meanwhile, up to
+	// pauseBuffer. The flag is for reading from outside of the event loop.
+	pauses      chan bool
+	paused      bool
+	pausedFlag  atomic.Bool
+	held        []func()
+	pauseBuffer int
+
+	// Channel into which requests for statistics are pushed
+	statsRequests chan chan Stats
+
+	// Channel into which requests to disconnect clients are pushed
+	kicks chan kick
+
+	// Channel into which Sync pushes its requests
+	syncs chan chan struct{}
+
+	// Throttles of the topics limited by WithTopicThrottle, and the channel
+	// into which the topics are pushed when their held back events are due.
+	throttles map[string]*throttle
+	released  chan string
+
+	// Window for coalescing events with keys, if set by WithCoalesce, the
+	// events held back for each topic and key, and the channel into which
+	// their keys are pushed when the window has passed. The map is only
+	// touched by the event loop.
+	coalesceWindow time.Duration
+	coalescing     map[latestKey]*Event
+	coalesced      chan latestKey
+
+	// Channel into which PublishEvent pushes its requests for results, and
+	// the requests waiting for their events, by event ID. The map is only
+	// touched by the event loop.
+	reports chan reportRequest
+	waiting map[string][]chan BroadcastResult
+
+	// Channel into which requests for the list of clients are pushed
+	clientsRequests chan chan []ClientDetails
+
+	// Channel into which requests for the users present are pushed
+	presenceRequests chan presenceRequest
+
+	// Topic of the presence events, if enabled.
+	presenceTopic string
+
+	// Number of connected clients
+	clientCount atomic.Int64
+
+	// Limits the rate of new clients, if set.
+	rateLimiter *rateLimiter
+
+	// Max number of clients, if set, and the number of clients currently
+	// being served. Clients over the limit are told to retry after a while.
+	maxClients  int
+	connections atomic.Int64
+	retryAfter  time.Duration
+
+	// Total number of events broadcast. Only touched by the event loop.
+	eventsSent uint64
+
+	// When the last event was broadcast, in Unix nanoseconds, see Health.
+	lastBroadcast atomic.Int64
+
+	// Traces the events sent out, and optionally their writes to each
+	// client, if set by WithTracing.
+	tracer          trace.Tracer
+	traceDeliveries bool
+
+	// Share of saturated clients at which producers are pushed back, the
+	// hook called when that changes, and whether they're pushed back now.
+	// While they are, the clients are checked again on every tick. The
+	// hook and ticker are only touched by the event loop.
+	backpressure   float64
+	onBackpressure func(bool)
+	pressured      atomic.Bool
+	pressureTicker *time.Ticker
 }
 
-// Make a new SSEHandler instance.
-func NewSSEHandler() *SSEHandler {
+// Make a new SSEHandler instance, configured with any options.
+func NewSSEHandler(opts ...Option) *SSEHandler {
 	b := &SSEHandler{
-		clients:        make(map[chan string]bool),
-		newClients:     make(chan (chan string)),
-		defunctClients: make(chan (chan string)),
-		messages:       make(chan string, 10), // buffer 10 msgs and don't block sends
+		clients:          make(map[*client]bool),
+		ids:              make(map[string]*client),
+		users:            make(map[string]map[*client]bool),
+		newClients:       make(chan *client),
+		defunctClients:   make(chan *client),
+		memberships:      make(chan membership),
+		pauses:           make(chan bool),
+		statsRequests:    make(chan chan Stats),
+		kicks:            make(chan kick),
+		batches:          make(chan []Event),
+		syncs:            make(chan chan struct{}),
+		presenceRequests: make(chan presenceRequest),
+		clientsRequests:  make(chan chan []ClientDetails),
+		reports:          make(chan reportRequest),
+		released:         make(chan string),
+		coalescing:       make(map[latestKey]*Event),
+		patchStates:      make(map[string]*patchState),
+		topicSeqs:        make(map[string]uint64),
+		coalesced:        make(chan latestKey),
+		waiting:          make(map[string][]chan BroadcastResult),
+		formatter:        FormatEvent,
+		quit:             make(chan struct{}),
+		done:             make(chan struct{}),
+		metricsNamespace: "sse",
+		authorizeStatus:  http.StatusUnauthorized,
+		retryAfter:       10 * time.Second,
+		queueSize:        10, // buffer 10 msgs and don't block sends
+		headers: http.Header{
+			"Content-Type":  {"text/event-stream"},
+			"Cache-Control": {"no-cache, no-transform"},
+			"Connection":    {"keep-alive"},
+			// Keeps nginx from buffering the stream
+			"X-Accel-Buffering": {"no"},
+		},
+		logger:    nopLogger{},
+		upgrader:  &websocket.Upgrader{},
+		encoder:   JSONEncoder,
+		numShards: 1,
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	for _, o := range opts {
+		o(b)
+	}
+	b.live.Store(b.configured())
+	b.ready = make(chan *client, b.queueSize)
+	b.messages = make(chan Event, b.queueSize)
+	b.direct = make(chan directMessage, b.queueSize)
+	b.outbound = make(chan Event, b.queueSize)
+	b.metrics = newMetrics(b.metricsNamespace, b.metadataLabel, b.tenants != nil)
+	if b.tenants != nil {
+		b.tenants.forget = b.metrics.forgetTenant
+	}
+	b.nodeID = randomClientID(nil)[:8]
+	for i := 0; i < b.numShards; i++ {
+		b.shards = append(b.shards, newShard())
 	}
 	return b
 }
@@ -43,75 +484,823 @@ func NewSSEHandler() *SSEHandler {
 // Start handling new and disconnected clients, as well as sending messages to
 // all connected clients.
 func (b *SSEHandler) HandleEvents() {
+	b.launched.Store(true)
+	b.started = time.Now()
+	b.running.Store(true)
+	if b.broker != nil {
+		go b.forwardBroker()
+	}
+	if b.publishesQueued() {
+		go b.publishQueued()
+	}
+	b.startShards()
+	b.startWriters()
 	go func() {
-		for {
-			select {
-			case s := <-b.newClients:
-				b.clients[s] = true
-			case s := <-b.defunctClients:
-				delete(b.clients, s)
-				close(s)
-			case msg := <-b.messages:
-				for s, _ := range b.clients {
-					s <- msg
-				}
-			}
+		for b.handleNext() {
+		}
+	}()
+}
+
+// Handle the next request to the event loop. Returns false once the handler
+// has been closed and the loop stopped. Panics, such as in a hook or
+// formatter, are recovered and reported, keeping the loop alive.
+func (b *SSEHandler) handleNext() (more bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			b.recovered("event loop", v)
+			more = true
+		}
+	}()
+	select {
+	case s := <-b.newClients:
+		b.addClient(s)
+	case s := <-b.defunctClients:
+		b.removeClient(s)
+	case msg := <-b.messages:
+		b.receive(msg)
+	case batch := <-b.batches:
+		// Events sent before the batch go out before it
+		b.sendQueued()
+		b.broadcastBatch(batch)
+	case topic := <-b.released:
+		b.release(topic)
+	case k := <-b.coalesced:
+		b.releaseKey(k)
+	case msg := <-b.direct:
+		b.sendDirect(msg)
+	case m := <-b.memberships:
+		b.changeMembership(m)
+	case pause := <-b.pauses:
+		b.setPaused(pause)
+	case req := <-b.statsRequests:
+		req <- b.stats()
+	case k := <-b.kicks:
+		// Replies are sent even if there's a panic, so that the
+		// callers aren't left waiting.
+		var err error
+		defer func() { k.done <- err }()
+		err = b.kick(k)
+	case req := <-b.syncs:
+		defer close(req)
+		b.sendQueued()
+	case <-b.pressureTick():
+		b.recheckPressure()
+	case req := <-b.reports:
+		b.watch(req)
+	case req := <-b.clientsRequests:
+		req <- b.clientDetails()
+	case req := <-b.presenceRequests:
+		req.reply <- b.presence(req.topic)
+	case <-b.quit:
+		b.stop()
+		return false
+	}
+	return true
+}
+
+// Stop the event loop, once the handler has been closed. It's stopped even if
+// it panics while shutting down.
+func (b *SSEHandler) stop() {
+	defer func() {
+		if v := recover(); v != nil {
+			b.recovered("shutdown", v)
+		}
+		b.running.Store(false)
+		close(b.done)
+	}()
+	b.stopPressureTicker()
+	b.cancelScheduled()
+	b.shutdown()
+	b.stopShards()
+	b.stopWriters()
+}
+
+// Attach a new client to the handler, a shard and its topics, sending it any
+// events it missed since it was last connected.
+func (b *SSEHandler) addClient(s *client) {
+	b.clients[s] = true
+	b.clientCount.Add(1)
+	b.metrics.clients.Inc()
+	b.metrics.connects.Inc()
+	b.metrics.addLabeled(s, 1)
+	b.ids[s.id] = s
+	if s.user != "" {
+		if b.users[s.user] == nil {
+			b.users[s.user] = make(map[*client]bool)
+			b.announcePresence(s, "join")
+		}
+		b.users[s.user][s] = true
+	}
+	s.shard = b.shards[b.nextShard%len(b.shards)]
+	b.nextShard++
+	s.shard.add(s)
+	b.logger.Debug("Client connected", "client", s.id, "user", s.user)
+	for _, msg := range b.missedEvents(s) {
+		if !b.deliver(s, b.newMessage(msg)) {
+			b.removeClient(s)
+			break
+		}
+	}
+}
+
+// Detach a client from the handler and its topics.
+func (b *SSEHandler) removeClient(s *client) {
+	if !b.clients[s] {
+		// Already removed
+		return
+	}
+	delete(b.clients, s)
+	b.clientCount.Add(-1)
+	b.metrics.clients.Dec()
+	b.metrics.disconnects.Inc()
+	b.metrics.addLabeled(s, -1)
+	if b.ids[s.id] == s {
+		delete(b.ids, s.id)
+	}
+	if s.user != "" {
+		delete(b.users[s.user], s)
+		if len(b.users[s.user]) < 1 {
+			delete(b.users, s.user)
+			b.announcePresence(s, "leave")
 		}
+	}
+	s.shard.remove(s)
+	if b.latest != nil {
+		b.latest.forget(s.follows, b.watched)
+	}
+	b.logger.Debug("Client disconnected", "client", s.id, "user", s.user)
+	s.closing.Store(true)
+	close(s.events)
+	b.schedule(s)
+}
+
+// Send out an event to all connected clients, or only those subscribed to
+// the event's topic.
+func (b *SSEHandler) broadcast(msg Event) {
+	if b.hold(func() { b.broadcast(msg) }, msg) {
+		return
+	}
+	msg = b.sequence(b.patch(msg))
+	start := time.Now()
+	defer func() {
+		b.eventsSent++
+		b.lastBroadcast.Store(time.Now().UnixNano())
+		b.metrics.broadcasts.Inc()
+		b.metrics.latency.Observe(time.Since(start).Seconds())
 	}()
+
+	b.remember(msg)
+	if b.latest != nil {
+		b.latest.put(msg)
+	}
+	m := b.newMessage(msg)
+	if b.tracer == nil {
+		b.report(msg.ID, b.fanOut(m))
+		return
+	}
+	var span trace.Span
+	m.trace, span = b.startBroadcastSpan(msg)
+	result := b.fanOut(m)
+	endBroadcastSpan(span, result)
+	b.report(msg.ID, result)
+}
+
+// Format an event, ready to be written to clients.
+func (b *SSEHandler) newMessage(msg Event) message {
+	if b.topicEventNames && msg.Event == "" && msg.Topic != "" {
+		named := msg
+		named.Event = msg.Topic
+		return message{event: msg, raw: b.formatter(named), priority: b.priorityOf(msg)}
+	}
+	return message{event: msg, raw: b.formatter(msg), priority: b.priorityOf(msg)}
+}
+
+// Send out an event to a single client or user, if connected. The event isn't
+// kept in history, as it's private to the client.
+func (b *SSEHandler) sendDirect(msg directMessage) {
+	if b.hold(func() { b.sendDirect(msg) }, msg.event) {
+		return
+	}
+	if msg.local {
+		b.fanOut(b.newMessage(msg.event))
+		return
+	}
+	if msg.userID != "" {
+		if len(b.users[msg.userID]) < 1 {
+			b.keepForUser(msg.userID, msg.event)
+			return
+		}
+		m := b.newMessage(msg.event)
+		for s, _ := range b.users[msg.userID] {
+			if !b.deliver(s, m) {
+				b.removeClient(s)
+			}
+		}
+		return
+	}
+	s, found := b.ids[msg.clientID]
+	if !found {
+		return
+	}
+	if !b.deliver(s, b.newMessage(msg.event)) {
+		b.removeClient(s)
+	}
+}
+
+// Send out any messages still waiting in the queue or held back by a
+// throttle or coalescing, and the shutdown event, then disconnect all
+// clients.
+func (b *SSEHandler) shutdown() {
+	b.setPaused(false)
+	b.releaseCoalesced()
+	b.releaseThrottled()
+	for pending := true; pending; {
+		select {
+		case msg := <-b.messages:
+			if batch, ok := unpackBatch(msg); ok {
+				b.broadcastBatch(batch)
+			} else {
+				b.broadcast(msg)
+			}
+		case msg := <-b.direct:
+			b.sendDirect(msg)
+		default:
+			pending = false
+		}
+	}
+	if b.shutdownEvent != nil {
+		b.broadcast(*b.shutdownEvent)
+	}
+	for s, _ := range b.clients {
+		b.removeClient(s)
+	}
+}
+
+// Check if the handler has been closed, see Close.
+func (b *SSEHandler) closed() bool {
+	select {
+	case <-b.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close the handler, disconnecting all clients and stopping the event loop.
+// New clients are refused and new messages dropped from now on. Blocks until
+// the event loop has stopped or ctx is done, in which case ctx's error is
+// returned. Returns right away if HandleEvents was never called. See Drain
+// for a graceful shutdown.
+func (b *SSEHandler) Close(ctx context.Context) error {
+	b.quitOnce.Do(func() {
+		close(b.quit)
+		b.cancel()
+	})
+	if !b.launched.Load() {
+		return nil
+	}
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Keep the event in history, if there's a store.
+func (b *SSEHandler) remember(msg Event) {
+	if b.store == nil {
+		return
+	}
+	if _, shared := b.store.(SharedStore); shared {
+		// Already inserted by publish
+		return
+	}
+	if err := b.store.Append(msg); err != nil {
+		b.fail("store", "", err, "Error while storing event")
+	}
+}
+
+// Get the events a new client should be sent before any new ones. That's any
+// backfill it accepts, its snapshots, the events it never acknowledged and
+// those kept for its user while offline, followed by either the events it
+// missed since it was last connected, or the last few events if WithSendLast
+// is set followed by the latest ones if WithLatest is, and then the snapshots
+// of topics sent as JSON Patches. Stale events are left out. Reconnecting
+// clients are sent a ReplayEvent last, with WithSequenceNumbers.
+func (b *SSEHandler) missedEvents(s *client) []Event {
+	var missed []Event
+	for _, e := range s.backfill {
+		if s.accepts(e) {
+			missed = append(missed, e)
+		}
+	}
+	missed = append(missed, s.snapshots...)
+	sent := make(map[string]bool, len(s.unacked))
+	for _, e := range s.unacked {
+		if s.accepts(e) {
+			missed = append(missed, e)
+			sent[e.ID] = true
+		}
+	}
+	s.backfill, s.snapshots, s.unacked = nil, nil, nil
+	missed = append(missed, b.userInbox(s)...)
+	var stored []Event
+	events, complete := b.storedEvents(s)
+	for _, msg := range events {
+		if !sent[msg.ID] {
+			stored = append(stored, msg)
+			sent[msg.ID] = true
+		}
+	}
+	if b.latest != nil && s.lastEventID == "" {
+		for _, msg := range b.latest.wanted(s) {
+			if !sent[msg.ID] {
+				stored = append(stored, msg)
+			}
+		}
+	}
+	missed = b.dropExpired(append(missed, b.withSnapshots(s, stored)...))
+	if b.sequenceAll && s.lastEventID != "" {
+		missed = append(missed, replayEvent(complete))
+	}
+	return missed
+}
+
+// Get the events in history a new client should be sent, and whether they're
+// all the events it missed since it was last connected.
+func (b *SSEHandler) storedEvents(s *client) ([]Event, bool) {
+	if b.store == nil || (s.lastEventID == "" && b.sendLast < 1) {
+		return nil, false
+	}
+	since := s.lastEventID
+	if b.sequenceAll {
+		// Range doesn't tell if the ID was found, so look for it instead
+		since = ""
+	}
+	events, err := b.store.Range(since)
+	if err != nil {
+		b.fail("replay", "", err, "Error while replaying events")
+		return nil, false
+	}
+	complete := false
+	if since != s.lastEventID {
+		for i, msg := range events {
+			if msg.ID == s.lastEventID {
+				events, complete = events[i+1:], true
+				break
+			}
+		}
+	}
+	var missed []Event
+	for _, msg := range events {
+		if s.wants(msg) {
+			missed = append(missed, msg)
+		}
+	}
+	if s.lastEventID == "" && len(missed) > b.sendLast {
+		missed = missed[len(missed)-b.sendLast:]
+	}
+	return missed, complete
+}
+
+// Send out an event to all clients.
+func (b *SSEHandler) Send(e Event) {
+	if err := b.publish(b.ctx, e); err != nil && err != ErrNotRunning && err != ErrCircuitOpen && err != context.Canceled {
+		b.fail("publish", "", err, "Error while sending event")
+	}
+}
+
+// Try sending out an event to all clients, without blocking. Returns
+// ErrNotRunning if the event loop isn't running, or ErrBufferFull if the
+// handler can't keep up with the rate of new messages. With a broker or a
+// shared store set, the event is queued to be published in the background
+// instead and any errors are logged.
+func (b *SSEHandler) TrySend(e Event) error {
+	if !b.running.Load() {
+		return ErrNotRunning
+	}
+	if b.pressured.Load() {
+		return ErrBackpressure
+	}
+	if b.publishesQueued() {
+		// The middleware runs once the event is published
+		return b.tryQueue(b.outbound, e)
+	}
+	return b.intercept(func(ctx context.Context, e Event) error {
+		return b.tryQueue(b.messages, b.assignID(ctx, withExpiry(e)))
+	})(b.ctx, e)
+}
+
+// Push an event into a queue, without blocking.
+func (b *SSEHandler) tryQueue(queue chan Event, e Event) error {
+	// The queue might have room left after closing, and select picks
+	// randomly between ready cases.
+	if b.closed() {
+		return ErrNotRunning
+	}
+	select {
+	case queue <- e:
+		return nil
+	case <-b.quit:
+		return ErrNotRunning
+	default:
+		return ErrBufferFull
+	}
+}
+
+// Send out an event to all clients, blocking until it has been queued or ctx
+// is done. Returns ErrNotRunning if the event loop isn't running, or ctx's
+// error. Returns ErrCircuitOpen if the event was only sent out to this
+// instance's clients, see WithCircuitBreaker, so it shouldn't be sent again.
+func (b *SSEHandler) SendContext(ctx context.Context, e Event) error {
+	if !b.running.Load() {
+		return ErrNotRunning
+	}
+	if b.pressured.Load() {
+		return ErrBackpressure
+	}
+	return b.publish(ctx, e)
 }
 
 // Send out a simple string to all clients.
 func (b *SSEHandler) SendString(msg string) {
-	b.messages <- msg
+	b.Send(Event{Data: []byte(msg)})
+}
+
+// Send out a JSON string object to all clients. Returns an error if the
+// object can't be marshalled to JSON. The object is encoded by the handler's
+// encoder, which uses JSON unless set by WithEncoder.
+func (b *SSEHandler) SendJSON(obj interface{}) error {
+	return b.SendEventJSON("", obj)
+}
+
+// Same as SendJSON, but panics if the object can't be marshalled to JSON.
+func (b *SSEHandler) MustSendJSON(obj interface{}) {
+	if err := b.SendJSON(obj); err != nil {
+		panic(fmt.Sprint("Error while sending JSON object: ", err))
+	}
+}
+
+// Send out a simple string as a named event to all clients. Browsers can
+// listen for it with addEventListener(name, ...).
+func (b *SSEHandler) SendEvent(name, msg string) {
+	b.Send(Event{Event: name, Data: []byte(msg)})
+}
+
+// Send out a JSON string object as a named event to all clients. Returns an
+// error if the object can't be marshalled to JSON. See SendJSON.
+func (b *SSEHandler) SendEventJSON(name string, obj interface{}) error {
+	tmp, err := b.encode("", obj)
+	if err != nil {
+		return err
+	}
+	b.Send(Event{Event: name, Data: tmp})
+	return nil
+}
+
+// Send out a simple string with a user supplied event ID to all clients.
+func (b *SSEHandler) SendWithID(id, msg string) {
+	b.Send(Event{ID: id, Data: []byte(msg)})
+}
+
+// Send out an event to a single client, with an ID as given by ClientID.
+// The event is dropped if the client isn't connected.
+func (b *SSEHandler) SendTo(clientID string, e Event) {
+	select {
+	case b.direct <- directMessage{clientID: clientID, event: withExpiry(e)}:
+	case <-b.quit:
+	}
+}
+
+// Send out an event to all clients of a single user, as identified by the
+// WithUserID option. The event is dropped if the user has no clients
+// connected, unless it's kept in the inbox set by WithInbox.
+func (b *SSEHandler) SendToUser(userID string, e Event) {
+	select {
+	case b.direct <- directMessage{userID: userID, event: withExpiry(e)}:
+	case <-b.quit:
+	}
+}
+
+// Disconnect a client, with an ID as given by ClientID, closing its stream.
+// If reason isn't empty it's first sent to the client, as the data of a
+// "disconnect" event. Returns ErrNotRunning if the event loop isn't running,
+// or ErrClientNotFound if the client isn't connected. Browsers reconnect by
+// themselves, so access must be revoked elsewhere as well, such as with
+// WithAuthorize.
+func (b *SSEHandler) Disconnect(clientID, reason string) error {
+	if !b.running.Load() {
+		return ErrNotRunning
+	}
+	k := kick{clientID: clientID, reason: reason, done: make(chan error, 1)}
+	select {
+	case b.kicks <- k:
+		return <-k.done
+	case <-b.done:
+		return ErrNotRunning
+	}
+}
+
+// Disconnect a client, as requested by Disconnect. Only called by the event
+// loop.
+func (b *SSEHandler) kick(k kick) error {
+	s, found := b.ids[k.clientID]
+	if !found {
+		return ErrClientNotFound
+	}
+	defer b.removeClient(s)
+	if k.reason != "" {
+		msg := b.newMessage(Event{Event: "disconnect", Data: []byte(k.reason)})
+		b.deliver(s, msg)
+	}
+	return nil
 }
 
-// Send out a JSON string object to all clients.
-func (b *SSEHandler) SendJSON(obj interface{}) {
-	tmp, err := json.Marshal(obj)
+// Send out an object to the clients subscribed to topic, encoded by the
+// topic's encoder if set by WithTopicEncoder, or by the handler's. Returns an
+// error if the object can't be encoded.
+func (b *SSEHandler) PublishObject(topic string, obj interface{}) error {
+	tmp, err := b.encode(topic, obj)
 	if err != nil {
-		log.Panic("Error while sending JSON object:", err)
+		return err
 	}
-	b.messages <- string(tmp)
+	b.Send(Event{Topic: topic, Data: tmp})
+	return nil
 }
 
-// Subscribe a new client and start sending out messages to it.
-func (b *SSEHandler) Subscribe(c *gin.Context) {
-	w := c.Writer
-	f, ok := w.(http.Flusher)
+// Send out a simple string to the clients subscribed to topic.
+func (b *SSEHandler) Publish(topic, msg string) {
+	b.Send(Event{Topic: topic, Data: []byte(msg)})
+}
+
+// Subscribe a new client and start sending out messages to it. The client
+// receives events published to any of the topics, as well as events sent to
+// all clients. Topics are split into levels by "/" and may be patterns with
+// MQTT-style wildcards: "+" matches any single level, as in "sensors/+/temp",
+// while "#" as the last level matches any number of levels, as in "logs/#".
+// Events are published to plain topics, without wildcards.
+func (b *SSEHandler) Subscribe(c *gin.Context, topics ...string) {
+	b.subscribe(c, nil, topics, b.openSSE)
+}
+
+// Same as Subscribe, but the client only receives the events accepted by the
+// filter. The filter is called by the event loop for each event and must not
+// block.
+func (b *SSEHandler) SubscribeWithFilter(c *gin.Context, filter func(Event) bool, topics ...string) {
+	b.subscribe(c, filter, topics, b.openSSE)
+}
+
+func (b *SSEHandler) subscribe(c *gin.Context, filter func(Event) bool, topics []string, open opener) {
+	if b.cors != nil && !b.allowOrigin(c) {
+		return
+	}
+	if !b.admit(c) {
+		return
+	}
+	if b.rateLimiter != nil && !b.rateLimiter.allow(c) {
+		b.reject(c, http.StatusTooManyRequests, ErrRateLimited)
+		return
+	}
+
+	// Reserve a slot for the client before doing anything else, so
+	// concurrent clients can't go over the limit.
+	settings := b.settings()
+	if n := b.connections.Add(1); settings.maxClients > 0 && n > int64(settings.maxClients) {
+		b.connections.Add(-1)
+		if b.retryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(b.retryAfter)))
+		}
+		b.reject(c, http.StatusServiceUnavailable, ErrTooManyClients)
+		return
+	}
+	defer b.connections.Add(-1)
+
+	var auth ClientInfo
+	if b.authorize != nil {
+		var err error
+		if auth, err = b.authorize(c); err != nil {
+			b.reject(c, b.authorizeStatus, err)
+			return
+		}
+	}
+	tenant, release, ok := b.admitTenant(c, auth)
 	if !ok {
-		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("Streaming unsupported"))
 		return
 	}
+	defer release()
 
 	// Create a new channel, over which we can send this client messages.
-	messageChan := make(chan string)
+	messageChan := make(chan message, settings.clientBuffer)
+	cl := &client{
+		gone:        make(chan struct{}),
+		id:          auth.ID,
+		user:        auth.UserID,
+		claims:      auth.Claims,
+		events:      messageChan,
+		lastEventID: c.Request.Header.Get("Last-Event-ID"),
+		topics:      topics,
+		connected:   time.Now(),
+		ip:          c.ClientIP(),
+		userAgent:   c.Request.UserAgent(),
+		filter:      filter,
+		tenant:      tenant,
+	}
+	if cl.id == "" && b.clientID != nil {
+		cl.id = b.clientID(c)
+	}
+	if cl.id == "" {
+		cl.id = randomClientID(c)
+	}
+	if cl.user == "" && b.userID != nil {
+		cl.user = b.userID(c)
+	}
+	if b.metadata != nil {
+		cl.metadata = b.metadata(c)
+	}
+	if b.tenants != nil {
+		// IDs are only unique within a tenant, like topics
+		cl.id = TenantTopic(tenant, cl.id)
+		if cl.user != "" {
+			cl.user = TenantTopic(tenant, cl.user)
+		}
+	}
+	c.Set(ClientIDKey, cl.id)
+	if b.topicsParam != "" {
+		cl.topics = queryTopics(topics, c.Query(b.topicsParam))
+	}
+	if b.topicACL != nil {
+		cl.allowed = b.topicACL(c, cl.info())
+	}
+	cl.topics = cl.allowedTopics(cl.topics)
+	if b.tenants != nil {
+		cl.topics = tenantTopics(tenant, cl.topics)
+	}
+	// The client's topics can change while it's connected, so the hooks get
+	// the info as it was when connecting. It's not safe to read later on.
+	info := cl.info()
+	if b.authorizeEvent != nil {
+		cl.permit = func(e Event) bool {
+			return b.authorizeEvent(info, e)
+		}
+	}
+	if b.backfill != nil {
+		var err error
+		if cl.backfill, err = b.backfill(c.Request.Context(), info); err != nil {
+			b.fail("backfill", cl.id, err, "Error while loading backfill")
+		}
+	}
+	if b.snapshot != nil {
+		cl.snapshots = b.loadSnapshots(c.Request.Context(), cl)
+	}
+	if b.acks != nil {
+		cl.unacked = b.acks.unacked(cl.id)
+	}
+	if !open(c, cl) {
+		return
+	}
+
+	// Hold off any writers until the client is ready
+	cl.mu.Lock()
 	// Add this client to the map of those that should receive updates
-	b.newClients <- messageChan
+	select {
+	case b.newClients <- cl:
+	case <-b.quit:
+		cl.mu.Unlock()
+		b.reject(c, http.StatusServiceUnavailable, ErrNotRunning)
+		return
+	}
+	disconnected, err := cl.w.Open()
+	if err != nil {
+		cl.mu.Unlock()
+		b.fail("open", cl.id, err, "Error while opening stream")
+		select {
+		case b.defunctClients <- cl:
+		case <-b.quit:
+		}
+		return
+	}
+
+	if b.onDisconnect != nil {
+		defer b.onDisconnect(info)
+	}
 
-	notify := w.(http.CloseNotifier).CloseNotify()
 	go func() {
-		<-notify
+		select {
+		case <-disconnected:
+		case <-b.quit:
+			// The handler disconnects all clients by itself when closed
+			return
+		}
 		// Remove this client from the map of attached clients
-		b.defunctClients <- messageChan
+		select {
+		case b.defunctClients <- cl:
+		case <-b.quit:
+		}
 	}()
+	cl.mu.Unlock()
 
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
+	if b.onConnect != nil {
+		// The hook runs while the client's messages are being read below,
+		// so the event loop can't get stuck on this client if the hook
+		// calls back into the handler.
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.onConnect(c, info)
+		}()
+		defer wg.Wait()
+	}
 
+	// Keep idle connections alive with a comment now and then, so that
+	// proxies won't time them out. A nil channel blocks forever, disabling
+	// the heartbeat. It's started anew whenever the handler is
+	// reconfigured.
+	var heartbeat <-chan time.Time
+	var ticker *time.Ticker
+	startHeartbeat := func() {
+		if ticker != nil {
+			ticker.Stop()
+			ticker, heartbeat = nil, nil
+		}
+		if settings.heartbeat > 0 {
+			ticker = time.NewTicker(settings.heartbeat)
+			heartbeat = ticker.C
+		}
+	}
+	startHeartbeat()
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+
+	// With a writer pool the messages are written by the pool, so only
+	// wait for the client to be gone. A nil channel blocks forever.
+	events := messageChan
+	if b.writers > 0 {
+		events = nil
+	}
+
+loop:
 	for {
-		msg, open := <-messageChan
-		if !open {
-			// If our messageChan was closed, this means that
-			// the client has disconnected.
-			break
+		select {
+		case msg, open := <-events:
+			if !open {
+				// If our messageChan was closed, this means that
+				// the client has disconnected.
+				break loop
+			}
+			cl.mu.Lock()
+			b.write(cl, msg)
+			b.flush(cl)
+		case <-cl.gone:
+			break loop
+		case <-settings.replaced:
+			settings = b.settings()
+			startHeartbeat()
+			continue
+		case <-heartbeat:
+			cl.mu.Lock()
+			b.setWriteDeadline(cl)
+			if err := cl.w.Ping(); err != nil {
+				b.writeFailed(cl, err)
+			}
+			b.flushNow(cl)
 		}
+		cl.mu.Unlock()
+	}
 
-		fmt.Fprintf(w, "data: Message: %s\n\n", msg)
-		// Flush the response. This is only possible if the repsonse
-		// supports streaming.
-		f.Flush()
+	// Flush anything held back by WithFlushInterval, before the stream is
+	// done with.
+	cl.mu.Lock()
+	if cl.unflushed > 0 {
+		b.flushNow(cl)
+	}
+	if cl.flushTimer != nil {
+		cl.flushTimer.Stop()
 	}
+	cl.w.Close()
+	cl.finished = true
+	cl.mu.Unlock()
+
+	c.Abort()
+}
 
-	c.AbortWithStatus(http.StatusOK)
+// Get a gin handler that subscribes new clients to the topics.
+func (b *SSEHandler) Handler(topics ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b.Subscribe(c, topics...)
+	}
+}
+
+// Round the duration up to whole seconds, as the Retry-After header can't
+// hold anything shorter, with at least 1 second.
+func retryAfterSeconds(d time.Duration) int {
+	secs := int((d + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
 }
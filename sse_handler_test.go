@@ -0,0 +1,605 @@
+package ssehandler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Make a handler with n connected clients, without starting the event loop.
+func benchHandler(n int) *SSEHandler {
+	b := NewSSEHandler(WithClientBuffer(1), WithSlowClientPolicy(DropOldest))
+	for i := 0; i < n; i++ {
+		b.addClient(&client{
+			id:     strconv.Itoa(i),
+			events: make(chan message, 1),
+		})
+	}
+	return b
+}
+
+func BenchmarkBroadcast(b *testing.B) {
+	const clients = 10000
+	event := Event{ID: "1", Event: "price", Data: []byte(`{"symbol":"ABC","price":12.34}`)}
+
+	b.Run("per-client", func(b *testing.B) {
+		h := benchHandler(clients)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			// How events were sent before being formatted once
+			for s := range h.clients {
+				h.deliver(s, message{event: event, raw: h.formatter(event)})
+			}
+		}
+	})
+
+	b.Run("shared", func(b *testing.B) {
+		h := benchHandler(clients)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			h.fanOut(h.newMessage(event))
+		}
+	})
+}
+
+func TestTrySend(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(b *SSEHandler)
+		want  []error
+	}{
+		{"running", func(b *SSEHandler) { b.HandleEvents() }, []error{nil}},
+		{"not running", func(b *SSEHandler) {}, []error{ErrNotRunning}},
+		{"full", func(b *SSEHandler) { b.running.Store(true) }, []error{nil, ErrBufferFull}},
+		{"closed", func(b *SSEHandler) {
+			// Closing while the event loop is still winding down, with
+			// room left in the queue.
+			b.running.Store(true)
+			b.Close(context.Background())
+		}, []error{ErrNotRunning, ErrNotRunning, ErrNotRunning, ErrNotRunning}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewSSEHandler(WithQueueSize(1))
+			tt.setup(b)
+			defer b.Close(context.Background())
+			for i, want := range tt.want {
+				if err := b.TrySend(Event{}); err != want {
+					t.Errorf("send %d: got %v, want %v", i, err, want)
+				}
+			}
+		})
+	}
+}
+
+// A stream collecting the events sent to a test client.
+type testStream struct {
+	events chan Event
+	done   chan struct{}
+}
+
+func (s testStream) Send(e Event) error    { s.events <- e; return nil }
+func (s testStream) Done() <-chan struct{} { return s.done }
+
+// Get the data of the next event sent to the client, or "" if none arrives
+// within wait.
+func (s testStream) next(wait time.Duration) string {
+	select {
+	case e := <-s.events:
+		return string(e.Data)
+	case <-time.After(wait):
+		return ""
+	}
+}
+
+// Subscribe a test client with the ID to the topics, returning once it's
+// connected. The returned channel is closed once the client has been removed.
+func subscribeTest(t *testing.T, b *SSEHandler, id string, filter func(Event) bool, topics ...string) (testStream, <-chan struct{}) {
+	t.Helper()
+	s := testStream{events: make(chan Event, 10), done: make(chan struct{})}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Request.Header.Set("X-Client", id)
+	n := b.ClientCount()
+	removed := make(chan struct{})
+	go func() {
+		defer close(removed)
+		b.SubscribeStream(c, s, filter, topics...)
+	}()
+	for b.ClientCount() <= n {
+		select {
+		case <-removed:
+			t.Fatalf("client %s was refused", id)
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return s, removed
+}
+
+// Make a handler taking the client IDs from the X-Client header.
+func testHandler(opts ...Option) *SSEHandler {
+	opts = append(opts, WithClientID(func(c *gin.Context) string {
+		return c.GetHeader("X-Client")
+	}))
+	b := NewSSEHandler(opts...)
+	b.HandleEvents()
+	return b
+}
+
+func TestSendTo(t *testing.T) {
+	b := testHandler()
+	defer b.Close(context.Background())
+	clients := map[string]testStream{}
+	for _, id := range []string{"a", "b"} {
+		clients[id], _ = subscribeTest(t, b, id, nil)
+	}
+
+	tests := []struct {
+		to   string
+		want map[string]string
+	}{
+		{"a", map[string]string{"a": "a", "b": ""}},
+		{"b", map[string]string{"a": "", "b": "b"}},
+		{"missing", map[string]string{"a": "", "b": ""}},
+	}
+	for _, tt := range tests {
+		b.SendTo(tt.to, Event{Data: []byte(tt.to)})
+		for id, want := range tt.want {
+			wait := time.Second
+			if want == "" {
+				wait = 20 * time.Millisecond
+			}
+			if got := clients[id].next(wait); got != want {
+				t.Errorf("sent to %s: client %s got %q, want %q", tt.to, id, got, want)
+			}
+		}
+	}
+}
+
+func TestSendToUser(t *testing.T) {
+	// The users are named by the first letter of their clients
+	b := testHandler(WithUserID(func(c *gin.Context) string {
+		return c.GetHeader("X-Client")[:1]
+	}))
+	defer b.Close(context.Background())
+	clients := map[string]testStream{}
+	for _, id := range []string{"a1", "a2", "b1"} {
+		clients[id], _ = subscribeTest(t, b, id, nil)
+	}
+
+	tests := []struct {
+		to   string
+		want map[string]string
+	}{
+		{"a", map[string]string{"a1": "a", "a2": "a", "b1": ""}},
+		{"b", map[string]string{"a1": "", "a2": "", "b1": "b"}},
+		{"missing", map[string]string{"a1": "", "a2": "", "b1": ""}},
+	}
+	for _, tt := range tests {
+		b.SendToUser(tt.to, Event{Data: []byte(tt.to)})
+		for id, want := range tt.want {
+			wait := time.Second
+			if want == "" {
+				wait = 20 * time.Millisecond
+			}
+			if got := clients[id].next(wait); got != want {
+				t.Errorf("sent to %s: client %s got %q, want %q", tt.to, id, got, want)
+			}
+		}
+	}
+}
+
+func TestOnConnectDisconnect(t *testing.T) {
+	tests := []struct {
+		name       string
+		disconnect func(b *SSEHandler, s testStream)
+	}{
+		{"client left", func(b *SSEHandler, s testStream) { close(s.done) }},
+		{"kicked", func(b *SSEHandler, s testStream) { b.Disconnect("a", "") }},
+		{"closed", func(b *SSEHandler, s testStream) { b.Close(context.Background()) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connected := make(chan ClientInfo, 1)
+			disconnected := make(chan ClientInfo, 1)
+			b := testHandler(WithOnConnect(func(c *gin.Context, info ClientInfo) {
+				connected <- info
+			}), WithOnDisconnect(func(info ClientInfo) {
+				disconnected <- info
+			}))
+			defer b.Close(context.Background())
+			s, removed := subscribeTest(t, b, "a", nil)
+			select {
+			case info := <-connected:
+				if info.ID != "a" {
+					t.Errorf("got %+v connected", info)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("OnConnect wasn't called")
+			}
+
+			tt.disconnect(b, s)
+			<-removed
+			select {
+			case info := <-disconnected:
+				if info.ID != "a" {
+					t.Errorf("got %+v disconnected", info)
+				}
+			default:
+				t.Error("OnDisconnect wasn't called before the client's handler returned")
+			}
+		})
+	}
+}
+
+// Get the data of the events sent to the client, up to the one with the data
+// "end".
+func (s testStream) until(t *testing.T) []string {
+	t.Helper()
+	var got []string
+	for {
+		data := s.next(time.Second)
+		if data == "" {
+			t.Fatalf("no end event, after %q", got)
+		}
+		if data == "end" {
+			return got
+		}
+		got = append(got, data)
+	}
+}
+
+func TestSubscribeWithFilter(t *testing.T) {
+	tests := []struct {
+		event string
+		want  bool
+	}{
+		{"", true},
+		{"keep", true},
+		{"skip", false},
+		{"keep", true},
+	}
+	b := testHandler()
+	defer b.Close(context.Background())
+	s, _ := subscribeTest(t, b, "a", func(e Event) bool {
+		return e.Event != "skip"
+	})
+	var want []string
+	for i, tt := range tests {
+		data := strconv.Itoa(i)
+		b.Send(Event{Event: tt.event, Data: []byte(data)})
+		if tt.want {
+			want = append(want, data)
+		}
+	}
+	b.Send(Event{Data: []byte("end")})
+	if got := s.until(t); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestEventAuthorize(t *testing.T) {
+	b := testHandler(WithEventAuthorize(func(info ClientInfo, e Event) bool {
+		return e.Event != "secret" || info.ID == "admin"
+	}))
+	defer b.Close(context.Background())
+	admin, _ := subscribeTest(t, b, "admin", nil)
+	user, _ := subscribeTest(t, b, "user", nil)
+
+	tests := []struct {
+		event string
+		to    string // Sent to a single client, if set
+		want  string
+	}{
+		{"", "", "admin,user"},
+		{"secret", "", "admin"},
+		{"secret", "user", "user"},
+	}
+	for _, tt := range tests {
+		if tt.to != "" {
+			b.SendTo(tt.to, Event{Event: tt.event, Data: []byte("x")})
+		} else {
+			b.Send(Event{Event: tt.event, Data: []byte("x")})
+		}
+		for id, s := range map[string]testStream{"admin": admin, "user": user} {
+			want := strings.Contains(tt.want, id)
+			wait := 20 * time.Millisecond
+			if want {
+				wait = time.Second
+			}
+			if got := s.next(wait) != ""; got != want {
+				t.Errorf("event %q to %q: client %s got it %v, want %v", tt.event, tt.to, id, got, want)
+			}
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want int
+	}{
+		{"10.0.0.1", http.StatusOK},
+		{"10.0.0.1", http.StatusOK},
+		{"10.0.0.1", http.StatusTooManyRequests},
+		{"10.0.0.2", http.StatusOK},
+	}
+	b := testHandler(WithRateLimit(0.001, 2))
+	defer b.Close(context.Background())
+	for i, tt := range tests {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.RemoteAddr = tt.ip + ":1234"
+		c.Request.Header.Set("X-Client", strconv.Itoa(i))
+		n := b.ClientCount()
+		removed := make(chan struct{})
+		go func() {
+			defer close(removed)
+			b.SubscribeStream(c, testStream{events: make(chan Event, 10), done: make(chan struct{})}, nil)
+		}()
+		got := http.StatusOK
+		for b.ClientCount() <= n {
+			select {
+			case <-removed:
+				got = rec.Code
+			case <-time.After(time.Millisecond):
+				continue
+			}
+			break
+		}
+		if got != tt.want {
+			t.Errorf("client %d from %s: got %d, want %d", i, tt.ip, got, tt.want)
+		}
+	}
+}
+
+// A stream counting the bytes written and flushed to a test client.
+type flushStream struct {
+	mu       sync.Mutex
+	written  int
+	flushed  int // Bytes written before the last flush
+	deadline time.Time
+}
+
+func (s *flushStream) Open() (<-chan struct{}, error) { return nil, nil }
+func (s *flushStream) Ping() error                    { return nil }
+func (s *flushStream) Close() error                   { return nil }
+
+func (s *flushStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.written += len(p)
+	return len(p), nil
+}
+
+func (s *flushStream) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushed = s.written
+	return nil
+}
+
+func (s *flushStream) SetWriteDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadline = t
+	return nil
+}
+
+// Write an event of 10 bytes to a test client, as its request handler does.
+func writeTest(b *SSEHandler, s *client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b.write(s, message{event: Event{Data: []byte("ab")}, raw: []byte("data: ab\n\n")})
+	b.flush(s)
+}
+
+func TestFlushInterval(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		size     int
+		now      int // Bytes flushed right after writing
+		later    int // Bytes flushed once the interval has passed
+	}{
+		{0, 0, 30, 30},
+		{20 * time.Millisecond, 0, 0, 30},
+		{20 * time.Millisecond, 20, 20, 30},
+		{time.Hour, 20, 20, 20},
+	}
+	for _, tt := range tests {
+		b := NewSSEHandler(WithFlushInterval(tt.interval, tt.size))
+		w := &flushStream{}
+		s := &client{id: "a", w: w}
+		for i := 0; i < 3; i++ {
+			writeTest(b, s)
+		}
+		w.mu.Lock()
+		now := w.flushed
+		w.mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		s.mu.Lock()
+		w.mu.Lock()
+		if now != tt.now || w.flushed != tt.later {
+			t.Errorf("%v, %d bytes: got %d and %d bytes flushed, want %d and %d",
+				tt.interval, tt.size, now, w.flushed, tt.now, tt.later)
+		}
+		w.mu.Unlock()
+		if s.flushTimer != nil {
+			s.flushTimer.Stop()
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	for _, d := range []time.Duration{0, time.Second} {
+		b := NewSSEHandler(WithWriteTimeout(d))
+		w := &flushStream{}
+		before := time.Now()
+		writeTest(b, &client{id: "a", w: w})
+		after := time.Now()
+		if d == 0 && !w.deadline.IsZero() {
+			t.Errorf("got deadline %v without a timeout", w.deadline)
+		}
+		if d > 0 && (w.deadline.Before(before.Add(d)) || w.deadline.After(after.Add(d))) {
+			t.Errorf("got deadline %v for %v, written at %v", w.deadline, d, before)
+		}
+	}
+
+	// Clients that stop reading are disconnected, once the buffers along
+	// the way have filled up.
+	gin.SetMode(gin.ReleaseMode)
+	b := testHandler(WithWriteTimeout(10 * time.Millisecond))
+	defer b.Close(context.Background())
+	r := gin.New()
+	r.GET("/events", b.Handler())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET /events HTTP/1.1\r\nHost: test\r\nX-Client: a\r\n\r\n")
+	for b.ClientCount() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	data := bytes.Repeat([]byte("x"), 1<<16)
+	for i := 0; b.ClientCount() > 0; i++ {
+		if i > 1000 {
+			t.Fatal("client wasn't disconnected")
+		}
+		b.Send(Event{Data: data})
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMustSendJSON(t *testing.T) {
+	tests := []struct {
+		obj   interface{}
+		data  string
+		panic bool
+	}{
+		{map[string]int{"a": 1}, `{"a":1}`, false},
+		{[]string{"x"}, `["x"]`, false},
+		{make(chan int), "", true},
+	}
+	for _, tt := range tests {
+		b := NewSSEHandler(WithReplay(10))
+		b.HandleEvents()
+		func() {
+			defer func() {
+				if got := recover() != nil; got != tt.panic {
+					t.Errorf("%v: got panic %v", tt.obj, got)
+				}
+			}()
+			b.MustSendJSON(tt.obj)
+		}()
+		b.Sync(context.Background())
+		events, _ := b.store.Range("")
+		if tt.panic && len(events) > 0 {
+			t.Errorf("%v: got events %+v", tt.obj, events)
+		}
+		if !tt.panic && (len(events) != 1 || string(events[0].Data) != tt.data) {
+			t.Errorf("%v: got events %+v, want %s", tt.obj, events, tt.data)
+		}
+		b.Close(context.Background())
+	}
+}
+
+func TestSync(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name  string
+		setup func(b *SSEHandler)
+		ctx   context.Context
+		want  error
+	}{
+		{"running", func(b *SSEHandler) { b.HandleEvents() }, context.Background(), nil},
+		{"not running", func(b *SSEHandler) {}, context.Background(), ErrNotRunning},
+		{"closed", func(b *SSEHandler) {
+			b.HandleEvents()
+			b.Close(context.Background())
+		}, context.Background(), ErrNotRunning},
+		{"canceled", func(b *SSEHandler) { b.running.Store(true) }, canceled, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewSSEHandler(WithQueueSize(100), WithReplay(100))
+			tt.setup(b)
+			defer b.Close(context.Background())
+			sent := 0
+			for i := 0; i < 50; i++ {
+				if b.TrySend(Event{ID: strconv.Itoa(i)}) == nil {
+					sent++
+				}
+			}
+			if err := b.Sync(tt.ctx); err != tt.want {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if tt.want != nil {
+				return
+			}
+			events, _ := b.store.Range("")
+			if len(events) != sent || sent != 50 {
+				t.Errorf("got %d of %d events handed over", len(events), sent)
+			}
+		})
+	}
+}
+
+func TestInitialComment(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	b := NewSSEHandler(WithInitialComment("hello", 8))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	r := gin.New()
+	r.GET("/events", b.Handler())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// Read before anything is sent, so the comment must have been flushed
+	want := ": hello        \n\n"
+	got := make(chan string)
+	go func() {
+		buf := make([]byte, len(want))
+		io.ReadFull(resp.Body, buf)
+		got <- string(buf)
+	}()
+	select {
+	case s := <-got:
+		if s != want {
+			t.Errorf("got %q, want %q", s, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no initial comment flushed")
+	}
+	b.SendString("first")
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() && !strings.HasPrefix(sc.Text(), "data: ") {
+	}
+	if sc.Text() != "data: first" {
+		t.Errorf("got %q after the comment", sc.Text())
+	}
+}
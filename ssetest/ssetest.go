@@ -0,0 +1,178 @@
+// Test client for the SSE handler, for asserting what handlers actually send
+// out in integration tests using httptest servers.
+
+package ssetest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ssehandler "github.com/lmas/gin-sse"
+)
+
+// A Client reads the events of a single SSE stream.
+type Client struct {
+	resp   *http.Response
+	events chan ssehandler.Event
+
+	mu          sync.Mutex
+	err         error
+	lastEventID string
+	retry       time.Duration
+}
+
+// Connect to the SSE stream at url, with any extra request headers such as
+// Last-Event-ID. The stream is read until ctx is done or Close is called.
+func Dial(ctx context.Context, url string, header http.Header) (*Client, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	cl := &Client{
+		resp:   resp,
+		events: make(chan ssehandler.Event, 64),
+	}
+	go cl.read()
+	return cl, nil
+}
+
+// Connect to the SSE stream at path on srv, failing the test on errors. The
+// client is closed when the test is done.
+func Connect(t testing.TB, srv *httptest.Server, path string) *Client {
+	t.Helper()
+	cl, err := Dial(context.Background(), srv.URL+path, nil)
+	if err != nil {
+		t.Fatal("Error while connecting to SSE stream:", err)
+	}
+	t.Cleanup(cl.Close)
+	return cl
+}
+
+// Close the connection.
+func (cl *Client) Close() {
+	cl.resp.Body.Close()
+}
+
+// Get the response of the stream, such as for checking its headers.
+func (cl *Client) Response() *http.Response {
+	return cl.resp
+}
+
+// Get the ID of the last event received, as a browser would send it in the
+// Last-Event-ID header when reconnecting.
+func (cl *Client) LastEventID() string {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.lastEventID
+}
+
+// Get the last reconnection time sent by the server, if any.
+func (cl *Client) Retry() time.Duration {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.retry
+}
+
+// Wait for the next event, until ctx is done. Returns io.EOF once the stream
+// has ended, or the error that ended it.
+func (cl *Client) Next(ctx context.Context) (ssehandler.Event, error) {
+	select {
+	case e, ok := <-cl.events:
+		if !ok {
+			cl.mu.Lock()
+			defer cl.mu.Unlock()
+			return e, cl.err
+		}
+		return e, nil
+	case <-ctx.Done():
+		return ssehandler.Event{}, ctx.Err()
+	}
+}
+
+// Wait for the next n events, until ctx is done. Returns the events received
+// so far along with any error.
+func (cl *Client) Collect(ctx context.Context, n int) ([]ssehandler.Event, error) {
+	var events []ssehandler.Event
+	for len(events) < n {
+		e, err := cl.Next(ctx)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// Read and parse the stream, following the rules of the SSE spec.
+func (cl *Client) read() {
+	defer close(cl.events)
+	sc := bufio.NewScanner(cl.resp.Body)
+	sc.Buffer(nil, 1<<20)
+	var e ssehandler.Event
+	var data []string
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			// Dispatch the event, if it has any data
+			if data != nil {
+				e.Data = []byte(strings.Join(data, "\n"))
+				cl.events <- e
+			}
+			e, data = ssehandler.Event{}, nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// Comment, such as a heartbeat
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			e.ID = value
+			cl.mu.Lock()
+			cl.lastEventID = value
+			cl.mu.Unlock()
+		case "event":
+			e.Event = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				e.Retry = time.Duration(ms) * time.Millisecond
+				cl.mu.Lock()
+				cl.retry = e.Retry
+				cl.mu.Unlock()
+			}
+		}
+	}
+	err := sc.Err()
+	if err == nil || errors.Is(err, context.Canceled) {
+		err = io.EOF
+	}
+	cl.mu.Lock()
+	cl.err = err
+	cl.mu.Unlock()
+}
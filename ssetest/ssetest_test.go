@@ -0,0 +1,95 @@
+package ssetest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	ssehandler "github.com/lmas/gin-sse"
+)
+
+func TestClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := ssehandler.NewSSEHandler(
+		ssehandler.WithReplay(10),
+		ssehandler.WithRetry(2*time.Second),
+	)
+	h.HandleEvents()
+	r := gin.New()
+	r.GET("/events", h.Handler())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cl := Connect(t, srv, "/events")
+	for h.ClientCount() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	h.SendString("one\ntwo")
+	h.SendEvent("price", "3")
+	events, err := cl.Collect(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(events[0].Data) != "one\ntwo" || events[1].Event != "price" || string(events[1].Data) != "3" {
+		t.Fatalf("got %+v", events)
+	}
+	if cl.Retry() != 2*time.Second || cl.LastEventID() != events[1].ID {
+		t.Fatalf("got retry %s and last ID %q", cl.Retry(), cl.LastEventID())
+	}
+
+	// Reconnecting replays the missed events
+	h.SendString("missed")
+	header := http.Header{"Last-Event-ID": {events[1].ID}}
+	again, err := Dial(ctx, srv.URL+"/events", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	e, err := again.Next(ctx)
+	if err != nil || string(e.Data) != "missed" {
+		t.Fatalf("got %+v, %v", e, err)
+	}
+
+	if err := h.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.Collect(ctx, 2); err != io.EOF {
+		t.Fatalf("got %v, want EOF", err)
+	}
+}
+
+type price struct {
+	Symbol string  `json:"symbol"`
+	Price  float64 `json:"price"`
+}
+
+func TestTypedClient(t *testing.T) {
+	h := ssehandler.NewSSEHandler(ssehandler.WithRetry(time.Second))
+	h.HandleEvents()
+	prices := ssehandler.NewTypedHandler[price](h, nil)
+	r := gin.New()
+	r.GET("/prices", prices.Unwrap().Handler())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	defer h.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cl := NewTypedClient[price](Connect(t, srv, "/prices"), nil)
+	for h.ClientCount() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := prices.Send(price{"ABC", 1.5}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := cl.Next(ctx)
+	if err != nil || got != (price{"ABC", 1.5}) {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,50 @@
+package ssetest
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// A TypedClient wraps a client for decoding the payloads of the events it
+// receives into values of type T, such as those sent by a TypedHandler.
+type TypedClient[T any] struct {
+	*Client
+	decode func([]byte) (T, error)
+}
+
+// Make a new TypedClient reading from cl, with payloads decoded by decode, or
+// as JSON if nil.
+func NewTypedClient[T any](cl *Client, decode func([]byte) (T, error)) *TypedClient[T] {
+	if decode == nil {
+		decode = func(data []byte) (T, error) {
+			var v T
+			err := json.Unmarshal(data, &v)
+			return v, err
+		}
+	}
+	return &TypedClient[T]{Client: cl, decode: decode}
+}
+
+// Wait for the next event and decode its payload, until ctx is done.
+func (tc *TypedClient[T]) Next(ctx context.Context) (T, error) {
+	e, err := tc.Client.Next(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return tc.decode(e.Data)
+}
+
+// Wait for the next n events and decode their payloads, until ctx is done.
+// Returns the payloads decoded so far along with any error.
+func (tc *TypedClient[T]) Collect(ctx context.Context, n int) ([]T, error) {
+	var values []T
+	for len(values) < n {
+		v, err := tc.Next(ctx)
+		if err != nil {
+			return values, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
@@ -0,0 +1,66 @@
+package ssehandler
+
+import "time"
+
+// A snapshot of a handler's statistics, see Stats.
+type Stats struct {
+	// Number of connected clients.
+	Clients int
+
+	// Number of clients subscribed to each topic, or pattern of topics.
+	Topics map[string]int
+
+	// Total number of events broadcast.
+	EventsSent uint64
+
+	// Most messages waiting in any single client's buffer. See Clients for
+	// each client's.
+	MaxQueued int
+
+	// Time since the event loop was started.
+	Uptime time.Duration
+}
+
+// Get the number of connected clients.
+func (b *SSEHandler) ClientCount() int {
+	return int(b.clientCount.Load())
+}
+
+// Get a snapshot of the handler's statistics. An empty snapshot is returned
+// if the event loop isn't running.
+func (b *SSEHandler) Stats() Stats {
+	if !b.running.Load() {
+		return Stats{Topics: map[string]int{}}
+	}
+	req := make(chan Stats, 1)
+	select {
+	case b.statsRequests <- req:
+		return <-req
+	case <-b.done:
+		return Stats{Topics: map[string]int{}}
+	}
+}
+
+// Create a snapshot of the statistics. Only called by the event loop.
+func (b *SSEHandler) stats() Stats {
+	s := Stats{
+		Clients:    len(b.clients),
+		Topics:     make(map[string]int),
+		EventsSent: b.eventsSent,
+		Uptime:     time.Since(b.started),
+	}
+	for c := range b.clients {
+		if n := len(c.events); n > s.MaxQueued {
+			s.MaxQueued = n
+		}
+	}
+	for _, sh := range b.shards {
+		for t, clients := range sh.topics {
+			s.Topics[t] += len(clients)
+		}
+		for p, clients := range sh.patterns {
+			s.Topics[p] += len(clients)
+		}
+	}
+	return s
+}
@@ -0,0 +1,165 @@
+package ssehandler
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// An EventStore keeps a history of broadcast events, used for replaying
+// missed events to reconnecting clients. See WithEventStore.
+type EventStore interface {
+	// Append an event to the history.
+	Append(e Event) error
+
+	// Get the events appended after the one with the given ID, oldest
+	// first. If the ID is empty or can't be found (it's too old or unknown)
+	// all of history is returned.
+	Range(sinceID string) ([]Event, error)
+}
+
+// A SharedStore is an EventStore shared by the handlers on all instances,
+// such as one kept in a database. Events are inserted into it by the handler
+// sending them, before they're published through any broker, instead of being
+// appended by every handler broadcasting them. This also keeps the store's
+// writes out of the event loop.
+type SharedStore interface {
+	EventStore
+
+	// Insert an event into the history, returning it with the ID assigned
+	// by the store if it had none.
+	Insert(ctx context.Context, e Event) (Event, error)
+}
+
+// A RingStore is an EventStore keeping the most recent events in memory,
+// dropping the oldest ones when it's full.
+type RingStore struct {
+	mu     sync.Mutex
+	events []Event
+	start  int // Index of the oldest event
+	count  int
+}
+
+// Make a new RingStore keeping up to size events. A size of 0 or less keeps
+// nothing.
+func NewRingStore(size int) *RingStore {
+	if size < 0 {
+		size = 0
+	}
+	return &RingStore{
+		events: make([]Event, size),
+	}
+}
+
+// Append an event, dropping the oldest one if the store is full.
+func (r *RingStore) Append(e Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) < 1 {
+		return nil
+	}
+	if r.count < len(r.events) {
+		r.events[(r.start+r.count)%len(r.events)] = e
+		r.count++
+		return nil
+	}
+	r.events[r.start] = e
+	r.start = (r.start + 1) % len(r.events)
+	return nil
+}
+
+// Get the events appended after the one with the given ID.
+func (r *RingStore) Range(sinceID string) ([]Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	from := 0
+	if sinceID != "" {
+		for i := r.count - 1; i >= 0; i-- {
+			if r.at(i).ID == sinceID {
+				from = i + 1
+				break
+			}
+		}
+	}
+	events := make([]Event, 0, r.count-from)
+	for i := from; i < r.count; i++ {
+		events = append(events, r.at(i))
+	}
+	return events, nil
+}
+
+// Get the i:th oldest event.
+func (r *RingStore) at(i int) Event {
+	return r.events[(r.start+i)%len(r.events)]
+}
+
+// A CompactStore is an EventStore keeping the most recent events in memory,
+// like a RingStore, but only the latest event of each key within a topic, so
+// that replays send the current state instead of every stale update. Events
+// without a key are all kept.
+type CompactStore struct {
+	mu     sync.Mutex
+	size   int
+	events *list.List // Oldest first
+	keys   map[latestKey]*list.Element
+}
+
+// Make a new CompactStore keeping up to size events. A size of 0 or less
+// keeps nothing.
+func NewCompactStore(size int) *CompactStore {
+	return &CompactStore{
+		size:   size,
+		events: list.New(),
+		keys:   make(map[latestKey]*list.Element),
+	}
+}
+
+// Append an event, dropping any older event with the same key and the oldest
+// one if the store is full.
+func (c *CompactStore) Append(e Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size < 1 {
+		return nil
+	}
+	k := latestKey{e.Topic, e.Key}
+	if e.Key != "" {
+		if old, found := c.keys[k]; found {
+			c.events.Remove(old)
+		}
+	}
+	el := c.events.PushBack(e)
+	if e.Key != "" {
+		c.keys[k] = el
+	}
+	if c.events.Len() > c.size {
+		oldest := c.events.Front()
+		o := oldest.Value.(Event)
+		if ko := (latestKey{o.Topic, o.Key}); o.Key != "" && c.keys[ko] == oldest {
+			delete(c.keys, ko)
+		}
+		c.events.Remove(oldest)
+	}
+	return nil
+}
+
+// Get the events appended after the one with the given ID, that haven't been
+// replaced by later events with the same key.
+func (c *CompactStore) Range(sinceID string) ([]Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	from := c.events.Front()
+	if sinceID != "" {
+		for el := c.events.Back(); el != nil; el = el.Prev() {
+			if el.Value.(Event).ID == sinceID {
+				from = el.Next()
+				break
+			}
+		}
+	}
+	var events []Event
+	for el := from; el != nil; el = el.Next() {
+		events = append(events, el.Value.(Event))
+	}
+	return events, nil
+}
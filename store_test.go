@@ -0,0 +1,87 @@
+package ssehandler
+
+import (
+	"strconv"
+	"testing"
+)
+
+func joinIDs(events []Event) string {
+	var s string
+	for _, e := range events {
+		s += e.ID
+	}
+	return s
+}
+
+func TestRingStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		appends int
+		sinceID string
+		want    string
+	}{
+		{"empty", 3, 0, "", ""},
+		{"all", 3, 2, "", "12"},
+		{"since", 3, 3, "1", "23"},
+		{"since latest", 3, 3, "3", ""},
+		{"wraparound", 3, 5, "", "345"},
+		{"wraparound since", 3, 5, "3", "45"},
+		{"too old", 3, 5, "1", "345"},
+		{"unknown", 3, 2, "x", "12"},
+		{"zero size", 0, 2, "", ""},
+		{"negative size", -1, 2, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRingStore(tt.size)
+			for i := 1; i <= tt.appends; i++ {
+				if err := r.Append(Event{ID: strconv.Itoa(i)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			events, err := r.Range(tt.sinceID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := joinIDs(events); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompactStore(t *testing.T) {
+	type appended struct{ id, key string }
+	tests := []struct {
+		name    string
+		size    int
+		events  []appended
+		sinceID string
+		want    string
+	}{
+		{"no keys", 3, []appended{{"1", ""}, {"2", ""}}, "", "12"},
+		{"compacted", 5, []appended{{"1", "a"}, {"2", "b"}, {"3", "a"}, {"4", ""}}, "", "234"},
+		{"compacted since", 5, []appended{{"1", "a"}, {"2", "b"}, {"3", "a"}, {"4", "b"}}, "1", "34"},
+		{"since replaced", 5, []appended{{"1", "a"}, {"2", "b"}, {"3", "a"}}, "1", "23"},
+		{"full", 2, []appended{{"1", "a"}, {"2", "b"}, {"3", "c"}, {"4", "b"}}, "", "34"},
+		{"zero size", 0, []appended{{"1", "a"}}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCompactStore(tt.size)
+			for _, a := range tt.events {
+				if err := c.Append(Event{ID: a.id, Key: a.key}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			events, err := c.Range(tt.sinceID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := joinIDs(events); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package ssehandler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A stream carries a client's events, such as its SSE response or a
+// WebSocket. Writes must hold the client's lock.
+type stream interface {
+	// Start streaming, once the client has been added to the handler.
+	// Returns a channel closed once the client has disconnected.
+	Open() (<-chan struct{}, error)
+
+	// Write a single event.
+	Write(p []byte) (int, error)
+
+	// Flush what's been written so far out to the client.
+	Flush() error
+
+	// Limit the time the next writes may take.
+	SetWriteDeadline(t time.Time) error
+
+	// Write a heartbeat, keeping the connection alive.
+	Ping() error
+
+	// End the stream, once the client has been removed.
+	Close() error
+}
+
+// Prepares the stream of a new client, before it's added to the handler, such
+// as SSE or WebSocket. Returns false if the client can't be streamed to, after
+// responding with an error.
+type opener func(c *gin.Context, cl *client) bool
+
+// Comment sent as a heartbeat.
+var ping = []byte(": ping\n\n")
+
+// Heartbeat of NDJSON streams, an empty line.
+var ndjsonPing = []byte("\n")
+
+// Make a comment with the text, padded with at least n spaces, see
+// WithInitialComment.
+func commentBlock(text string, n int) []byte {
+	var buf strings.Builder
+	buf.WriteString(":")
+	if text = stripLineBreaks(text); text != "" {
+		buf.WriteString(" " + text)
+	}
+	buf.WriteString(strings.Repeat(" ", n))
+	buf.WriteString("\n\n")
+	return []byte(buf.String())
+}
+
+// A stream of Server-Sent Events, in the standard text/event-stream format,
+// or of NDJSON.
+type sseStream struct {
+	c     *gin.Context
+	w     gin.ResponseWriter
+	rc    *http.ResponseController
+	retry time.Duration
+	ping  []byte
+
+	// Written before any events, see WithInitialComment.
+	preamble []byte
+}
+
+// Prepare a SSE stream for the client, with the handler's headers and
+// compression if enabled. NDJSON is streamed instead if enabled by WithNDJSON
+// or asked for by the client's Accept header.
+func (b *SSEHandler) openSSE(c *gin.Context, cl *client) bool {
+	w := c.Writer
+	if _, ok := w.(http.Flusher); !ok {
+		b.reject(c, http.StatusBadRequest, ErrStreamingUnsupported)
+		return false
+	}
+	for k, v := range b.headers {
+		w.Header()[k] = v
+	}
+	if b.headerFunc != nil {
+		b.headerFunc(c, w.Header())
+	}
+	s := &sseStream{
+		c:     c,
+		rc:    http.NewResponseController(unwrapWriter(w)),
+		retry: b.settings().retry,
+		ping:  ping,
+	}
+	if b.initialComment != "" || b.padding > 0 {
+		s.preamble = commentBlock(b.initialComment, b.padding)
+	}
+	if b.ndjson || strings.Contains(c.Request.Header.Get("Accept"), ndjsonType) {
+		w.Header().Set("Content-Type", ndjsonType)
+		s.retry = 0
+		s.ping = ndjsonPing
+		s.preamble = nil
+		cl.format = FormatNDJSON
+	}
+	s.w = b.compress(c)
+	c.Writer = s.w
+	cl.w = s
+	return true
+}
+
+func (s *sseStream) Open() (<-chan struct{}, error) {
+	if s.preamble != nil {
+		s.w.Write(s.preamble)
+	}
+	if s.retry > 0 {
+		fmt.Fprintf(s.w, "retry: %d\n\n", s.retry.Milliseconds())
+	}
+	// Send the headers right away, even with nothing else to write, as
+	// some clients don't consider the stream open before then.
+	s.w.WriteHeaderNow()
+	s.w.Flush()
+	// The request's context is cancelled when the client disconnects.
+	return s.c.Request.Context().Done(), nil
+}
+
+func (s *sseStream) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+func (s *sseStream) Flush() error {
+	s.w.Flush()
+	// Gin's writer drops any error, but it sticks to the one underneath.
+	return s.rc.Flush()
+}
+
+// Get the response writer underneath gin's, if any, whose flushes report
+// errors.
+func unwrapWriter(w gin.ResponseWriter) http.ResponseWriter {
+	if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); ok {
+		return u.Unwrap()
+	}
+	return w
+}
+
+func (s *sseStream) SetWriteDeadline(t time.Time) error {
+	return s.rc.SetWriteDeadline(t)
+}
+
+func (s *sseStream) Ping() error {
+	_, err := s.w.Write(s.ping)
+	return err
+}
+
+func (s *sseStream) Close() error {
+	closeCompressor(s.w)
+	return nil
+}
+
+// A Stream carries the events of a client subscribed over a transport of its
+// own, such as gRPC. See SubscribeStream.
+type Stream interface {
+	// Send a single event to the client. The client is disconnected if an
+	// error is returned.
+	Send(e Event) error
+
+	// Get a channel that's closed once the client has disconnected.
+	Done() <-chan struct{}
+}
+
+// Writes events to a stream as they are, instead of their formatted bytes.
+type eventWriter interface {
+	WriteEvent(e Event) error
+}
+
+// A stream of events over a Stream, see SubscribeStream.
+type customStream struct {
+	s Stream
+}
+
+// Subscribe a new client over the stream, as with SubscribeWithFilter, using
+// c for any of the hooks and options taking a gin context, such as
+// WithAuthorize. The client's events are sent as is, without formatting, to
+// the stream. Blocks until the client has disconnected or been removed. The
+// filter may be nil.
+func (b *SSEHandler) SubscribeStream(c *gin.Context, s Stream, filter func(Event) bool, topics ...string) {
+	b.subscribe(c, filter, topics, func(c *gin.Context, cl *client) bool {
+		cl.w = &customStream{s: s}
+		return true
+	})
+}
+
+func (s *customStream) Open() (<-chan struct{}, error) {
+	return s.s.Done(), nil
+}
+
+func (s *customStream) WriteEvent(e Event) error {
+	return s.s.Send(e)
+}
+
+func (s *customStream) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (s *customStream) Flush() error { return nil }
+
+func (s *customStream) SetWriteDeadline(time.Time) error { return nil }
+
+func (s *customStream) Ping() error { return nil }
+
+func (s *customStream) Close() error { return nil }
@@ -0,0 +1,42 @@
+package ssehandler
+
+import "context"
+
+// Block until all events queued so far have been pushed into the buffers of
+// their clients, or ctx is done. Meant for tests, making assertions on what
+// clients received deterministic. Events sent through a broker, or queued by
+// TrySend for one, are only covered once they've reached the event loop, and
+// events held back by a throttle or coalescing aren't covered.
+// Returns ErrNotRunning if the event loop isn't running, or ctx's error.
+func (b *SSEHandler) Sync(ctx context.Context) error {
+	if !b.running.Load() {
+		return ErrNotRunning
+	}
+	req := make(chan struct{})
+	select {
+	case b.syncs <- req:
+	case <-b.done:
+		return ErrNotRunning
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-req:
+		return nil
+	case <-b.done:
+		return ErrNotRunning
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Send out the events waiting in the queues right now, but not any queued
+// meanwhile. Only called by the event loop.
+func (b *SSEHandler) sendQueued() {
+	for n := len(b.messages); n > 0; n-- {
+		b.receive(<-b.messages)
+	}
+	for n := len(b.direct); n > 0; n-- {
+		b.sendDirect(<-b.direct)
+	}
+}
@@ -0,0 +1,236 @@
+package ssehandler
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// The quotas of a tenant, see WithTenants. Zero values are unlimited.
+type TenantLimits struct {
+	// Most clients of the tenant connected at once. Further clients are
+	// refused with 503 Service Unavailable.
+	MaxClients int
+
+	// Rate of new clients of the tenant per second, with bursts of up to
+	// Burst clients, or 1 if not set. Clients over the limit are refused with
+	// 429 Too Many Requests.
+	Rate  rate.Limit
+	Burst int
+
+	// Rate of the events sent with SendToTenant per second, with bursts of
+	// up to EventBurst events, or 1 if not set. Events over the limit are
+	// refused with ErrOverQuota.
+	EventRate  rate.Limit
+	EventBurst int
+}
+
+// The state of a tenant seen by the handler.
+type tenant struct {
+	limits  TenantLimits
+	clients atomic.Int64
+	joins   *rate.Limiter
+	events  *rate.Limiter
+}
+
+// Most tenants kept track of at once. Tenants without clients are forgotten
+// once their quotas have filled up again, and new tenants are refused while
+// there's no room for them.
+const maxTenants = 10000
+
+// The tenants seen by the handler, see WithTenants.
+type tenants struct {
+	key    func(*gin.Context, ClientInfo) string
+	limits func(string) TenantLimits
+	max    int
+
+	// Called with the key of each tenant that's forgotten, if set.
+	forget func(string)
+
+	mu        sync.Mutex
+	tenants   map[string]*tenant
+	lastSweep time.Time
+}
+
+// Get the state of a tenant, setting it up the first time it's seen. With join
+// set, the tenant's client count is raised before the lock is let go, so the
+// tenant can't be forgotten in between. Returns nil if the tenant is new and
+// there's no room for it.
+func (t *tenants) get(key string, join bool) *tenant {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweep(false)
+	tn, found := t.tenants[key]
+	if !found {
+		if len(t.tenants) >= t.max {
+			t.sweep(true)
+		}
+		if len(t.tenants) >= t.max {
+			return nil
+		}
+		tn = &tenant{}
+		if t.limits != nil {
+			tn.limits = t.limits(key)
+		}
+		if tn.limits.Burst < 1 {
+			tn.limits.Burst = 1
+		}
+		if tn.limits.EventBurst < 1 {
+			tn.limits.EventBurst = 1
+		}
+		if tn.limits.Rate > 0 {
+			tn.joins = rate.NewLimiter(tn.limits.Rate, tn.limits.Burst)
+		}
+		if tn.limits.EventRate > 0 {
+			tn.events = rate.NewLimiter(tn.limits.EventRate, tn.limits.EventBurst)
+		}
+		t.tenants[key] = tn
+	}
+	if join {
+		tn.clients.Add(1)
+	}
+	return tn
+}
+
+// Forget about the tenants without clients whose quotas have filled up again,
+// now and then or right away if forced, so the map doesn't grow forever. They
+// would start over with the same quotas anyway.
+func (t *tenants) sweep(force bool) {
+	if !force && time.Since(t.lastSweep) < time.Minute {
+		return
+	}
+	t.lastSweep = time.Now()
+	for key, tn := range t.tenants {
+		if tn.clients.Load() > 0 || !refilled(tn.joins) || !refilled(tn.events) {
+			continue
+		}
+		delete(t.tenants, key)
+		if t.forget != nil {
+			t.forget(key)
+		}
+	}
+}
+
+// Check if a quota's bucket is full, or if there's no quota.
+func refilled(l *rate.Limiter) bool {
+	return l == nil || l.Tokens() >= float64(l.Burst())
+}
+
+// Get the topic a tenant's events are published to, namespacing it by the
+// tenant. Events sent to a tenant without a topic reach all of its clients.
+func TenantTopic(tenant, topic string) string {
+	if topic == "" {
+		return tenant
+	}
+	return tenant + "/" + topic
+}
+
+// Check if a tenant's key can be used to namespace topics.
+func validTenant(key string) bool {
+	return key != "" && !strings.ContainsAny(key, "/+#")
+}
+
+// Admit a new client into its tenant, if tenants are set, checking its quotas.
+// The tenant is taken from the client's authorized info. Rejects the client
+// and returns false if it's refused, or else returns the tenant's key and a
+// function releasing the client's slot once it's gone.
+func (b *SSEHandler) admitTenant(c *gin.Context, auth ClientInfo) (string, func(), bool) {
+	if b.tenants == nil {
+		return "", func() {}, true
+	}
+	key := b.tenants.key(c, auth)
+	if !validTenant(key) {
+		b.reject(c, http.StatusForbidden, ErrInvalidTenant)
+		return "", nil, false
+	}
+	tn := b.tenants.get(key, true)
+	if tn == nil {
+		b.reject(c, http.StatusServiceUnavailable, ErrTooManyTenants)
+		return "", nil, false
+	}
+	if tn.joins != nil && !tn.joins.Allow() {
+		tn.clients.Add(-1)
+		b.metrics.tenantRejections.WithLabelValues(key).Inc()
+		b.reject(c, http.StatusTooManyRequests, ErrRateLimited)
+		return "", nil, false
+	}
+	if n := tn.clients.Load(); tn.limits.MaxClients > 0 && n > int64(tn.limits.MaxClients) {
+		tn.clients.Add(-1)
+		b.metrics.tenantRejections.WithLabelValues(key).Inc()
+		b.reject(c, http.StatusServiceUnavailable, ErrTooManyClients)
+		return "", nil, false
+	}
+	b.metrics.tenantClients.WithLabelValues(key).Inc()
+	return key, func() {
+		tn.clients.Add(-1)
+		b.metrics.tenantClients.WithLabelValues(key).Dec()
+	}, true
+}
+
+// Namespace a tenant's client's topics by its tenant, subscribing it to the
+// tenant's own topic as well.
+func tenantTopics(key string, topics []string) []string {
+	namespaced := []string{key}
+	for _, t := range topics {
+		namespaced = append(namespaced, TenantTopic(key, t))
+	}
+	return namespaced
+}
+
+// Send out an event to the clients of a tenant subscribed to its topic, or all
+// of them if it has none, within the tenant's quota. See WithTenants.
+// Returns ErrOverQuota if the tenant is over its quota, ErrTooManyTenants if
+// it's new and there's no room for it, or else as SendContext.
+func (b *SSEHandler) SendToTenant(key string, e Event) error {
+	if b.tenants == nil || !validTenant(key) {
+		return ErrInvalidTenant
+	}
+	tn := b.tenants.get(key, false)
+	if tn == nil {
+		return ErrTooManyTenants
+	}
+	if tn.events != nil && !tn.events.Allow() {
+		b.metrics.tenantRejections.WithLabelValues(key).Inc()
+		return ErrOverQuota
+	}
+	e.Topic = TenantTopic(key, e.Topic)
+	b.metrics.tenantEvents.WithLabelValues(key).Inc()
+	return b.SendContext(b.ctx, e)
+}
+
+// Send out an event to a single client of a tenant, with an ID as given by
+// ClientID before it's namespaced. See SendTo and WithTenants.
+// Returns ErrInvalidTenant if the tenant key isn't valid.
+func (b *SSEHandler) SendToTenantClient(key, clientID string, e Event) error {
+	if b.tenants == nil || !validTenant(key) {
+		return ErrInvalidTenant
+	}
+	b.SendTo(TenantTopic(key, clientID), e)
+	return nil
+}
+
+// Send out an event to all clients of a single user of a tenant. See
+// SendToUser and WithTenants. Returns ErrInvalidTenant if the tenant key isn't
+// valid.
+func (b *SSEHandler) SendToTenantUser(key, userID string, e Event) error {
+	if b.tenants == nil || !validTenant(key) {
+		return ErrInvalidTenant
+	}
+	b.SendToUser(TenantTopic(key, userID), e)
+	return nil
+}
+
+// Disconnect a client of a tenant, with an ID as given by ClientID before it's
+// namespaced. See Disconnect and WithTenants. Returns ErrInvalidTenant if the
+// tenant key isn't valid, or else as Disconnect.
+func (b *SSEHandler) DisconnectTenant(key, clientID, reason string) error {
+	if b.tenants == nil || !validTenant(key) {
+		return ErrInvalidTenant
+	}
+	return b.Disconnect(TenantTopic(key, clientID), reason)
+}
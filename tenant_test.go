@@ -0,0 +1,161 @@
+package ssehandler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTenants(t *testing.T) {
+	b := NewSSEHandler(WithTenants(func(c *gin.Context, info ClientInfo) string {
+		return c.GetHeader("X-Tenant")
+	}, func(tenant string) TenantLimits {
+		return TenantLimits{MaxClients: 1, EventRate: 1, EventBurst: 1}
+	}))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	admit := func(tenant string) (int, func()) {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.Header.Set("X-Tenant", tenant)
+		_, release, _ := b.admitTenant(c, ClientInfo{})
+		return rec.Code, release
+	}
+
+	code, release := admit("acme")
+	if code != http.StatusOK {
+		t.Errorf("got %d for first client", code)
+	}
+	if code, _ := admit("acme"); code != http.StatusServiceUnavailable {
+		t.Errorf("got %d for client over limit", code)
+	}
+	if code, _ := admit("other"); code != http.StatusOK {
+		t.Errorf("got %d for other tenant", code)
+	}
+	if code, _ := admit("a/b"); code != http.StatusForbidden {
+		t.Errorf("got %d for invalid tenant", code)
+	}
+	release()
+	if code, _ := admit("acme"); code != http.StatusOK {
+		t.Errorf("got %d after release", code)
+	}
+
+	if got := tenantTopics("acme", []string{"orders", "#"}); len(got) != 3 || got[0] != "acme" || got[2] != "acme/#" {
+		t.Errorf("got topics %q", got)
+	}
+	if err := b.SendToTenant("acme", Event{}); err != nil {
+		t.Errorf("got %v", err)
+	}
+	if err := b.SendToTenant("acme", Event{}); err != ErrOverQuota {
+		t.Errorf("got %v over quota", err)
+	}
+}
+
+func TestTenantsForgotten(t *testing.T) {
+	b := NewSSEHandler(WithTenants(func(c *gin.Context, info ClientInfo) string {
+		return info.Claims["tenant"].(string)
+	}, nil))
+	b.tenants.max = 1
+	admit := func(tenant string) (int, func()) {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		_, release, _ := b.admitTenant(c, ClientInfo{Claims: map[string]interface{}{"tenant": tenant}})
+		return rec.Code, release
+	}
+
+	code, release := admit("acme")
+	if code != http.StatusOK {
+		t.Errorf("got %d for first tenant", code)
+	}
+	if code, _ := admit("other"); code != http.StatusServiceUnavailable {
+		t.Errorf("got %d for tenant over limit", code)
+	}
+	release()
+	if code, _ := admit("other"); code != http.StatusOK {
+		t.Errorf("got %d after the first tenant left", code)
+	}
+	if _, found := b.tenants.tenants["acme"]; found {
+		t.Error("first tenant wasn't forgotten")
+	}
+}
+
+func TestTenantLimitsWithoutBurst(t *testing.T) {
+	b := NewSSEHandler(WithTenants(func(c *gin.Context, info ClientInfo) string {
+		return "acme"
+	}, func(tenant string) TenantLimits {
+		return TenantLimits{Rate: 1, EventRate: 1}
+	}))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	if _, _, ok := b.admitTenant(c, ClientInfo{}); !ok {
+		t.Errorf("got %d for first client", rec.Code)
+	}
+	if err := b.SendToTenant("acme", Event{}); err != nil {
+		t.Errorf("got %v for first event", err)
+	}
+	if err := b.SendToTenant("acme", Event{}); err != ErrOverQuota {
+		t.Errorf("got %v for second event", err)
+	}
+}
+
+func TestTenantsSameUser(t *testing.T) {
+	// The tenant is taken from the client ID, and all users are "bob"
+	b := testHandler(WithTenants(func(c *gin.Context, info ClientInfo) string {
+		return c.GetHeader("X-Client")
+	}, nil), WithUserID(func(c *gin.Context) string {
+		return "bob"
+	}), WithPresence("presence"))
+	defer b.Close(context.Background())
+	acme, _ := subscribeTest(t, b, "acme", nil, "presence")
+	other, _ := subscribeTest(t, b, "other", nil, "presence")
+	for _, s := range []testStream{acme, other} {
+		if got := s.next(time.Second); got != `{"user":"bob","status":"join"}` {
+			t.Errorf("got presence %q", got)
+		}
+	}
+
+	tests := []struct {
+		send func() error
+		want map[testStream]string
+	}{
+		{func() error {
+			return b.SendToTenantUser("acme", "bob", Event{Data: []byte("acme")})
+		}, map[testStream]string{acme: "acme", other: ""}},
+		{func() error {
+			return b.SendToTenantClient("other", "other", Event{Data: []byte("other")})
+		}, map[testStream]string{acme: "", other: "other"}},
+		{func() error {
+			b.SendToUser("bob", Event{Data: []byte("bare")})
+			return nil
+		}, map[testStream]string{acme: "", other: ""}},
+	}
+	for _, tt := range tests {
+		if err := tt.send(); err != nil {
+			t.Fatal(err)
+		}
+		for s, want := range tt.want {
+			wait := time.Second
+			if want == "" {
+				wait = 50 * time.Millisecond
+			}
+			if got := s.next(wait); got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		}
+	}
+	if err := b.DisconnectTenant("acme", "other", ""); err != ErrClientNotFound {
+		t.Errorf("got %v disconnecting another tenant's client", err)
+	}
+	if err := b.SendToTenantUser("a/b", "bob", Event{}); err != ErrInvalidTenant {
+		t.Errorf("got %v for invalid tenant", err)
+	}
+}
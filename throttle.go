@@ -0,0 +1,70 @@
+package ssehandler
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limits the rate of events broadcast to a topic, see WithTopicThrottle. Only
+// touched by the event loop.
+type throttle struct {
+	limiter *rate.Limiter
+
+	// The latest event over the limit, if any, and the timer releasing it
+	// once it's due.
+	pending *Event
+	timer   *time.Timer
+}
+
+// Broadcast an event, unless its topic's throttle holds it back. Only called
+// by the event loop.
+func (b *SSEHandler) pass(msg Event) {
+	t := b.throttles[msg.Topic]
+	if t == nil || msg.Topic == "" {
+		b.broadcast(msg)
+		return
+	}
+	if t.pending != nil {
+		// Replace the event already waiting, which is never sent
+		b.report(t.pending.ID, BroadcastResult{})
+		t.pending = &msg
+		return
+	}
+	d := t.limiter.Reserve().Delay()
+	if d <= 0 {
+		b.broadcast(msg)
+		return
+	}
+	t.pending = &msg
+	topic := msg.Topic
+	t.timer = time.AfterFunc(d, func() {
+		select {
+		case b.released <- topic:
+		case <-b.quit:
+		}
+	})
+}
+
+// Broadcast the event held back by a topic's throttle, once it's due. Only
+// called by the event loop.
+func (b *SSEHandler) release(topic string) {
+	t := b.throttles[topic]
+	if t == nil || t.pending == nil {
+		return
+	}
+	msg := *t.pending
+	t.pending, t.timer = nil, nil
+	b.broadcast(msg)
+}
+
+// Broadcast all events held back by throttles right away, when the handler is
+// closed. Only called by the event loop.
+func (b *SSEHandler) releaseThrottled() {
+	for topic, t := range b.throttles {
+		if t.timer != nil {
+			t.timer.Stop()
+		}
+		b.release(topic)
+	}
+}
@@ -0,0 +1,38 @@
+package ssehandler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTopicThrottle(t *testing.T) {
+	b := NewSSEHandler(WithReplay(10), WithTopicThrottle("a", 10, 1))
+	b.HandleEvents()
+	for _, id := range []string{"1", "2", "3", "4"} {
+		b.Send(Event{ID: id, Topic: "a"})
+	}
+	b.Send(Event{ID: "5", Topic: "b"})
+	if err := b.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// The first event goes out right away, while the rest are coalesced
+	// into the latest one, which is due later.
+	if got := history(t, b); got != "15" {
+		t.Fatalf("got %q before the throttle let go", got)
+	}
+	time.Sleep(200 * time.Millisecond)
+	b.Sync(context.Background())
+	if got := history(t, b); got != "154" {
+		t.Fatalf("got %q after the throttle let go", got)
+	}
+	b.Close(context.Background())
+}
+
+func history(t *testing.T, b *SSEHandler) string {
+	events, err := b.store.Range("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return joinIDs(events)
+}
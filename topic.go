@@ -0,0 +1,44 @@
+package ssehandler
+
+import "strings"
+
+// Check if a topic is a pattern, with any levels that are wildcards. Topics
+// are split into levels by "/", as in MQTT: a level of "+" matches any
+// single level, while "#" as the last level matches any number of levels,
+// including none.
+func isPattern(topic string) bool {
+	for _, level := range strings.Split(topic, "/") {
+		if level == "+" || level == "#" {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if a topic is reserved for the handler's own use, by starting with
+// "__" like DebugTopic. Reserved topics are never matched by patterns, and
+// clients only receive them when allowed by WithTopicACL.
+func isReserved(topic string) bool {
+	return strings.HasPrefix(topic, "__")
+}
+
+// Check if the topic matches the pattern, or is the same topic. See
+// isPattern. Reserved topics only match themselves, see isReserved.
+func topicMatches(pattern, topic string) bool {
+	if pattern == topic {
+		return true
+	}
+	if isReserved(topic) {
+		return false
+	}
+	p, t := strings.Split(pattern, "/"), strings.Split(topic, "/")
+	for i, level := range p {
+		if level == "#" && i == len(p)-1 {
+			return true
+		}
+		if i >= len(t) || (level != "+" && level != t[i]) {
+			return false
+		}
+	}
+	return len(p) == len(t)
+}
@@ -0,0 +1,62 @@
+package ssehandler
+
+import "testing"
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		pattern, topic string
+		want           bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/c", false},
+		{"sensors/+/temp", "sensors/1/temp", true},
+		{"sensors/+/temp", "sensors/1/2/temp", false},
+		{"sensors/+/temp", "sensors/temp", false},
+		{"+", "a", true},
+		{"+", "a/b", false},
+		{"logs/#", "logs", true},
+		{"logs/#", "logs/app/error", true},
+		{"logs/#", "logsx", false},
+		{"#", "anything/at/all", true},
+		{"a/#/b", "a/x/b", false},
+		{"a+/b", "ax/b", false},
+		{"#", "__debug", false},
+		{"+", "__debug", false},
+		{"__debug", "__debug", true},
+	}
+	for _, tt := range tests {
+		if got := topicMatches(tt.pattern, tt.topic); got != tt.want {
+			t.Errorf("topicMatches(%q, %q) = %v, want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestPatternFanOut(t *testing.T) {
+	b := NewSSEHandler(WithSlowClientPolicy(DropNewest))
+	clients := map[string]*client{
+		"exact":   {topics: []string{"sensors/1/temp"}},
+		"single":  {topics: []string{"sensors/+/temp"}},
+		"multi":   {topics: []string{"sensors/#"}},
+		"both":    {topics: []string{"sensors/1/temp", "sensors/#", "+/+/temp"}},
+		"other":   {topics: []string{"logs/#"}},
+		"nothing": {},
+	}
+	for id, s := range clients {
+		s.id = id
+		s.events = make(chan message, 10)
+		s.gone = make(chan struct{})
+		b.addClient(s)
+	}
+	got := b.fanOut(b.newMessage(Event{Topic: "sensors/1/temp"}))
+	if got.Enqueued != 4 {
+		t.Errorf("got %+v, want 4 clients", got)
+	}
+	for id, want := range map[string]int{"exact": 1, "single": 1, "multi": 1, "both": 1, "other": 0, "nothing": 0} {
+		if n := len(clients[id].events); n != want {
+			t.Errorf("client %s got %d events, want %d", id, n, want)
+		}
+	}
+	if !b.ids["single"].wants(Event{Topic: "sensors/2/temp"}) {
+		t.Error("pattern subscriber doesn't want a matching event")
+	}
+}
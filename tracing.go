@@ -0,0 +1,89 @@
+package ssehandler
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the tracer, as the instrumentation scope of the spans.
+const tracerName = "github.com/lmas/gin-sse"
+
+// Carries the trace context in the events' attributes, using the W3C Trace
+// Context keys "traceparent" and "tracestate".
+var tracePropagator = propagation.TraceContext{}
+
+// Wrap a sender in a span for publishing the event, as a child of any span in
+// ctx, and carry the span's context along in the event's attributes.
+func (b *SSEHandler) tracePublish(next Sender) Sender {
+	return func(ctx context.Context, e Event) error {
+		ctx, span := b.tracer.Start(ctx, "sse.publish",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(eventAttributes(e)...),
+		)
+		// The attributes are copied, as the map might be shared with
+		// other events.
+		attrs := make(map[string]string, len(e.Attributes)+2)
+		for k, v := range e.Attributes {
+			attrs[k] = v
+		}
+		tracePropagator.Inject(ctx, propagation.MapCarrier(attrs))
+		e.Attributes = attrs
+		err := next(ctx, e)
+		endSpan(span, err)
+		return err
+	}
+}
+
+// Start a span for broadcasting an event, as a child of the span that
+// published it if its context was carried along.
+func (b *SSEHandler) startBroadcastSpan(e Event) (context.Context, trace.Span) {
+	ctx := tracePropagator.Extract(context.Background(), propagation.MapCarrier(e.Attributes))
+	return b.tracer.Start(ctx, "sse.broadcast",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(eventAttributes(e)...),
+		trace.WithAttributes(attribute.String("sse.event.id", e.ID)),
+	)
+}
+
+// End a broadcast span, recording who the event was delivered to.
+func endBroadcastSpan(span trace.Span, result BroadcastResult) {
+	span.SetAttributes(
+		attribute.Int("sse.clients.enqueued", result.Enqueued),
+		attribute.Int("sse.clients.filtered", result.Filtered),
+		attribute.Int("sse.clients.dropped", result.Dropped),
+	)
+	span.End()
+}
+
+// Start a span for writing a broadcast event to a client.
+func (b *SSEHandler) startDeliverySpan(msg message, s *client) trace.Span {
+	_, span := b.tracer.Start(msg.trace, "sse.deliver",
+		trace.WithAttributes(attribute.String("sse.client.id", s.id)),
+	)
+	return span
+}
+
+// End a span, recording the error if there was one.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Get the attributes of the spans for an event.
+func eventAttributes(e Event) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{}
+	if e.Topic != "" {
+		attrs = append(attrs, attribute.String("sse.topic", e.Topic))
+	}
+	if e.Event != "" {
+		attrs = append(attrs, attribute.String("sse.event.name", e.Event))
+	}
+	return attrs
+}
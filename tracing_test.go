@@ -0,0 +1,38 @@
+package ssehandler
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	b := NewSSEHandler(WithTracing(tp, true))
+	b.HandleEvents()
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	if _, err := b.PublishEvent(ctx, Event{Topic: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+	b.Close(context.Background())
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range rec.Ended() {
+		spans[s.Name()] = s
+	}
+	publish, broadcast := spans["sse.publish"], spans["sse.broadcast"]
+	if publish == nil || broadcast == nil {
+		t.Fatalf("got spans %v", spans)
+	}
+	if publish.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("publish span isn't a child of the request")
+	}
+	if broadcast.Parent().SpanID() != publish.SpanContext().SpanID() {
+		t.Error("broadcast span isn't a child of the publish span")
+	}
+}
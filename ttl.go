@@ -0,0 +1,29 @@
+package ssehandler
+
+import "time"
+
+// Set the expiry of an event sent with a TTL, as it's sent.
+func withExpiry(e Event) Event {
+	if e.TTL > 0 && e.Expires.IsZero() {
+		e.Expires = time.Now().Add(e.TTL)
+	}
+	return e
+}
+
+// Check if an event has gone stale.
+func expired(e Event) bool {
+	return !e.Expires.IsZero() && time.Now().After(e.Expires)
+}
+
+// Drop the stale events, which mustn't be replayed.
+func (b *SSEHandler) dropExpired(events []Event) []Event {
+	fresh := events[:0]
+	for _, e := range events {
+		if expired(e) {
+			b.metrics.expired.Inc()
+			continue
+		}
+		fresh = append(fresh, e)
+	}
+	return fresh
+}
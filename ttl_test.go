@@ -0,0 +1,43 @@
+package ssehandler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWithExpiry(t *testing.T) {
+	at := time.Now().Add(time.Hour)
+	if e := withExpiry(Event{TTL: time.Minute}); e.Expires.Before(time.Now().Add(59 * time.Second)) {
+		t.Errorf("got %v", e.Expires)
+	}
+	if e := withExpiry(Event{TTL: time.Minute, Expires: at}); !e.Expires.Equal(at) {
+		t.Errorf("got %v, want %v", e.Expires, at)
+	}
+	if e := withExpiry(Event{}); !e.Expires.IsZero() {
+		t.Errorf("got %v", e.Expires)
+	}
+}
+
+func TestExpiredNotReplayed(t *testing.T) {
+	b := NewSSEHandler(WithReplay(10), WithSendLast(10))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	b.Send(Event{ID: "1", TTL: 10 * time.Millisecond})
+	b.Send(Event{ID: "2", TTL: time.Hour})
+	b.Send(Event{ID: "3"})
+	b.Sync(context.Background())
+	time.Sleep(20 * time.Millisecond)
+	if got := joinIDs(b.missedEvents(&client{})); got != "23" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestExpiredNotWritten(t *testing.T) {
+	b := NewSSEHandler()
+	s := &client{w: &customStream{s: brokenStream{}}}
+	b.write(s, message{event: Event{Expires: time.Now().Add(-time.Second)}})
+	if s.evicted.Load() {
+		t.Error("stale event was written")
+	}
+}
@@ -0,0 +1,63 @@
+package ssehandler
+
+import (
+	"context"
+	"sync"
+)
+
+// A Tx collects a group of related events, to be sent out together once it's
+// committed, or not at all if it's rolled back. See Tx.
+type Tx struct {
+	b      *SSEHandler
+	mu     sync.Mutex
+	events []Event
+	done   bool
+}
+
+// Start a transaction. Its events are sent out all at once when it's
+// committed, as by SendBatch, so that each client receives all of the ones
+// for it one after the other, without any other events in between. A client
+// falling behind drops either all or none of them. Nothing is sent if the
+// transaction is rolled back.
+func (b *SSEHandler) Tx() *Tx {
+	return &Tx{b: b}
+}
+
+// Add an event to the transaction. Returns ErrTxDone if it's been committed
+// or rolled back already.
+func (tx *Tx) Send(e Event) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.events = append(tx.events, e)
+	return nil
+}
+
+// Send out the transaction's events, blocking until they've been queued or
+// ctx is done. Returns ErrTxDone if it's been committed or rolled back
+// already, ErrNotRunning if the event loop isn't running, or ctx's error, in
+// which case none of the events are sent.
+func (tx *Tx) Commit(ctx context.Context) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	return tx.b.sendBatch(ctx, tx.events)
+}
+
+// Drop the transaction's events, without sending any of them. Returns
+// ErrTxDone if it's been committed or rolled back already.
+func (tx *Tx) Rollback() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.events = nil
+	return nil
+}
@@ -0,0 +1,48 @@
+package ssehandler
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTx(t *testing.T) {
+	b := NewSSEHandler(WithReplay(10))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	ctx := context.Background()
+
+	aborted := b.Tx()
+	aborted.Send(Event{ID: "x"})
+	if err := aborted.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	tx := b.Tx()
+	tx.Send(Event{ID: "1"})
+	tx.Send(Event{ID: "2"})
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{aborted.Commit(ctx), tx.Commit(ctx), tx.Rollback(), tx.Send(Event{})} {
+		if err != ErrTxDone {
+			t.Errorf("got %v, want ErrTxDone", err)
+		}
+	}
+	b.Sync(ctx)
+	if got := history(t, b); got != "12" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestPackBatch(t *testing.T) {
+	packed, err := packBatch([]Event{{ID: "1", Data: []byte("a")}, {ID: "2", Topic: "t"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, ok := unpackBatch(packed)
+	if !ok || joinIDs(events) != "12" || string(events[0].Data) != "a" || events[1].Topic != "t" {
+		t.Errorf("got %+v", events)
+	}
+	if _, ok := unpackBatch(Event{Data: []byte("[]")}); ok {
+		t.Error("unpacked a plain event")
+	}
+}
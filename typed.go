@@ -0,0 +1,74 @@
+package ssehandler
+
+import "context"
+
+// A TypedHandler wraps a handler for sending events whose payloads are all of
+// type T, encoded the same way, so that the payloads are checked at compile
+// time.
+type TypedHandler[T any] struct {
+	h      *SSEHandler
+	encode func(T) ([]byte, error)
+}
+
+// Make a new TypedHandler sending through h, with payloads encoded by encode,
+// or by h's encoders if nil. See WithEncoder.
+func NewTypedHandler[T any](h *SSEHandler, encode func(T) ([]byte, error)) *TypedHandler[T] {
+	return &TypedHandler[T]{h: h, encode: encode}
+}
+
+// Get the wrapped handler, for subscribing clients and such.
+func (t *TypedHandler[T]) Unwrap() *SSEHandler {
+	return t.h
+}
+
+// Encode a payload into an event.
+func (t *TypedHandler[T]) event(name, topic string, v T) (Event, error) {
+	var data []byte
+	var err error
+	if t.encode != nil {
+		data, err = t.encode(v)
+	} else {
+		data, err = t.h.encode(topic, v)
+	}
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Event: name, Topic: topic, Data: data}, nil
+}
+
+// Send out a payload to all clients. Returns an error if it can't be encoded.
+func (t *TypedHandler[T]) Send(v T) error {
+	return t.SendEvent("", v)
+}
+
+// Send out a payload as a named event to all clients. Returns an error if it
+// can't be encoded.
+func (t *TypedHandler[T]) SendEvent(name string, v T) error {
+	e, err := t.event(name, "", v)
+	if err != nil {
+		return err
+	}
+	t.h.Send(e)
+	return nil
+}
+
+// Send out a payload to the clients subscribed to topic. Returns an error if
+// it can't be encoded.
+func (t *TypedHandler[T]) Publish(topic string, v T) error {
+	e, err := t.event("", topic, v)
+	if err != nil {
+		return err
+	}
+	t.h.Send(e)
+	return nil
+}
+
+// Send out a payload to all clients, blocking until it has been queued or ctx
+// is done. See SSEHandler.SendContext.
+func (t *TypedHandler[T]) SendContext(ctx context.Context, v T) error {
+	e, err := t.event("", "", v)
+	if err != nil {
+		return err
+	}
+	return t.h.SendContext(ctx, e)
+}
@@ -0,0 +1,177 @@
+package ssehandler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A Webhook describes the signed webhooks received by a WebhookHandler, see
+// GitHubWebhook and StripeWebhook for the common ones.
+type Webhook struct {
+	// Check the signature of a webhook, returning an error if it doesn't
+	// match the body. Required.
+	Verify func(h http.Header, body []byte) error
+
+	// Get the name of the event sent out for a webhook, such as the event
+	// type given by its sender. Plain messages are sent if nil.
+	Name func(h http.Header, body []byte) string
+
+	// Topic the events are sent out on, or all clients if left empty.
+	Topic string
+
+	// Get the topic of an event instead, such as by its name, if set.
+	Route func(e Event) string
+
+	// Largest body accepted, 1 MiB if zero. Larger webhooks are refused
+	// with 413 Request Entity Too Large.
+	MaxBody int64
+}
+
+// Largest webhook body accepted by default.
+const maxWebhookBody = 1 << 20
+
+// Get a gin handler that receives signed webhooks from other services and
+// sends out their bodies, as is, as events. Webhooks whose signature doesn't
+// match are refused with 401 Unauthorized, and 202 Accepted is returned once
+// the event has been queued. Otherwise the status codes are the same as for
+// PublishHandler, such as 429 Too Many Requests while the clients can't keep
+// up. Panics if w has no Verify, so the handler can't be left open by mistake.
+func (b *SSEHandler) WebhookHandler(w Webhook) gin.HandlerFunc {
+	if w.Verify == nil {
+		panic("ssehandler: webhook handler requires a verifier")
+	}
+	limit := w.MaxBody
+	if limit < 1 {
+		limit = maxWebhookBody
+	}
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.AbortWithError(http.StatusRequestEntityTooLarge, err)
+			} else {
+				c.AbortWithError(http.StatusBadRequest, err)
+			}
+			return
+		}
+		if err := w.Verify(c.Request.Header, body); err != nil {
+			c.AbortWithError(http.StatusUnauthorized, err)
+			return
+		}
+
+		e := Event{Topic: w.Topic, Data: body}
+		if w.Name != nil {
+			e.Event = w.Name(c.Request.Header, body)
+		}
+		if w.Route != nil {
+			e.Topic = w.Route(e)
+		}
+		switch err := b.SendContext(c.Request.Context(), e); err {
+		case nil:
+			c.Status(http.StatusAccepted)
+		case ErrNotRunning, ErrCircuitOpen:
+			c.AbortWithError(http.StatusServiceUnavailable, err)
+		case ErrBackpressure:
+			c.AbortWithError(http.StatusTooManyRequests, err)
+		default:
+			c.AbortWithError(http.StatusInternalServerError, err)
+		}
+	}
+}
+
+// Check webhooks signed with a hex encoded HMAC-SHA256 of their body, using
+// the secret, in the header. Any prefix, such as "sha256=", is stripped from
+// the header's value first.
+func HMACSignature(header, prefix string, secret []byte) func(http.Header, []byte) error {
+	return func(h http.Header, body []byte) error {
+		sig, ok := strings.CutPrefix(h.Get(header), prefix)
+		if !ok || !validMAC(secret, body, sig) {
+			return ErrBadSignature
+		}
+		return nil
+	}
+}
+
+// Receive GitHub's webhooks, signed with the secret in their
+// X-Hub-Signature-256 header and named by their X-GitHub-Event header, such as
+// "push" or "pull_request".
+func GitHubWebhook(secret []byte, topic string) Webhook {
+	return Webhook{
+		Verify: HMACSignature("X-Hub-Signature-256", "sha256=", secret),
+		Name: func(h http.Header, _ []byte) string {
+			return h.Get("X-GitHub-Event")
+		},
+		Topic: topic,
+	}
+}
+
+// Oldest Stripe signature accepted, to keep webhooks from being replayed.
+const stripeTolerance = 5 * time.Minute
+
+// Receive Stripe's webhooks, signed with the endpoint's secret in their
+// Stripe-Signature header and named by the event type in their body, such as
+// "invoice.paid". Webhooks signed more than 5 minutes ago are refused.
+func StripeWebhook(secret []byte, topic string) Webhook {
+	return Webhook{
+		Verify: func(h http.Header, body []byte) error {
+			return verifyStripe(h.Get("Stripe-Signature"), secret, body, time.Now())
+		},
+		Name: func(_ http.Header, body []byte) string {
+			var e struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal(body, &e)
+			return e.Type
+		},
+		Topic: topic,
+	}
+}
+
+// Check a Stripe-Signature header, of the form "t=<unix time>,v1=<hex>", with
+// any number of v1 signatures, made at most stripeTolerance before now.
+func verifyStripe(header string, secret, body []byte, now time.Time) error {
+	var ts string
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+	t, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || now.Sub(time.Unix(t, 0)).Abs() > stripeTolerance {
+		return ErrBadSignature
+	}
+	signed := append([]byte(ts+"."), body...)
+	for _, sig := range sigs {
+		if validMAC(secret, signed, sig) {
+			return nil
+		}
+	}
+	return ErrBadSignature
+}
+
+// Check if sig is the hex encoded HMAC-SHA256 of the message.
+func validMAC(secret, msg []byte, sig string) bool {
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(msg)
+	return hmac.Equal(got, mac.Sum(nil))
+}
@@ -0,0 +1,107 @@
+package ssehandler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func sign(secret, msg string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(msg))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestGitHubWebhook(t *testing.T) {
+	w := GitHubWebhook([]byte("s3cret"), "github")
+	body := []byte(`{"action":"opened"}`)
+	tests := []struct {
+		sig string
+		ok  bool
+	}{
+		{"sha256=" + sign("s3cret", string(body)), true},
+		{sign("s3cret", string(body)), false},
+		{"sha256=" + sign("other", string(body)), false},
+		{"sha256=zz", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		h := http.Header{"X-Hub-Signature-256": {tt.sig}, "X-Github-Event": {"pull_request"}}
+		if err := w.Verify(h, body); (err == nil) != tt.ok {
+			t.Errorf("%q: got %v", tt.sig, err)
+		}
+		if got := w.Name(h, body); got != "pull_request" {
+			t.Errorf("got name %q", got)
+		}
+	}
+}
+
+func TestVerifyStripe(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"type":"invoice.paid"}`)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	old := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+	tests := []struct {
+		header string
+		ok     bool
+	}{
+		{"t=" + ts + ",v1=" + sign("whsec", ts+"."+string(body)), true},
+		{"t=" + ts + ",v1=bad,v1=" + sign("whsec", ts+"."+string(body)) + ",v0=x", true},
+		{"t=" + ts + ",v1=" + sign("other", ts+"."+string(body)), false},
+		{"t=" + old + ",v1=" + sign("whsec", old+"."+string(body)), false},
+		{"v1=" + sign("whsec", "."+string(body)), false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if err := verifyStripe(tt.header, []byte("whsec"), body, now); (err == nil) != tt.ok {
+			t.Errorf("%q: got %v", tt.header, err)
+		}
+	}
+	if got := StripeWebhook(nil, "").Name(nil, body); got != "invoice.paid" {
+		t.Errorf("got name %q", got)
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	body := `{"action":"opened"}`
+	tests := []struct {
+		name  string
+		sig   string
+		setup func(b *SSEHandler)
+		want  int
+	}{
+		{"accepted", sign("s3cret", body), func(b *SSEHandler) { b.HandleEvents() }, http.StatusAccepted},
+		{"bad signature", sign("other", body), func(b *SSEHandler) { b.HandleEvents() }, http.StatusUnauthorized},
+		{"not running", sign("s3cret", body), func(b *SSEHandler) {}, http.StatusServiceUnavailable},
+		{"backpressure", sign("s3cret", body), func(b *SSEHandler) {
+			b.running.Store(true)
+			b.pressured.Store(true)
+		}, http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewSSEHandler()
+			tt.setup(b)
+			defer b.Close(context.Background())
+			r := gin.New()
+			r.POST("/hook", b.WebhookHandler(GitHubWebhook([]byte("s3cret"), "github")))
+			req := httptest.NewRequest("POST", "/hook", strings.NewReader(body))
+			req.Header.Set("X-Hub-Signature-256", "sha256="+tt.sig)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("got %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
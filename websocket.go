@@ -0,0 +1,107 @@
+package ssehandler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Time allowed for writing control messages, such as pings.
+const controlTimeout = 5 * time.Second
+
+// A stream of events over a WebSocket, with each event sent as a text message
+// formatted by FormatJSON.
+type wsStream struct {
+	c        *gin.Context
+	upgrader *websocket.Upgrader
+	conn     *websocket.Conn
+
+	// Extra headers of the upgrade response, see WithHeaderFunc.
+	header http.Header
+}
+
+// Subscribe a new client over a WebSocket instead of SSE, for environments
+// where SSE doesn't work, such as behind some proxies. The client receives
+// the same events as with Subscribe, each as a text message with a JSON
+// object made by FormatJSON. As browsers can't set the Last-Event-ID header
+// on WebSockets, it can also be sent in the "lastEventId" query parameter.
+// Anything the client sends is ignored.
+func (b *SSEHandler) SubscribeWebSocket(c *gin.Context, topics ...string) {
+	b.subscribe(c, nil, topics, b.openWebSocket)
+}
+
+// Get a gin handler that subscribes new clients over WebSockets to the
+// topics.
+func (b *SSEHandler) WebSocketHandler(topics ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b.SubscribeWebSocket(c, topics...)
+	}
+}
+
+// Prepare a WebSocket stream for the client. The connection is upgraded once
+// the client has been added to the handler.
+func (b *SSEHandler) openWebSocket(c *gin.Context, cl *client) bool {
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		b.reject(c, http.StatusBadRequest, ErrNotWebSocket)
+		return false
+	}
+	if cl.lastEventID == "" {
+		cl.lastEventID = c.Query("lastEventId")
+	}
+	ws := &wsStream{c: c, upgrader: b.upgrader}
+	if b.headerFunc != nil {
+		ws.header = make(http.Header)
+		b.headerFunc(c, ws.header)
+	}
+	cl.w = ws
+	cl.format = FormatJSON
+	return true
+}
+
+func (s *wsStream) Open() (<-chan struct{}, error) {
+	conn, err := s.upgrader.Upgrade(s.c.Writer, s.c.Request, s.header)
+	if err != nil {
+		// The upgrader has already responded
+		return nil, err
+	}
+	s.conn = conn
+
+	// Control messages, as well as the client closing the connection, are
+	// only seen while reading.
+	disconnected := make(chan struct{})
+	go func() {
+		defer close(disconnected)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	return disconnected, nil
+}
+
+func (s *wsStream) Write(p []byte) (int, error) {
+	if err := s.conn.WriteMessage(websocket.TextMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Messages are sent as soon as they're written.
+func (s *wsStream) Flush() error { return nil }
+
+func (s *wsStream) SetWriteDeadline(t time.Time) error {
+	return s.conn.SetWriteDeadline(t)
+}
+
+func (s *wsStream) Ping() error {
+	return s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(controlTimeout))
+}
+
+func (s *wsStream) Close() error {
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(controlTimeout))
+	return s.conn.Close()
+}
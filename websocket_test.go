@@ -0,0 +1,34 @@
+package ssehandler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocketHeaderFunc(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	b := NewSSEHandler(WithHeaderFunc(func(c *gin.Context, h http.Header) {
+		h.Add("Set-Cookie", "session=1")
+	}))
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	r := gin.New()
+	r.GET("/ws", b.WebSocketHandler())
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if got := resp.Header.Get("Set-Cookie"); got != "session=1" {
+		t.Errorf("got cookie %q", got)
+	}
+}
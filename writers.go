@@ -0,0 +1,206 @@
+package ssehandler
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Write a message to a client, which must be locked. Stale messages are
+// dropped, as are deltas out of sequence. Clients whose writes fail or time
+// out are disconnected, as are clients whose formatter panics.
+func (b *SSEHandler) write(s *client, msg message) {
+	defer func() {
+		if v := recover(); v != nil {
+			b.recovered("writer", v)
+			b.evict(s)
+		}
+	}()
+	if msg.batch != nil && !b.joinable(s, msg.batch) {
+		for _, m := range msg.batch {
+			b.write(s, m)
+		}
+		return
+	}
+	if expired(msg.event) {
+		b.metrics.expired.Inc()
+		b.deadMessage(s, msg, "expired")
+		return
+	}
+	if !b.inSequence(s, msg) {
+		return
+	}
+	if ew, ok := s.w.(eventWriter); ok {
+		if err := ew.WriteEvent(msg.event); err != nil {
+			b.writeFailed(s, err)
+		} else {
+			b.delivered(s, msg)
+		}
+		return
+	}
+	raw := msg.raw
+	if s.format != nil {
+		raw = s.format(msg.event)
+	}
+	b.setWriteDeadline(s)
+	var span trace.Span
+	if b.traceDeliveries && msg.trace != nil {
+		span = b.startDeliverySpan(msg, s)
+	}
+	n, err := s.w.Write(raw)
+	if span != nil {
+		endSpan(span, err)
+	}
+	s.unflushed += n
+	b.metrics.bytes.Add(float64(n))
+	if err != nil {
+		b.writeFailed(s, err)
+	} else {
+		b.delivered(s, msg)
+	}
+}
+
+// Check if a client can be written the joined bytes of a batch's messages,
+// instead of each message by itself.
+func (b *SSEHandler) joinable(s *client, batch []message) bool {
+	if _, ok := s.w.(eventWriter); ok || s.format != nil {
+		return false
+	}
+	for _, m := range batch {
+		if expired(m.event) || b.snapshotTopics[m.event.Topic] {
+			return false
+		}
+	}
+	return true
+}
+
+// Disconnect a client whose write or flush failed, such as after the
+// connection was lost, instead of waiting for its request to be cancelled.
+func (b *SSEHandler) writeFailed(s *client, err error) {
+	if !b.evict(s) {
+		return
+	}
+	b.metrics.evictions.Inc()
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		b.logger.Error("Write to client timed out", "client", s.id)
+	} else {
+		b.logger.Debug("Write to client failed", "client", s.id, "err", err)
+	}
+	b.reportError(&HandlerError{Op: "write", Client: s.id, Err: err})
+}
+
+// Give the next write to a client until the write timeout, if set. This also
+// keeps the server's own WriteTimeout from ending the stream.
+func (b *SSEHandler) setWriteDeadline(s *client) {
+	if d := b.settings().writeTimeout; d > 0 {
+		s.w.SetWriteDeadline(time.Now().Add(d))
+	}
+}
+
+// Remove a client from outside of the event loop, without blocking. Returns
+// false if it's being removed already.
+func (b *SSEHandler) evict(s *client) bool {
+	if !s.evicted.CompareAndSwap(false, true) {
+		return false
+	}
+	go func() {
+		select {
+		case b.defunctClients <- s:
+		case <-b.quit:
+		}
+	}()
+	return true
+}
+
+// Flush a client's response, which must be locked. With WithFlushInterval the
+// flush is put off until the interval has passed, unless enough bytes are
+// waiting already.
+func (b *SSEHandler) flush(s *client) {
+	if b.flushInterval <= 0 || (b.flushSize > 0 && s.unflushed >= b.flushSize) {
+		b.flushNow(s)
+		return
+	}
+	if s.flushTimer != nil || s.unflushed < 1 {
+		return
+	}
+	s.flushTimer = time.AfterFunc(b.flushInterval, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !s.finished {
+			b.flushNow(s)
+		}
+	})
+}
+
+// Flush a client's response right away, which must be locked.
+func (b *SSEHandler) flushNow(s *client) {
+	if s.flushTimer != nil {
+		s.flushTimer.Stop()
+		s.flushTimer = nil
+	}
+	s.unflushed = 0
+	b.setWriteDeadline(s)
+	if err := s.w.Flush(); err != nil {
+		b.writeFailed(s, err)
+	}
+}
+
+// Start the pool of writers, if enabled.
+func (b *SSEHandler) startWriters() {
+	for i := 0; i < b.writers; i++ {
+		go func() {
+			for s := range b.ready {
+				b.drain(s)
+			}
+		}()
+	}
+}
+
+// Stop the pool of writers, once there's no more clients to schedule.
+func (b *SSEHandler) stopWriters() {
+	if b.writers > 0 {
+		close(b.ready)
+	}
+}
+
+// Hand a client with messages waiting to the pool of writers, unless one of
+// them already has it.
+func (b *SSEHandler) schedule(s *client) {
+	if b.writers > 0 && s.scheduled.CompareAndSwap(false, true) {
+		b.ready <- s
+	}
+}
+
+// Write all messages waiting for a client, until its buffer is empty. Lets
+// the client's request handler know when it's been removed.
+func (b *SSEHandler) drain(s *client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		select {
+		case msg, open := <-s.events:
+			if !open {
+				close(s.gone)
+				return
+			}
+			b.write(s, msg)
+			continue
+		default:
+		}
+
+		b.flush(s)
+		s.scheduled.Store(false)
+		// A message might have been pushed (or the client removed) after
+		// the buffer was found empty but before it was unscheduled, in
+		// which case the pusher could have failed to schedule it again.
+		if len(s.events) < 1 && !s.closing.Load() {
+			return
+		}
+		if !s.scheduled.CompareAndSwap(false, true) {
+			// Someone else scheduled it after all
+			return
+		}
+	}
+}
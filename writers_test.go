@@ -0,0 +1,46 @@
+package ssehandler
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// A stream whose sends always fail, as with a lost connection.
+type brokenStream struct {
+	done chan struct{}
+}
+
+func (s brokenStream) Send(Event) error      { return errors.New("broken pipe") }
+func (s brokenStream) Done() <-chan struct{} { return s.done }
+
+func TestFailedWriteEvicts(t *testing.T) {
+	b := NewSSEHandler()
+	b.HandleEvents()
+	defer b.Close(context.Background())
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	subscribed := make(chan struct{})
+	go func() {
+		defer close(subscribed)
+		b.SubscribeStream(c, brokenStream{make(chan struct{})}, nil)
+	}()
+	for b.ClientCount() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	b.Send(Event{Data: []byte("x")})
+	select {
+	case <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("client wasn't evicted")
+	}
+	if got := testutil.ToFloat64(b.metrics.evictions); got != 1 {
+		t.Errorf("got %v evictions", got)
+	}
+}